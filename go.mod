@@ -4,12 +4,11 @@ go 1.16
 
 require (
 	github.com/aws/aws-lambda-go v1.19.1
-	github.com/aws/aws-sdk-go-v2 v1.16.11 // indirect
-	github.com/aws/aws-sdk-go-v2/config v1.16.1 // indirect
+	github.com/aws/aws-sdk-go-v2/config v1.16.1
 	github.com/aws/aws-sdk-go-v2/service/secretsmanager v1.15.17
 	github.com/awslabs/aws-lambda-go-api-proxy v0.13.3
-	github.com/bwmarrin/discordgo v0.25.0
-	github.com/google/go-cmp v0.5.8 // indirect
+	github.com/bwmarrin/discordgo v0.29.0
+	github.com/google/go-cmp v0.5.8
 	github.com/sirupsen/logrus v1.9.0
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"github.com/sirupsen/logrus"
+	"strings"
+)
+
+// AutocompleteChoiceLimit is the most suggestions Discord will show
+const AutocompleteChoiceLimit = 25
+
+// AutocompleteContext is an option being typed into, along with the options already filled in
+type AutocompleteContext struct {
+	Interaction discordgo.Interaction
+	Data        discordgo.ApplicationCommandInteractionData
+	// Path is the command and subcommands being used, such as "permissions guild set"
+	Path string
+	// Options are the options of the subcommand being used, by name, including the focused one
+	Options map[string]*discordgo.ApplicationCommandInteractionDataOption
+	// Focused is the option being typed into
+	Focused *discordgo.ApplicationCommandInteractionDataOption
+}
+
+// Typed is what has been typed into the focused option so far. Discord sends it as a
+// string even for number options, since it may not be a valid number yet.
+func (c *AutocompleteContext) Typed() string {
+	if c.Focused == nil || c.Focused.Value == nil {
+		return ""
+	}
+	return fmt.Sprint(c.Focused.Value)
+}
+
+// AutocompleteHandler suggests values for an option. Anything past the first 25 is dropped.
+type AutocompleteHandler func(ctx *AutocompleteContext) ([]*discordgo.ApplicationCommandOptionChoice, error)
+
+func autocompleteKey(path string, option string) string {
+	return strings.Join(strings.Fields(path), " ") + ":" + option
+}
+
+// HandleAutocomplete registers a handler for an option marked autocomplete in commands.yml,
+// on the command or subcommand path such as "permissions guild set"
+func (r *Router) HandleAutocomplete(path string, option string, handler AutocompleteHandler) {
+	key := autocompleteKey(path, option)
+	if _, exists := r.autocomplete[key]; exists {
+		panic(fmt.Sprintf("a handler is already registered for autocompleting %s %s", path, option))
+	}
+	r.autocomplete[key] = handler
+}
+
+// AutocompleteResponse is the result of an autocomplete interaction. discordgo's response leaves out an empty list
+// of choices, but Discord requires choices even when there are no suggestions.
+type AutocompleteResponse struct {
+	Type discordgo.InteractionResponseType `json:"type"`
+	Data AutocompleteResponseData          `json:"data"`
+}
+
+type AutocompleteResponseData struct {
+	Choices []*discordgo.ApplicationCommandOptionChoice `json:"choices"`
+}
+
+// RouteAutocomplete answers an autocomplete interaction with the handler for the focused option.
+// There is no way to show the user an error here, so failures are logged and no suggestions given.
+func (r *Router) RouteAutocomplete(interaction discordgo.Interaction) *AutocompleteResponse {
+
+	data := interaction.ApplicationCommandData()
+	path, options := commandPath(data)
+	ctx := &AutocompleteContext{Interaction: interaction, Data: data, Path: path,
+		Options: make(map[string]*discordgo.ApplicationCommandInteractionDataOption)}
+	for _, option := range options {
+		ctx.Options[option.Name] = option
+		if option.Focused {
+			ctx.Focused = option
+		}
+	}
+
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	if ctx.Focused == nil {
+		logrus.Warnf("No option is focused in autocomplete for %s", path)
+	} else if handler, exists := r.autocomplete[autocompleteKey(path, ctx.Focused.Name)]; !exists {
+		logrus.Warnf("No autocomplete handler for %s %s", path, ctx.Focused.Name)
+	} else if suggested, err := handler(ctx); err != nil {
+		logrus.Errorf("Autocomplete handler for %s %s failed: %s", path, ctx.Focused.Name, err.Error())
+	} else if suggested != nil {
+		choices = suggested
+	}
+
+	if len(choices) > AutocompleteChoiceLimit {
+		logrus.Debugf("Dropping %d autocomplete choices for %s over the limit of %d",
+			len(choices)-AutocompleteChoiceLimit, path, AutocompleteChoiceLimit)
+		choices = choices[:AutocompleteChoiceLimit]
+	}
+	return &AutocompleteResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: AutocompleteResponseData{Choices: choices},
+	}
+}
+
+// MatchChoices suggests the choices whose names match what has been typed, ignoring case. Names that start with
+// it come first, then names with a word that starts with it, then names with its letters in order, such as "gst"
+// for "game settings timeout". Anything typed matches everything when it's empty.
+func MatchChoices(typed string, choices []*discordgo.ApplicationCommandOptionChoice) []*discordgo.ApplicationCommandOptionChoice {
+
+	typed = strings.ToLower(strings.TrimSpace(typed))
+	var prefix, word, fuzzy []*discordgo.ApplicationCommandOptionChoice
+	for _, choice := range choices {
+		name := strings.ToLower(choice.Name)
+		switch {
+		case strings.HasPrefix(name, typed):
+			prefix = append(prefix, choice)
+		case hasWordPrefix(name, typed):
+			word = append(word, choice)
+		case inOrder(name, typed):
+			fuzzy = append(fuzzy, choice)
+		}
+	}
+
+	matched := append(append(prefix, word...), fuzzy...)
+	if len(matched) > AutocompleteChoiceLimit {
+		matched = matched[:AutocompleteChoiceLimit]
+	}
+	return matched
+}
+
+func hasWordPrefix(name string, typed string) bool {
+	words := strings.FieldsFunc(name, func(r rune) bool { return r == ' ' || r == '_' || r == '-' })
+	for i := range words {
+		if strings.HasPrefix(strings.Join(words[i:], " "), typed) {
+			return true
+		}
+	}
+	return false
+}
+
+func inOrder(name string, typed string) bool {
+	remaining := []rune(typed)
+	for _, r := range name {
+		if len(remaining) == 0 {
+			break
+		}
+		if r == remaining[0] {
+			remaining = remaining[1:]
+		}
+	}
+	return len(remaining) == 0
+}
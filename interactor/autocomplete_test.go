@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"strings"
+	"testing"
+)
+
+func choiceNames(choices []*discordgo.ApplicationCommandOptionChoice) string {
+	var names []string
+	for _, choice := range choices {
+		names = append(names, choice.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestMatchChoices(t *testing.T) {
+	choices := []*discordgo.ApplicationCommandOptionChoice{
+		{Name: "game", Value: "game"}, {Name: "game settings timeout", Value: "game settings timeout"},
+		{Name: "Challenge", Value: "Challenge"}, {Name: "blep", Value: "blep"}, {Name: "lockdown", Value: "lockdown"},
+	}
+	for typed, expected := range map[string]string{
+		"":         "game,game settings timeout,Challenge,blep,lockdown",
+		"  GA":     "game,game settings timeout",
+		"set":      "game settings timeout",
+		"gst":      "game settings timeout",
+		"l":        "lockdown,Challenge,blep",
+		"lockdown": "lockdown",
+		"boop":     "",
+	} {
+		if matched := choiceNames(MatchChoices(typed, choices)); matched != expected {
+			t.Errorf("Expected %q to match %q, got %q", typed, expected, matched)
+		}
+	}
+
+	var many []*discordgo.ApplicationCommandOptionChoice
+	for i := 0; i < 40; i++ {
+		many = append(many, &discordgo.ApplicationCommandOptionChoice{Name: fmt.Sprintf("animal %d", i), Value: i})
+	}
+	if matched := MatchChoices("animal", many); len(matched) != AutocompleteChoiceLimit {
+		t.Errorf("Expected %d matches, got %d", AutocompleteChoiceLimit, len(matched))
+	}
+}
+
+func TestRouteAutocomplete(t *testing.T) {
+	r := NewRouter(nil)
+	var focused *AutocompleteContext
+	r.HandleAutocomplete("game settings timeout", "seconds", func(ctx *AutocompleteContext) ([]*discordgo.ApplicationCommandOptionChoice, error) {
+		focused = ctx
+		var choices []*discordgo.ApplicationCommandOptionChoice
+		for i := 1; i <= 30; i++ {
+			choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: fmt.Sprintf("%s%d", ctx.Typed(), i), Value: i})
+		}
+		return choices, nil
+	})
+	r.HandleAutocomplete("blep", "animal", func(ctx *AutocompleteContext) ([]*discordgo.ApplicationCommandOptionChoice, error) {
+		return nil, errors.New("no animals available")
+	})
+
+	response := r.RouteAutocomplete(testInteraction(t, `{"type": 4, "data": {"name": "game", "type": 1, "options": [
+		{"name": "settings", "type": 2, "options": [{"name": "timeout", "type": 1, "options": [
+			{"name": "mode", "type": 3, "value": "classic"}, {"name": "seconds", "type": 4, "value": "1", "focused": true}]}]}]}}`))
+	if response.Type != discordgo.InteractionApplicationCommandAutocompleteResult || len(response.Data.Choices) != AutocompleteChoiceLimit {
+		t.Errorf("Expected %d choices, got %+v", AutocompleteChoiceLimit, response)
+	}
+	if focused == nil || focused.Path != "game settings timeout" || focused.Typed() != "1" || focused.Options["mode"].Value != "classic" {
+		t.Errorf("Expected seconds to be focused with the other options given, got %+v", focused)
+	}
+
+	// Failing and unknown handlers still answer, with no suggestions
+	for _, body := range []string{
+		`{"type": 4, "data": {"name": "blep", "type": 1, "options": [{"name": "animal", "type": 3, "value": "c", "focused": true}]}}`,
+		`{"type": 4, "data": {"name": "boop", "type": 1, "options": [{"name": "animal", "type": 3, "value": "c", "focused": true}]}}`,
+	} {
+		response = r.RouteAutocomplete(testInteraction(t, body))
+		// Discord rejects the response without choices, even when there are none
+		if marshalled, _ := json.Marshal(response); !strings.Contains(string(marshalled), `"choices":[]`) {
+			t.Errorf("Expected no choices for %s, got %s", body, marshalled)
+		}
+	}
+}
+
+func TestHelpAutocomplete(t *testing.T) {
+	manifest, _ := LoadManifest([]byte(testManifest))
+	choices := MatchChoices("set", HelpChoices(manifest, "123456789012345678"))
+	if names := choiceNames(choices); names != "game settings,game settings timeout" {
+		t.Errorf("Expected the settings subcommands, got %s", names)
+	}
+	if names := choiceNames(HelpChoices(manifest, "")); strings.Contains(names, "lockdown") {
+		t.Errorf("Expected guild commands to be left out of DMs, got %s", names)
+	}
+
+	response, err := HandleInteraction(testInteraction(t, `{"type": 4, "data": {"name": "help", "type": 1, "options": [
+		{"name": "command", "type": 3, "value": "ble", "focused": true}]}}`))
+	if err != nil || !strings.Contains(response.Body, `"choices":[{"name":"blep","value":"blep"}]`) {
+		t.Errorf("Expected /help to suggest blep, got %s, %v", response.Body, err)
+	}
+}
@@ -0,0 +1,156 @@
+// Code generated by slash_commands generate. DO NOT EDIT.
+
+package main
+
+import (
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+)
+
+// AnimalChoice is a choice of /blep animal
+type AnimalChoice string
+
+const (
+	AnimalDog     AnimalChoice = "animal_dog"     // Dog
+	AnimalCat     AnimalChoice = "animal_cat"     // Cat
+	AnimalPengiun AnimalChoice = "animal_penguin" // Pengiun
+)
+
+// Valid says whether c is one of the choices
+func (c AnimalChoice) Valid() bool {
+	switch c {
+	case AnimalDog, AnimalCat, AnimalPengiun:
+		return true
+	}
+	return false
+}
+
+// BlepOptions are the options of /blep. Optional options are nil when they weren't given.
+type BlepOptions struct {
+	Animal   AnimalChoice
+	OnlySmol *bool
+}
+
+// ParseBlepOptions reads the options of /blep from the interaction
+func ParseBlepOptions(data discordgo.ApplicationCommandInteractionData) (*BlepOptions, error) {
+	options, err := commandOptions(data, "blep")
+	if err != nil {
+		return nil, err
+	}
+	parsed := BlepOptions{}
+	if option := findOption(options, "animal"); option != nil {
+		value, err := stringOption(option)
+		if err != nil {
+			return nil, err
+		}
+		choice := AnimalChoice(value)
+		if !choice.Valid() {
+			return nil, fmt.Errorf("/blep option animal is not one of its choices: %v", value)
+		}
+		parsed.Animal = choice
+	} else {
+		return nil, fmt.Errorf("/blep is missing required option animal")
+	}
+	if option := findOption(options, "only_smol"); option != nil {
+		value, err := boolOption(option)
+		if err != nil {
+			return nil, err
+		}
+		parsed.OnlySmol = &value
+	}
+	return &parsed, nil
+}
+
+// HelloworldOptions are the options of /helloworld
+type HelloworldOptions struct{}
+
+// ParseHelloworldOptions reads the options of /helloworld from the interaction
+func ParseHelloworldOptions(data discordgo.ApplicationCommandInteractionData) (*HelloworldOptions, error) {
+	_, err := commandOptions(data, "helloworld")
+	if err != nil {
+		return nil, err
+	}
+	parsed := HelloworldOptions{}
+	return &parsed, nil
+}
+
+// HelpOptions are the options of /help. Optional options are nil when they weren't given.
+type HelpOptions struct {
+	Command *string
+}
+
+// ParseHelpOptions reads the options of /help from the interaction
+func ParseHelpOptions(data discordgo.ApplicationCommandInteractionData) (*HelpOptions, error) {
+	options, err := commandOptions(data, "help")
+	if err != nil {
+		return nil, err
+	}
+	parsed := HelpOptions{}
+	if option := findOption(options, "command"); option != nil {
+		value, err := stringOption(option)
+		if err != nil {
+			return nil, err
+		}
+		parsed.Command = &value
+	}
+	return &parsed, nil
+}
+
+// commandOptions checks the interaction is for the command at path, and returns the options given to it
+func commandOptions(data discordgo.ApplicationCommandInteractionData, path ...string) ([]*discordgo.ApplicationCommandInteractionDataOption, error) {
+	if data.Name != path[0] {
+		return nil, fmt.Errorf("interaction is for /%s, not /%s", data.Name, path[0])
+	}
+	options := data.Options
+	for _, name := range path[1:] {
+		option := findOption(options, name)
+		if option == nil || (option.Type != discordgo.ApplicationCommandOptionSubCommand &&
+			option.Type != discordgo.ApplicationCommandOptionSubCommandGroup) {
+			return nil, fmt.Errorf("interaction is not for subcommand %s of /%s", name, data.Name)
+		}
+		options = option.Options
+	}
+	return options, nil
+}
+
+func findOption(options []*discordgo.ApplicationCommandInteractionDataOption, name string) *discordgo.ApplicationCommandInteractionDataOption {
+	for _, option := range options {
+		if option.Name == name {
+			return option
+		}
+	}
+	return nil
+}
+
+func stringOption(option *discordgo.ApplicationCommandInteractionDataOption) (string, error) {
+	value, ok := option.Value.(string)
+	if !ok {
+		return "", fmt.Errorf("option %s is %T, not a string", option.Name, option.Value)
+	}
+	return value, nil
+}
+
+// intOption reads an integer, which arrives as a JSON number like any other
+func intOption(option *discordgo.ApplicationCommandInteractionDataOption) (int64, error) {
+	value, ok := option.Value.(float64)
+	if !ok || value != float64(int64(value)) {
+		return 0, fmt.Errorf("option %s is %v, not an integer", option.Name, option.Value)
+	}
+	return int64(value), nil
+}
+
+func floatOption(option *discordgo.ApplicationCommandInteractionDataOption) (float64, error) {
+	value, ok := option.Value.(float64)
+	if !ok {
+		return 0, fmt.Errorf("option %s is %T, not a number", option.Name, option.Value)
+	}
+	return value, nil
+}
+
+func boolOption(option *discordgo.ApplicationCommandInteractionDataOption) (bool, error) {
+	value, ok := option.Value.(bool)
+	if !ok {
+		return false, fmt.Errorf("option %s is %T, not a boolean", option.Name, option.Value)
+	}
+	return value, nil
+}
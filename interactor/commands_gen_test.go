@@ -0,0 +1,47 @@
+package main
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"testing"
+)
+
+func blepData(options ...*discordgo.ApplicationCommandInteractionDataOption) discordgo.ApplicationCommandInteractionData {
+	return discordgo.ApplicationCommandInteractionData{Name: "blep", Options: options}
+}
+
+func TestParseBlepOptions(t *testing.T) {
+	parsed, err := ParseBlepOptions(blepData(
+		&discordgo.ApplicationCommandInteractionDataOption{Name: "animal", Type: discordgo.ApplicationCommandOptionString, Value: "animal_cat"},
+		&discordgo.ApplicationCommandInteractionDataOption{Name: "only_smol", Type: discordgo.ApplicationCommandOptionBoolean, Value: true},
+	))
+	if err != nil {
+		t.Fatalf("Unable to parse options: %s", err.Error())
+	}
+	if parsed.Animal != AnimalCat || parsed.OnlySmol == nil || !*parsed.OnlySmol {
+		t.Errorf("Unexpected options: %+v", parsed)
+	}
+
+	// Optional options that weren't given are left nil
+	parsed, err = ParseBlepOptions(blepData(
+		&discordgo.ApplicationCommandInteractionDataOption{Name: "animal", Type: discordgo.ApplicationCommandOptionString, Value: "animal_dog"},
+	))
+	if err != nil || parsed.Animal != AnimalDog || parsed.OnlySmol != nil {
+		t.Errorf("Unexpected options: %+v, %v", parsed, err)
+	}
+}
+
+func TestParseBlepOptionsRejectsBadData(t *testing.T) {
+	cases := map[string]discordgo.ApplicationCommandInteractionData{
+		"missing required option": blepData(),
+		"unknown choice": blepData(&discordgo.ApplicationCommandInteractionDataOption{Name: "animal",
+			Type: discordgo.ApplicationCommandOptionString, Value: "animal_axolotl"}),
+		"wrong value type": blepData(&discordgo.ApplicationCommandInteractionDataOption{Name: "animal",
+			Type: discordgo.ApplicationCommandOptionString, Value: 1.0}),
+		"other command": {Name: "helloworld"},
+	}
+	for name, data := range cases {
+		if _, err := ParseBlepOptions(data); err == nil {
+			t.Errorf("Expected %s to fail", name)
+		}
+	}
+}
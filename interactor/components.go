@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/bwmarrin/discordgo"
+	"github.com/sirupsen/logrus"
+	"os"
+	"strings"
+)
+
+// CustomIDLimit is the most characters Discord allows in a component's custom_id
+const CustomIDLimit = 100
+
+// signatureLength is how many bytes of the HMAC are kept, which is plenty for state that only lives as long as a message
+const signatureLength = 12
+
+// ErrTamperedState is returned when the state in a custom_id wasn't signed with our key
+var ErrTamperedState = errors.New("custom_id state has been tampered with")
+
+// KeyFn returns the key state is signed with
+type KeyFn func() ([]byte, error)
+
+// StateCodec stores small state payloads in custom IDs, such as "blep:reroll:<state>", signed so they can't be changed
+// by anyone who isn't us. The state is JSON, so keep it small: field names count towards the 100 characters too.
+type StateCodec struct {
+	key KeyFn
+}
+
+func NewStateCodec(key KeyFn) *StateCodec {
+	return &StateCodec{key: key}
+}
+
+func (c *StateCodec) sign(route string, payload string) (string, error) {
+	key, err := c.key()
+	if err != nil {
+		return "", fmt.Errorf("unable to get the custom_id key: %w", err)
+	}
+	mac := hmac.New(sha256.New, key)
+	// The route is signed too, so state can't be moved onto a different component
+	mac.Write([]byte(route + ":" + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:signatureLength]), nil
+}
+
+// CustomID builds the custom_id of a component routed to route, carrying state. A nil state leaves just the route.
+func (c *StateCodec) CustomID(route string, state interface{}) (string, error) {
+
+	customId := route
+	if state != nil {
+		body, err := json.Marshal(state)
+		if err != nil {
+			return "", fmt.Errorf("unable to encode state for %s: %w", route, err)
+		}
+		payload := base64.RawURLEncoding.EncodeToString(body)
+		signature, err := c.sign(route, payload)
+		if err != nil {
+			return "", err
+		}
+		customId = route + ":" + payload + "." + signature
+	}
+	if len(customId) > CustomIDLimit {
+		return "", fmt.Errorf("the custom_id for %s is %d characters, over the limit of %d", route,
+			len(customId), CustomIDLimit)
+	}
+	return customId, nil
+}
+
+// Decode checks the signature of the state in customId, then decodes it into state
+func (c *StateCodec) Decode(customId string, state interface{}) error {
+
+	split := strings.LastIndex(customId, ":")
+	dot := strings.LastIndex(customId, ".")
+	if split < 0 || dot < split {
+		return fmt.Errorf("custom_id %s has no state", customId)
+	}
+	route, payload, signature := customId[:split], customId[split+1:dot], customId[dot+1:]
+
+	expected, err := c.sign(route, payload)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return ErrTamperedState
+	}
+	body, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return ErrTamperedState
+	}
+	if err = json.Unmarshal(body, state); err != nil {
+		return fmt.Errorf("unable to decode state for %s: %w", route, err)
+	}
+	return nil
+}
+
+// ComponentContext is a button press or select menu choice
+type ComponentContext struct {
+	Interaction discordgo.Interaction
+	Data        discordgo.MessageComponentInteractionData
+	// Route is the prefix of the custom_id the handler was registered for, such as "blep:reroll"
+	Route string
+	codec *StateCodec
+	deferral
+}
+
+// State decodes the state carried in the custom_id, returning ErrTamperedState if it isn't ours
+func (c *ComponentContext) State(state interface{}) error {
+	return c.codec.Decode(c.Data.CustomID, state)
+}
+
+// Values are the choices made in a select menu
+func (c *ComponentContext) Values() []string {
+	return c.Data.Values
+}
+
+// ComponentHandler answers a component interaction, usually with UpdateMessageResponse or MessageResponse
+type ComponentHandler func(ctx *ComponentContext) (*discordgo.InteractionResponse, error)
+
+// HandleComponent registers a handler for components whose custom_id starts with route, such as "blep:reroll"
+func (r *Router) HandleComponent(route string, handler ComponentHandler) {
+	if _, exists := r.components[route]; exists {
+		panic(fmt.Sprintf("a handler is already registered for component %s", route))
+	}
+	r.components[route] = handler
+}
+
+// RouteComponent answers a component interaction with the handler registered for the longest matching prefix of its
+// custom_id. Like RouteCommand it returns nil when a deferred response has already been sent.
+func (r *Router) RouteComponent(interaction discordgo.Interaction) *discordgo.InteractionResponse {
+
+	data := interaction.MessageComponentData()
+	route, found := longestRoute(data.CustomID, func(route string) bool {
+		_, exists := r.components[route]
+		return exists
+	})
+	if !found {
+		logrus.Warnf("No handler for component %s", data.CustomID)
+		return EphemeralResponse("Sorry, that no longer works. Try running the command again.")
+	}
+
+	ctx := &ComponentContext{Interaction: interaction, Data: data, Route: route, codec: r.State}
+	response, err := r.components[route](ctx)
+	if err == nil && response == nil {
+		err = fmt.Errorf("no response")
+	}
+	if errors.Is(err, ErrTamperedState) {
+		logrus.Warnf("Rejected component %s: %s", data.CustomID, err.Error())
+		return EphemeralResponse("Sorry, that no longer works. Try running the command again.")
+	} else if err != nil {
+		logrus.Errorf("Handler for component %s failed: %s", route, err.Error())
+		return EphemeralResponse("Sorry, something went wrong.")
+	}
+	return r.finishDeferred(interaction, "component "+route, response, &ctx.deferral)
+}
+
+// longestRoute finds the longest prefix of customId, split on colons, that a handler is registered for
+func longestRoute(customId string, registered func(route string) bool) (string, bool) {
+	segments := strings.Split(customId, ":")
+	for i := len(segments); i > 0; i-- {
+		if route := strings.Join(segments[:i], ":"); registered(route) {
+			return route, true
+		}
+	}
+	return "", false
+}
+
+// UpdateMessageResponse edits the message the component is on
+func UpdateMessageResponse(data *discordgo.InteractionResponseData) *discordgo.InteractionResponse {
+	return &discordgo.InteractionResponse{Type: discordgo.InteractionResponseUpdateMessage, Data: data}
+}
+
+// MessageResponse sends a new message, leaving the one the component is on as it was
+func MessageResponse(data *discordgo.InteractionResponseData) *discordgo.InteractionResponse {
+	return &discordgo.InteractionResponse{Type: discordgo.InteractionResponseChannelMessageWithSource, Data: data}
+}
+
+// customIdKey is kept for the life of the Lambda container, so it is only fetched once
+var customIdKey []byte
+
+// GetCustomIDKey fetches the key custom_id state is signed with from SecretsManager.
+// Like GetDiscordPublicKey this has pricing implications, which is why the key is kept once fetched.
+func GetCustomIDKey() ([]byte, error) {
+
+	if customIdKey != nil {
+		return customIdKey, nil
+	}
+	logrus.Debug("Attempting to retrieve the custom_id key from SecretsManager")
+
+	cfg, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	cfg.Region = os.Getenv("SECRET_REGION")
+	secretName := os.Getenv("CUSTOM_ID_KEY_SECRET_NAME")
+	client := secretsmanager.NewFromConfig(cfg)
+
+	svOut, err := client.GetSecretValue(context.Background(), &secretsmanager.GetSecretValueInput{SecretId: &secretName})
+	if err != nil {
+		logrus.Error("Failed to retrieve the custom_id key from SecretsManager: " + err.Error())
+		return nil, err
+	}
+	customIdKey = []byte(*svOut.SecretString)
+	return customIdKey, nil
+}
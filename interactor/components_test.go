@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"github.com/bwmarrin/discordgo"
+	"strings"
+	"testing"
+)
+
+func testStateCodec() *StateCodec {
+	return NewStateCodec(func() ([]byte, error) { return []byte("test key"), nil })
+}
+
+type rerollState struct {
+	Animal string `json:"a"`
+	Count  int    `json:"n"`
+}
+
+func TestStateCodecRoundTrip(t *testing.T) {
+	codec := testStateCodec()
+	customId, err := codec.CustomID("blep:reroll", rerollState{Animal: "animal_cat", Count: 3})
+	if err != nil {
+		t.Fatalf("Unable to build custom_id: %s", err.Error())
+	}
+	if !strings.HasPrefix(customId, "blep:reroll:") || len(customId) > CustomIDLimit {
+		t.Errorf("Unexpected custom_id %s", customId)
+	}
+
+	var state rerollState
+	if err = codec.Decode(customId, &state); err != nil || state.Animal != "animal_cat" || state.Count != 3 {
+		t.Errorf("Expected the state back, got %+v, %v", state, err)
+	}
+
+	if customId, err = codec.CustomID("blep:reroll", nil); err != nil || customId != "blep:reroll" {
+		t.Errorf("Expected no state to leave just the route, got %s, %v", customId, err)
+	}
+}
+
+func TestStateCodecRejectsTampering(t *testing.T) {
+	codec := testStateCodec()
+	customId, _ := codec.CustomID("blep:reroll", rerollState{Animal: "animal_cat"})
+	forged, _ := NewStateCodec(func() ([]byte, error) { return []byte("not our key"), nil }).CustomID(
+		"blep:reroll", rerollState{Animal: "animal_dog"})
+	moved := strings.Replace(customId, "blep:reroll", "blep:share", 1)
+	payload := customId[strings.LastIndex(customId, ":")+1 : strings.LastIndex(customId, ".")]
+	edited := strings.Replace(customId, payload, payload[:len(payload)-1]+"x", 1)
+
+	for name, tampered := range map[string]string{"forged": forged, "moved": moved, "edited": edited} {
+		var state rerollState
+		if err := codec.Decode(tampered, &state); !errors.Is(err, ErrTamperedState) {
+			t.Errorf("Expected %s state to be rejected, got %+v, %v", name, state, err)
+		}
+	}
+}
+
+func TestStateCodecEnforcesLimit(t *testing.T) {
+	_, err := testStateCodec().CustomID("blep:reroll", rerollState{Animal: strings.Repeat("cat", 30)})
+	if err == nil || !strings.Contains(err.Error(), "over the limit of 100") {
+		t.Errorf("Expected the custom_id to be too long, got %v", err)
+	}
+}
+
+func componentInteraction(customId string) discordgo.Interaction {
+	return discordgo.Interaction{Type: discordgo.InteractionMessageComponent,
+		Data: discordgo.MessageComponentInteractionData{CustomID: customId, ComponentType: discordgo.ButtonComponent}}
+}
+
+func TestRouteComponentByPrefix(t *testing.T) {
+	codec := testStateCodec()
+	r := NewRouter(codec)
+	var routes []string
+	r.HandleComponent("blep", func(ctx *ComponentContext) (*discordgo.InteractionResponse, error) {
+		routes = append(routes, ctx.Route)
+		return MessageResponse(&discordgo.InteractionResponseData{Content: "blep"}), nil
+	})
+	r.HandleComponent("blep:reroll", func(ctx *ComponentContext) (*discordgo.InteractionResponse, error) {
+		routes = append(routes, ctx.Route)
+		var state rerollState
+		if err := ctx.State(&state); err != nil {
+			return nil, err
+		}
+		return UpdateMessageResponse(&discordgo.InteractionResponseData{Content: state.Animal}), nil
+	})
+
+	customId, _ := codec.CustomID("blep:reroll", rerollState{Animal: "animal_cat"})
+	response := r.RouteComponent(componentInteraction(customId))
+	if response.Type != discordgo.InteractionResponseUpdateMessage || response.Data.Content != "animal_cat" {
+		t.Errorf("Expected the message to be updated from the state, got %+v", response)
+	}
+	response = r.RouteComponent(componentInteraction("blep:share"))
+	if response.Type != discordgo.InteractionResponseChannelMessageWithSource || response.Data.Content != "blep" {
+		t.Errorf("Expected a new message, got %+v", response)
+	}
+	if strings.Join(routes, ",") != "blep:reroll,blep" {
+		t.Errorf("Expected the longest matching route to win, got %v", routes)
+	}
+
+	// Tampered state and unknown components both get an ephemeral reply
+	for _, customId := range []string{strings.Replace(customId, "blep:reroll", "blep:reroll:x", 1), "boop:again"} {
+		response = r.RouteComponent(componentInteraction(customId))
+		if response.Data.Flags != discordgo.MessageFlagsEphemeral || !strings.Contains(response.Data.Content, "no longer works") {
+			t.Errorf("Expected %s to be rejected, got %+v", customId, response.Data)
+		}
+	}
+}
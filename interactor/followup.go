@@ -0,0 +1,132 @@
+package main
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"github.com/sirupsen/logrus"
+)
+
+// FollowUpClient answers an interaction through its webhook, which works for 15 minutes after the
+// interaction arrived, rather than in the 3 seconds Discord gives the HTTP response
+type FollowUpClient interface {
+	// Respond sends the initial response, instead of returning it from the HTTP request
+	Respond(interaction *discordgo.Interaction, response *discordgo.InteractionResponse) error
+	// EditOriginal replaces the initial response, such as the "thinking" of a deferred response
+	EditOriginal(interaction *discordgo.Interaction, edit *discordgo.WebhookEdit) (*discordgo.Message, error)
+	// FollowUp sends another message after the initial response
+	FollowUp(interaction *discordgo.Interaction, params *discordgo.WebhookParams) (*discordgo.Message, error)
+	// EditFollowUp replaces a message sent with FollowUp
+	EditFollowUp(interaction *discordgo.Interaction, messageId string, edit *discordgo.WebhookEdit) (*discordgo.Message, error)
+}
+
+// webhookClient is the FollowUpClient used in production. Interaction webhooks are authorised
+// by the interaction's token, so no bot token is needed.
+type webhookClient struct {
+	session *discordgo.Session
+}
+
+func NewWebhookClient() (FollowUpClient, error) {
+	session, err := discordgo.New("")
+	if err != nil {
+		return nil, err
+	}
+	return &webhookClient{session: session}, nil
+}
+
+func (c *webhookClient) Respond(interaction *discordgo.Interaction, response *discordgo.InteractionResponse) error {
+	return c.session.InteractionRespond(interaction, response)
+}
+
+func (c *webhookClient) EditOriginal(interaction *discordgo.Interaction, edit *discordgo.WebhookEdit) (*discordgo.Message, error) {
+	return c.session.InteractionResponseEdit(interaction, edit)
+}
+
+func (c *webhookClient) FollowUp(interaction *discordgo.Interaction, params *discordgo.WebhookParams) (*discordgo.Message, error) {
+	return c.session.FollowupMessageCreate(interaction, true, params)
+}
+
+func (c *webhookClient) EditFollowUp(interaction *discordgo.Interaction, messageId string,
+	edit *discordgo.WebhookEdit) (*discordgo.Message, error) {
+	return c.session.FollowupMessageEdit(interaction, messageId, edit)
+}
+
+// Reply finishes a deferred interaction
+type Reply struct {
+	Client      FollowUpClient
+	Interaction *discordgo.Interaction
+}
+
+// EditOriginal replaces the deferred response, or the message a deferred update was for
+func (r *Reply) EditOriginal(edit *discordgo.WebhookEdit) (*discordgo.Message, error) {
+	return r.Client.EditOriginal(r.Interaction, edit)
+}
+
+// FollowUp sends another message after the original response
+func (r *Reply) FollowUp(params *discordgo.WebhookParams) (*discordgo.Message, error) {
+	return r.Client.FollowUp(r.Interaction, params)
+}
+
+// DeferredWork finishes an interaction after the deferred response has been sent
+type DeferredWork func(reply *Reply) error
+
+// deferral holds the work a handler deferred, for the router to run once the handler returns
+type deferral struct {
+	work DeferredWork
+}
+
+// Defer answers with Discord's "thinking" message straight away, then runs work, which should edit the original
+// response with the result. An ephemeral deferral's response and edits are only shown to the user.
+func (d *deferral) Defer(ephemeral bool, work DeferredWork) *discordgo.InteractionResponse {
+	d.work = work
+	response := &discordgo.InteractionResponse{Type: discordgo.InteractionResponseDeferredChannelMessageWithSource}
+	if ephemeral {
+		response.Data = &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral}
+	}
+	return response
+}
+
+// DeferUpdate acknowledges a component straight away without changing its message, then runs work,
+// which can edit the message with EditOriginal
+func (d *deferral) DeferUpdate(work DeferredWork) *discordgo.InteractionResponse {
+	d.work = work
+	return &discordgo.InteractionResponse{Type: discordgo.InteractionResponseDeferredMessageUpdate}
+}
+
+// finishDeferred sends a deferred response through the webhook, so Discord has it in time, then runs the deferred
+// work. It returns nil once the response has been sent, or the response to send over HTTP if that wasn't possible.
+func (r *Router) finishDeferred(interaction discordgo.Interaction, name string, response *discordgo.InteractionResponse,
+	d *deferral) *discordgo.InteractionResponse {
+
+	if d.work == nil {
+		return response
+	}
+	if response.Type != discordgo.InteractionResponseDeferredChannelMessageWithSource &&
+		response.Type != discordgo.InteractionResponseDeferredMessageUpdate {
+		logrus.Errorf("Handler for %s deferred work, but answered with response type %d", name, response.Type)
+		return EphemeralResponse("Sorry, something went wrong.")
+	}
+	if r.FollowUps == nil {
+		logrus.Errorf("Handler for %s deferred its response, but there is no follow-up client", name)
+		return EphemeralResponse("Sorry, something went wrong.")
+	}
+	if err := r.FollowUps.Respond(&interaction, response); err != nil {
+		logrus.Errorf("Unable to send the deferred response for %s: %s", name, err.Error())
+		return EphemeralResponse("Sorry, something went wrong.")
+	}
+
+	if err := d.work(&Reply{Client: r.FollowUps, Interaction: &interaction}); err != nil {
+		logrus.Errorf("Deferred work for %s failed: %s", name, err.Error())
+		content := "Sorry, something went wrong."
+		// A deferred update has no message of its own to edit, and the user should still be told
+		var followUpErr error
+		if response.Type == discordgo.InteractionResponseDeferredMessageUpdate {
+			_, followUpErr = r.FollowUps.FollowUp(&interaction, &discordgo.WebhookParams{Content: content,
+				Flags: discordgo.MessageFlagsEphemeral})
+		} else {
+			_, followUpErr = r.FollowUps.EditOriginal(&interaction, &discordgo.WebhookEdit{Content: &content})
+		}
+		if followUpErr != nil {
+			logrus.Errorf("Unable to tell the user deferred work for %s failed: %s", name, followUpErr.Error())
+		}
+	}
+	return nil
+}
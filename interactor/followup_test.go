@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"strings"
+	"testing"
+)
+
+// fakeFollowUps is an in-memory FollowUpClient, keeping what would have been sent to each interaction
+type fakeFollowUps struct {
+	responses map[string]*discordgo.InteractionResponse
+	originals map[string]*discordgo.WebhookEdit
+	followUps map[string][]*discordgo.Message
+	// respondErr is returned by Respond, as if Discord had refused the deferred response
+	respondErr error
+}
+
+func newFakeFollowUps() *fakeFollowUps {
+	return &fakeFollowUps{responses: make(map[string]*discordgo.InteractionResponse),
+		originals: make(map[string]*discordgo.WebhookEdit), followUps: make(map[string][]*discordgo.Message)}
+}
+
+func (f *fakeFollowUps) Respond(interaction *discordgo.Interaction, response *discordgo.InteractionResponse) error {
+	if f.respondErr != nil {
+		return f.respondErr
+	}
+	if _, exists := f.responses[interaction.ID]; exists {
+		return errors.New("HTTP 400 Bad Request: interaction has already been acknowledged")
+	}
+	f.responses[interaction.ID] = response
+	return nil
+}
+
+func (f *fakeFollowUps) EditOriginal(interaction *discordgo.Interaction, edit *discordgo.WebhookEdit) (*discordgo.Message, error) {
+	if _, exists := f.responses[interaction.ID]; !exists {
+		return nil, errors.New("HTTP 404 Not Found: unknown message")
+	}
+	f.originals[interaction.ID] = edit
+	message := &discordgo.Message{ID: "@original"}
+	if edit.Content != nil {
+		message.Content = *edit.Content
+	}
+	return message, nil
+}
+
+func (f *fakeFollowUps) FollowUp(interaction *discordgo.Interaction, params *discordgo.WebhookParams) (*discordgo.Message, error) {
+	message := &discordgo.Message{ID: fmt.Sprint(len(f.followUps[interaction.ID]) + 1), Content: params.Content,
+		Flags: params.Flags}
+	f.followUps[interaction.ID] = append(f.followUps[interaction.ID], message)
+	return message, nil
+}
+
+func (f *fakeFollowUps) EditFollowUp(interaction *discordgo.Interaction, messageId string,
+	edit *discordgo.WebhookEdit) (*discordgo.Message, error) {
+	for _, message := range f.followUps[interaction.ID] {
+		if message.ID == messageId {
+			if edit.Content != nil {
+				message.Content = *edit.Content
+			}
+			return message, nil
+		}
+	}
+	return nil, errors.New("HTTP 404 Not Found: unknown message")
+}
+
+func TestDeferredCommand(t *testing.T) {
+	followUps := newFakeFollowUps()
+	r := NewRouter(nil)
+	r.FollowUps = followUps
+	r.Handle("blep", func(ctx *CommandContext) (*discordgo.InteractionResponse, error) {
+		return ctx.Defer(true, func(reply *Reply) error {
+			content := "Here's a cat"
+			if _, err := reply.EditOriginal(&discordgo.WebhookEdit{Content: &content}); err != nil {
+				return err
+			}
+			_, err := reply.FollowUp(&discordgo.WebhookParams{Content: "And another"})
+			return err
+		}), nil
+	})
+
+	interaction := testInteraction(t, `{"id": "1", "type": 2, "token": "abc", "data": {"name": "blep", "type": 1}}`)
+	if response := r.RouteCommand(interaction); response != nil {
+		t.Fatalf("Expected the response to have been sent already, got %+v", response)
+	}
+	deferred := followUps.responses["1"]
+	if deferred == nil || deferred.Type != discordgo.InteractionResponseDeferredChannelMessageWithSource ||
+		deferred.Data.Flags != discordgo.MessageFlagsEphemeral {
+		t.Errorf("Expected an ephemeral deferred response, got %+v", deferred)
+	}
+	if original := followUps.originals["1"]; original == nil || *original.Content != "Here's a cat" {
+		t.Errorf("Expected the original response to be edited, got %+v", original)
+	}
+	if len(followUps.followUps["1"]) != 1 || followUps.followUps["1"][0].Content != "And another" {
+		t.Errorf("Expected a follow-up, got %v", followUps.followUps["1"])
+	}
+}
+
+func TestDeferredComponentFailures(t *testing.T) {
+	followUps := newFakeFollowUps()
+	r := NewRouter(testStateCodec())
+	r.FollowUps = followUps
+	r.HandleComponent("blep:reroll", func(ctx *ComponentContext) (*discordgo.InteractionResponse, error) {
+		return ctx.DeferUpdate(func(reply *Reply) error {
+			return errors.New("no animals available")
+		}), nil
+	})
+	r.HandleComponent("blep:share", func(ctx *ComponentContext) (*discordgo.InteractionResponse, error) {
+		ctx.DeferUpdate(func(reply *Reply) error { return nil })
+		return MessageResponse(&discordgo.InteractionResponseData{Content: "blep"}), nil
+	})
+
+	// Failed work after a deferred update is reported in an ephemeral follow-up, since there's no message to edit
+	interaction := componentInteraction("blep:reroll")
+	interaction.ID = "2"
+	if response := r.RouteComponent(interaction); response != nil {
+		t.Fatalf("Expected the response to have been sent already, got %+v", response)
+	}
+	if len(followUps.followUps["2"]) != 1 || followUps.followUps["2"][0].Flags != discordgo.MessageFlagsEphemeral ||
+		strings.Contains(followUps.followUps["2"][0].Content, "animals") {
+		t.Errorf("Expected an ephemeral follow-up about the failure, got %v", followUps.followUps["2"])
+	}
+
+	// Deferring without returning the deferred response is a mistake in the handler
+	interaction = componentInteraction("blep:share")
+	interaction.ID = "3"
+	response := r.RouteComponent(interaction)
+	if response == nil || response.Data.Flags != discordgo.MessageFlagsEphemeral || followUps.responses["3"] != nil {
+		t.Errorf("Expected an ephemeral error without anything sent, got %+v", response)
+	}
+
+	// When the deferred response can't be sent, the work isn't started and the user is told over HTTP
+	followUps.respondErr = errors.New("HTTP 401 Unauthorized")
+	interaction = componentInteraction("blep:reroll")
+	interaction.ID = "4"
+	response = r.RouteComponent(interaction)
+	if response == nil || response.Data.Flags != discordgo.MessageFlagsEphemeral || len(followUps.followUps["4"]) != 0 {
+		t.Errorf("Expected an ephemeral error over HTTP, got %+v", response)
+	}
+}
+
+func TestHandleInteractionAfterDeferring(t *testing.T) {
+	followUps := newFakeFollowUps()
+	saved := router
+	defer func() { router = saved }()
+	router = NewRouter(nil)
+	router.FollowUps = followUps
+	router.Handle("blep", func(ctx *CommandContext) (*discordgo.InteractionResponse, error) {
+		return ctx.Defer(false, func(reply *Reply) error { return nil }), nil
+	})
+
+	response, err := HandleInteraction(testInteraction(t, `{"id": "5", "type": 2, "data": {"name": "blep", "type": 1}}`))
+	if err != nil || response.StatusCode != 204 || len(response.Body) != 0 || followUps.responses["5"] == nil {
+		t.Errorf("Expected no content once the deferred response was sent, got %d %s, %v", response.StatusCode, response.Body, err)
+	}
+}
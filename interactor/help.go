@@ -0,0 +1,267 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"github.com/sirupsen/logrus"
+	"strings"
+)
+
+// manifestJSON is commands.yml as it was deployed, so help always describes the live commands
+//
+//go:embed commands_manifest.json
+var manifestJSON []byte
+
+// helpColor is the colour of the bar down the side of help embeds
+const helpColor = 0x5865f2
+
+// CommandManifest is the commands deployed from commands.yml, as written by slash_commands export
+type CommandManifest struct {
+	Commands []*discordgo.ApplicationCommand `json:"Commands"`
+	Guilds   []*ManifestGuild                `json:"Guilds"`
+}
+
+// ManifestGuild is a group of commands only deployed to the listed guilds
+type ManifestGuild struct {
+	GuildIds []string                        `json:"GuildIds"`
+	Commands []*discordgo.ApplicationCommand `json:"Commands"`
+}
+
+func LoadManifest(body []byte) (*CommandManifest, error) {
+	var manifest CommandManifest
+	if err := json.Unmarshal(body, &manifest); err != nil {
+		return nil, fmt.Errorf("unable to parse the command manifest: %w", err)
+	}
+	return &manifest, nil
+}
+
+// CommandsIn lists the commands that can be used in a guild, or in DMs when guildId is empty
+func (m *CommandManifest) CommandsIn(guildId string) []*discordgo.ApplicationCommand {
+	commands := append([]*discordgo.ApplicationCommand{}, m.Commands...)
+	if len(guildId) == 0 {
+		return commands
+	}
+	for _, group := range m.Guilds {
+		for _, id := range group.GuildIds {
+			if id == guildId {
+				commands = append(commands, group.Commands...)
+			}
+		}
+	}
+	return commands
+}
+
+// Find looks up a command, or a subcommand by its path such as "game settings timeout".
+// A leading slash is ignored. Guild commands come first, since they are the ones being tried out.
+func (m *CommandManifest) Find(guildId string, path string) (*discordgo.ApplicationCommand, []*discordgo.ApplicationCommandOption) {
+
+	names := strings.Fields(strings.TrimPrefix(strings.TrimSpace(path), "/"))
+	if len(names) == 0 {
+		return nil, nil
+	}
+	commands := m.CommandsIn(guildId)
+	for i := len(commands) - 1; i >= 0; i-- {
+		command := commands[i]
+		// Context menu commands can have spaces in their names
+		if command.Type != discordgo.ChatApplicationCommand {
+			if strings.EqualFold(command.Name, strings.Join(names, " ")) {
+				return command, nil
+			}
+			continue
+		}
+		if !strings.EqualFold(command.Name, names[0]) {
+			continue
+		}
+
+		var trail []*discordgo.ApplicationCommandOption
+		options := command.Options
+		for _, name := range names[1:] {
+			var found *discordgo.ApplicationCommandOption
+			for _, option := range options {
+				if isSubcommand(option) && strings.EqualFold(option.Name, name) {
+					found = option
+				}
+			}
+			if found == nil {
+				return nil, nil
+			}
+			trail = append(trail, found)
+			options = found.Options
+		}
+		return command, trail
+	}
+	return nil, nil
+}
+
+func isSubcommand(option *discordgo.ApplicationCommandOption) bool {
+	return option.Type == discordgo.ApplicationCommandOptionSubCommand ||
+		option.Type == discordgo.ApplicationCommandOptionSubCommandGroup
+}
+
+// HelpResponse answers /help, listing every command, or describing the one named in the options
+func HelpResponse(manifest *CommandManifest, guildId string, options *HelpOptions) *discordgo.InteractionResponse {
+
+	var embed *discordgo.MessageEmbed
+	if options.Command == nil || len(strings.TrimSpace(*options.Command)) == 0 {
+		embed = helpList(manifest.CommandsIn(guildId))
+	} else if command, trail := manifest.Find(guildId, *options.Command); command != nil {
+		embed = helpCommand(command, trail)
+	} else {
+		embed = &discordgo.MessageEmbed{
+			Title:       "Unknown command",
+			Description: fmt.Sprintf("There's no command called %s. Use /help to list them all.", *options.Command),
+			Color:       helpColor,
+		}
+	}
+
+	return &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{embed},
+			Flags:  discordgo.MessageFlagsEphemeral,
+		},
+	}
+}
+
+// helpList lists slash commands in the description, and context menu commands in a field of their own
+func helpList(commands []*discordgo.ApplicationCommand) *discordgo.MessageEmbed {
+
+	var slash, menu []string
+	for _, command := range commands {
+		switch command.Type {
+		case discordgo.UserApplicationCommand:
+			menu = append(menu, fmt.Sprintf("**%s**: right-click a user, then Apps", command.Name))
+		case discordgo.MessageApplicationCommand:
+			menu = append(menu, fmt.Sprintf("**%s**: right-click a message, then Apps", command.Name))
+		default:
+			slash = append(slash, fmt.Sprintf("`/%s`: %s", command.Name, command.Description))
+		}
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       "saluki commands",
+		Description: strings.Join(slash, "\n"),
+		Color:       helpColor,
+		Footer:      &discordgo.MessageEmbedFooter{Text: "Use /help command:<name> to find out more about one"},
+	}
+	if len(menu) > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Apps menu", Value: strings.Join(menu, "\n")})
+	}
+	return embed
+}
+
+// helpCommand describes a command, or the last subcommand in trail, with its options or subcommands
+func helpCommand(command *discordgo.ApplicationCommand, trail []*discordgo.ApplicationCommandOption) *discordgo.MessageEmbed {
+
+	if command.Type != discordgo.ChatApplicationCommand {
+		where := "a user"
+		if command.Type == discordgo.MessageApplicationCommand {
+			where = "a message"
+		}
+		return &discordgo.MessageEmbed{
+			Title:       command.Name,
+			Description: fmt.Sprintf("Right-click %s, then pick **%s** under Apps.", where, command.Name),
+			Color:       helpColor,
+		}
+	}
+
+	path := "/" + command.Name
+	description := command.Description
+	options := command.Options
+	for _, option := range trail {
+		path += " " + option.Name
+		description = option.Description
+		options = option.Options
+	}
+
+	embed := &discordgo.MessageEmbed{Title: path, Description: description, Color: helpColor}
+	var subcommands []string
+	for _, option := range options {
+		if isSubcommand(option) {
+			subcommands = append(subcommands, fmt.Sprintf("`%s %s`: %s", path, option.Name, option.Description))
+			continue
+		}
+		// Discord allows at most 25 fields, which is also the most options a command can have
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  helpOptionName(option),
+			Value: helpOptionValue(option),
+		})
+	}
+	if len(subcommands) > 0 {
+		embed.Description += "\n\n" + strings.Join(subcommands, "\n")
+	}
+	if len(embed.Fields) == 0 && len(subcommands) == 0 {
+		embed.Footer = &discordgo.MessageEmbedFooter{Text: "This command has no options"}
+	}
+	return embed
+}
+
+func helpOptionName(option *discordgo.ApplicationCommandOption) string {
+	required := "optional"
+	if option.Required {
+		required = "required"
+	}
+	return fmt.Sprintf("%s (%s, %s)", option.Name, strings.ToLower(option.Type.String()), required)
+}
+
+func helpOptionValue(option *discordgo.ApplicationCommandOption) string {
+	value := option.Description
+	if len(option.Choices) > 0 {
+		var choices []string
+		for _, choice := range option.Choices {
+			choices = append(choices, choice.Name)
+		}
+		value += "\nOne of: " + strings.Join(choices, ", ")
+	}
+	return value
+}
+
+// helpHandler answers /help from the embedded manifest
+func helpHandler(ctx *CommandContext) (*discordgo.InteractionResponse, error) {
+
+	options, err := ParseHelpOptions(ctx.Data)
+	var manifest *CommandManifest
+	if err == nil {
+		manifest, err = LoadManifest(manifestJSON)
+	}
+	if err != nil {
+		logrus.Error("Unable to answer /help: " + err.Error())
+		return EphemeralResponse("Sorry, help isn't available right now."), nil
+	}
+	return HelpResponse(manifest, ctx.Interaction.GuildID, options), nil
+}
+
+// helpAutocomplete suggests commands, and the paths of their subcommands, for /help command
+func helpAutocomplete(ctx *AutocompleteContext) ([]*discordgo.ApplicationCommandOptionChoice, error) {
+
+	manifest, err := LoadManifest(manifestJSON)
+	if err != nil {
+		return nil, err
+	}
+	return MatchChoices(ctx.Typed(), HelpChoices(manifest, ctx.Interaction.GuildID)), nil
+}
+
+// HelpChoices lists everything /help can explain in a guild, as choices of /help command
+func HelpChoices(manifest *CommandManifest, guildId string) []*discordgo.ApplicationCommandOptionChoice {
+
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	var add func(path string, options []*discordgo.ApplicationCommandOption)
+	add = func(path string, options []*discordgo.ApplicationCommandOption) {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: path, Value: path})
+		for _, option := range options {
+			if isSubcommand(option) {
+				add(path+" "+option.Name, option.Options)
+			}
+		}
+	}
+	for _, command := range manifest.CommandsIn(guildId) {
+		if command.Type == discordgo.ChatApplicationCommand {
+			add(command.Name, command.Options)
+		} else {
+			choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: command.Name, Value: command.Name})
+		}
+	}
+	return choices
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/bwmarrin/discordgo"
+	"strings"
+	"testing"
+)
+
+const testManifest = `{
+  "Commands": [
+    {"type": 1, "name": "help", "description": "List saluki's commands, or explain one of them"},
+    {"type": 1, "name": "game", "description": "Run a game", "options": [
+      {"type": 1, "name": "start", "description": "Start a game in this channel", "options": [
+        {"type": 3, "name": "mode", "description": "What kind of game to play", "required": true,
+         "choices": [{"name": "Classic", "value": "classic"}, {"name": "Speed run", "value": "speed_run"}]}
+      ]},
+      {"type": 2, "name": "settings", "description": "Change how games are run", "options": [
+        {"type": 1, "name": "timeout", "description": "Set how long a turn can last"}
+      ]}
+    ]},
+    {"type": 2, "name": "Challenge"}
+  ],
+  "Guilds": [
+    {"GuildIds": ["123456789012345678"], "Commands": [
+      {"type": 1, "name": "lockdown", "description": "Stop anyone but moderators from starting games"}
+    ]}
+  ]
+}`
+
+func helpEmbed(t *testing.T, guildId string, command string) *discordgo.MessageEmbed {
+	manifest, err := LoadManifest([]byte(testManifest))
+	if err != nil {
+		t.Fatalf("Unable to load manifest: %s", err.Error())
+	}
+	options := &HelpOptions{}
+	if len(command) > 0 {
+		options.Command = &command
+	}
+	response := HelpResponse(manifest, guildId, options)
+	if response.Data.Flags != discordgo.MessageFlagsEphemeral || len(response.Data.Embeds) != 1 {
+		t.Fatalf("Expected a single ephemeral embed, got %+v", response.Data)
+	}
+	return response.Data.Embeds[0]
+}
+
+func TestHelpListsCommands(t *testing.T) {
+	embed := helpEmbed(t, "", "")
+	if !strings.Contains(embed.Description, "`/game`: Run a game") || strings.Contains(embed.Description, "lockdown") {
+		t.Errorf("Expected the global slash commands, got:\n%s", embed.Description)
+	}
+	if len(embed.Fields) != 1 || !strings.Contains(embed.Fields[0].Value, "**Challenge**: right-click a user") {
+		t.Errorf("Expected context menu commands in a field of their own, got %+v", embed.Fields)
+	}
+
+	// Guild commands are only listed in their guilds
+	if embed = helpEmbed(t, "123456789012345678", ""); !strings.Contains(embed.Description, "`/lockdown`") {
+		t.Errorf("Expected the guild's commands too, got:\n%s", embed.Description)
+	}
+}
+
+func TestHelpDescribesCommand(t *testing.T) {
+	embed := helpEmbed(t, "", "/game start")
+	if embed.Title != "/game start" || embed.Description != "Start a game in this channel" || len(embed.Fields) != 1 {
+		t.Fatalf("Expected /game start with its option, got %+v", embed)
+	}
+	if embed.Fields[0].Name != "mode (string, required)" || !strings.HasSuffix(embed.Fields[0].Value, "One of: Classic, Speed run") {
+		t.Errorf("Unexpected option: %+v", embed.Fields[0])
+	}
+
+	// Commands with subcommands list them instead
+	embed = helpEmbed(t, "", "game")
+	if !strings.Contains(embed.Description, "`/game start`: Start a game in this channel") ||
+		!strings.Contains(embed.Description, "`/game settings`: Change how games are run") {
+		t.Errorf("Expected the subcommands of /game, got:\n%s", embed.Description)
+	}
+	if embed = helpEmbed(t, "", "game settings timeout"); embed.Title != "/game settings timeout" {
+		t.Errorf("Expected subcommands in groups to be found, got %s", embed.Title)
+	}
+	if embed = helpEmbed(t, "", "challenge"); embed.Title != "Challenge" || !strings.Contains(embed.Description, "Right-click a user") {
+		t.Errorf("Expected the user command, got %+v", embed)
+	}
+}
+
+func TestHelpUnknownCommand(t *testing.T) {
+	for _, command := range []string{"lockdown", "game stop", "blep"} {
+		if embed := helpEmbed(t, "", command); embed.Title != "Unknown command" {
+			t.Errorf("Expected %s to be unknown outside its guild, got %s", command, embed.Title)
+		}
+	}
+}
+
+func TestHandleInteractionAnswersHelp(t *testing.T) {
+	var interaction discordgo.Interaction
+	body := `{"type": 2, "data": {"name": "help", "type": 1, "options": [{"name": "command", "type": 3, "value": "blep"}]}}`
+	if err := json.Unmarshal([]byte(body), &interaction); err != nil {
+		t.Fatalf("Unable to decode interaction: %s", err.Error())
+	}
+
+	response, err := HandleInteraction(interaction)
+	if err != nil || response.StatusCode != 200 {
+		t.Fatalf("Expected a response, got %d: %v", response.StatusCode, err)
+	}
+	var decoded discordgo.InteractionResponse
+	if err = json.Unmarshal([]byte(response.Body), &decoded); err != nil {
+		t.Fatalf("Unable to decode response: %s", err.Error())
+	}
+	// The embedded manifest is the real commands.yml
+	if decoded.Type != discordgo.InteractionResponseChannelMessageWithSource || decoded.Data.Embeds[0].Title != "/blep" {
+		t.Errorf("Expected help for /blep, got %s", response.Body)
+	}
+}
@@ -17,6 +17,24 @@ import (
 	"os"
 )
 
+//go:generate go run ../slash_commands generate -log-level warn -output commands_gen.go
+//go:generate go run ../slash_commands export -log-level warn -env= -format json -output commands_manifest.json
+
+// router holds the handler of every command, component and modal saluki answers itself
+var router = newRouter()
+
+func newRouter() *Router {
+	r := NewRouter(NewStateCodec(GetCustomIDKey))
+	followUps, err := NewWebhookClient()
+	if err != nil {
+		logrus.Error("Unable to create the follow-up client, so responses can't be deferred: " + err.Error())
+	}
+	r.FollowUps = followUps
+	r.Handle("help", helpHandler)
+	r.HandleAutocomplete("help", "command", helpAutocomplete)
+	return r
+}
+
 // Handler is executed by AWS Lambda in the main function. Once the request
 // is processed, it returns an Amazon API Gateway response object to AWS Lambda
 func Handler(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
@@ -103,13 +121,32 @@ func GetDiscordPublicKey() (ed25519.PublicKey, error) {
 
 func HandleInteraction(interaction discordgo.Interaction) (events.APIGatewayProxyResponse, error) {
 
-	var response discordgo.InteractionResponse
-	status := 200
+	response := &discordgo.InteractionResponse{}
 
 	if interaction.Type == discordgo.InteractionPing {
 		response.Type = discordgo.InteractionResponsePong
+	} else if interaction.Type == discordgo.InteractionApplicationCommand {
+		response = router.RouteCommand(interaction)
+	} else if interaction.Type == discordgo.InteractionMessageComponent {
+		response = router.RouteComponent(interaction)
+	} else if interaction.Type == discordgo.InteractionModalSubmit {
+		response = router.RouteModal(interaction)
+	} else if interaction.Type == discordgo.InteractionApplicationCommandAutocomplete {
+		return jsonResponse(router.RouteAutocomplete(interaction)), nil
 	}
 
+	// A deferred response has already been sent through the interaction's webhook, so there is nothing left to say
+	if response == nil {
+		logrus.Debug("Response was sent through the follow-up client")
+		return events.APIGatewayProxyResponse{StatusCode: 204}, nil
+	}
+	return jsonResponse(response), nil
+}
+
+// jsonResponse marshals an interaction response into the body of a response to API Gateway
+func jsonResponse(response interface{}) events.APIGatewayProxyResponse {
+
+	status := 200
 	bodyBytes, err := json.Marshal(response)
 	body := string(bodyBytes)
 
@@ -126,7 +163,7 @@ func HandleInteraction(interaction discordgo.Interaction) (events.APIGatewayProx
 		Headers: map[string]string{
 			"Content-Type": "application/json",
 		},
-	}, nil
+	}
 }
 
 func main() {
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"github.com/sirupsen/logrus"
+	"strings"
+	"unicode/utf8"
+)
+
+// Discord's limits on modals
+const (
+	ModalTitleLimit  = 45
+	ModalInputLimit  = 5
+	InputLabelLimit  = 45
+	InputLengthLimit = 4000
+)
+
+// Modal is a form of text inputs. Route is the prefix of its custom_id, which is also how submissions are routed.
+type Modal struct {
+	Route  string
+	Title  string
+	Inputs []*discordgo.TextInput
+}
+
+// Check makes sure the modal is within Discord's limits, since Discord only says the response was invalid
+func (m *Modal) Check() error {
+
+	var problems []string
+	if title := utf8.RuneCountInString(m.Title); title == 0 || title > ModalTitleLimit {
+		problems = append(problems, fmt.Sprintf("the title must be 1-%d characters", ModalTitleLimit))
+	}
+	if len(m.Inputs) == 0 || len(m.Inputs) > ModalInputLimit {
+		problems = append(problems, fmt.Sprintf("there must be 1-%d inputs", ModalInputLimit))
+	}
+	seen := make(map[string]struct{})
+	for _, input := range m.Inputs {
+		if _, exists := seen[input.CustomID]; exists || len(input.CustomID) == 0 {
+			problems = append(problems, fmt.Sprintf("input %q needs a custom_id of its own", input.Label))
+		}
+		seen[input.CustomID] = struct{}{}
+		if label := utf8.RuneCountInString(input.Label); label == 0 || label > InputLabelLimit {
+			problems = append(problems, fmt.Sprintf("the label of %s must be 1-%d characters", input.CustomID, InputLabelLimit))
+		}
+		if input.MaxLength > InputLengthLimit || input.MinLength > InputLengthLimit ||
+			(input.MaxLength > 0 && input.MinLength > input.MaxLength) {
+			problems = append(problems, fmt.Sprintf("the lengths of %s must be within 0-%d, with the minimum no more than the maximum",
+				input.CustomID, InputLengthLimit))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("modal %s is invalid: %s", m.Route, strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// Response opens the modal from a command or component handler. State is carried in its custom_id like a component's.
+func (m *Modal) Response(codec *StateCodec, state interface{}) (*discordgo.InteractionResponse, error) {
+
+	if err := m.Check(); err != nil {
+		return nil, err
+	}
+	customId := m.Route
+	if state != nil {
+		var err error
+		if customId, err = codec.CustomID(m.Route, state); err != nil {
+			return nil, err
+		}
+	}
+
+	var rows []discordgo.MessageComponent
+	for _, input := range m.Inputs {
+		if input.Style == 0 {
+			input.Style = discordgo.TextInputShort
+		}
+		rows = append(rows, discordgo.ActionsRow{Components: []discordgo.MessageComponent{input}})
+	}
+	return &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseModal,
+		Data: &discordgo.InteractionResponseData{CustomID: customId, Title: m.Title, Components: rows},
+	}, nil
+}
+
+// ModalValues are the values of a submitted modal's text inputs, by custom_id
+type ModalValues map[string]string
+
+// Get returns the value of an input, or nil if an optional input was left empty
+func (v ModalValues) Get(id string) *string {
+	if value, exists := v[id]; exists && len(value) > 0 {
+		return &value
+	}
+	return nil
+}
+
+// ModalValidationError lists the inputs of a submission that aren't valid
+type ModalValidationError struct {
+	Problems []string
+}
+
+func (e *ModalValidationError) Error() string {
+	return strings.Join(e.Problems, "\n")
+}
+
+// Values extracts the text inputs of a submission, checking each against the modal. Discord checks
+// these in the client as well, but a submission can come from anywhere.
+func (m *Modal) Values(data discordgo.ModalSubmitInteractionData) (ModalValues, error) {
+
+	submitted := make(map[string]string)
+	var collect func(components []discordgo.MessageComponent)
+	collect = func(components []discordgo.MessageComponent) {
+		for _, component := range components {
+			switch c := component.(type) {
+			case *discordgo.ActionsRow:
+				collect(c.Components)
+			case *discordgo.TextInput:
+				submitted[c.CustomID] = c.Value
+			}
+		}
+	}
+	collect(data.Components)
+
+	values := make(ModalValues)
+	var problems []string
+	for _, input := range m.Inputs {
+		value := strings.TrimSpace(submitted[input.CustomID])
+		length := utf8.RuneCountInString(value)
+		if length == 0 {
+			if input.Required {
+				problems = append(problems, fmt.Sprintf("%s is required", input.Label))
+			}
+		} else if input.MinLength > 0 && length < input.MinLength {
+			problems = append(problems, fmt.Sprintf("%s must be at least %d characters", input.Label, input.MinLength))
+		} else if limit := input.MaxLength; (limit > 0 && length > limit) || length > InputLengthLimit {
+			if limit == 0 {
+				limit = InputLengthLimit
+			}
+			problems = append(problems, fmt.Sprintf("%s must be at most %d characters", input.Label, limit))
+		}
+		values[input.CustomID] = value
+	}
+	if len(problems) > 0 {
+		return nil, &ModalValidationError{Problems: problems}
+	}
+	return values, nil
+}
+
+// ModalContext is a submitted modal, with its inputs already checked
+type ModalContext struct {
+	Interaction discordgo.Interaction
+	Data        discordgo.ModalSubmitInteractionData
+	Route       string
+	Values      ModalValues
+	codec       *StateCodec
+	deferral
+}
+
+// State decodes the state carried in the custom_id, returning ErrTamperedState if it isn't ours
+func (c *ModalContext) State(state interface{}) error {
+	return c.codec.Decode(c.Data.CustomID, state)
+}
+
+// ModalHandler answers a modal submission
+type ModalHandler func(ctx *ModalContext) (*discordgo.InteractionResponse, error)
+
+type modalRoute struct {
+	modal   *Modal
+	handler ModalHandler
+}
+
+// HandleModal registers a handler for submissions of modal. It panics if the modal is over Discord's limits.
+func (r *Router) HandleModal(modal *Modal, handler ModalHandler) {
+	if err := modal.Check(); err != nil {
+		panic(err.Error())
+	}
+	if _, exists := r.modals[modal.Route]; exists {
+		panic(fmt.Sprintf("a handler is already registered for modal %s", modal.Route))
+	}
+	r.modals[modal.Route] = &modalRoute{modal: modal, handler: handler}
+}
+
+// RouteModal answers a modal submission with the handler registered for its custom_id.
+// Like RouteCommand it returns nil when a deferred response has already been sent.
+func (r *Router) RouteModal(interaction discordgo.Interaction) *discordgo.InteractionResponse {
+
+	data := interaction.ModalSubmitData()
+	route, found := longestRoute(data.CustomID, func(route string) bool {
+		_, exists := r.modals[route]
+		return exists
+	})
+	if !found {
+		logrus.Warnf("No handler for modal %s", data.CustomID)
+		return EphemeralResponse("Sorry, that form no longer works. Try running the command again.")
+	}
+	registered := r.modals[route]
+
+	values, err := registered.modal.Values(data)
+	var invalid *ModalValidationError
+	if errors.As(err, &invalid) {
+		return EphemeralResponse("That form wasn't filled in right:\n" + invalid.Error())
+	}
+
+	ctx := &ModalContext{Interaction: interaction, Data: data, Route: route, Values: values, codec: r.State}
+	response, err := registered.handler(ctx)
+	if err == nil && response == nil {
+		err = fmt.Errorf("no response")
+	}
+	if errors.Is(err, ErrTamperedState) {
+		logrus.Warnf("Rejected modal %s: %s", data.CustomID, err.Error())
+		return EphemeralResponse("Sorry, that form no longer works. Try running the command again.")
+	} else if err != nil {
+		logrus.Errorf("Handler for modal %s failed: %s", route, err.Error())
+		return EphemeralResponse("Sorry, something went wrong.")
+	}
+	return r.finishDeferred(interaction, "modal "+route, response, &ctx.deferral)
+}
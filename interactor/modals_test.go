@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/bwmarrin/discordgo"
+	"strings"
+	"testing"
+)
+
+func testReportModal() *Modal {
+	return &Modal{Route: "report", Title: "Report an issue", Inputs: []*discordgo.TextInput{
+		{CustomID: "summary", Label: "What went wrong?", Required: true, MinLength: 5, MaxLength: 100},
+		{CustomID: "details", Label: "Anything else?", Style: discordgo.TextInputParagraph, MaxLength: 1000},
+	}}
+}
+
+func modalInteraction(t *testing.T, customId string, values map[string]string) discordgo.Interaction {
+	var rows []string
+	for id, value := range values {
+		rows = append(rows, `{"type": 1, "components": [{"type": 4, "custom_id": "`+id+`", "value": "`+value+`"}]}`)
+	}
+	return testInteraction(t, `{"type": 5, "data": {"custom_id": "`+customId+`", "components": [`+strings.Join(rows, ",")+`]}}`)
+}
+
+func TestModalResponse(t *testing.T) {
+	codec := testStateCodec()
+	response, err := testReportModal().Response(codec, rerollState{Animal: "animal_cat"})
+	if err != nil {
+		t.Fatalf("Unable to open the modal: %s", err.Error())
+	}
+	if response.Type != discordgo.InteractionResponseModal || response.Data.Title != "Report an issue" ||
+		!strings.HasPrefix(response.Data.CustomID, "report:") || len(response.Data.Components) != 2 {
+		t.Errorf("Unexpected modal %+v", response.Data)
+	}
+	body, _ := json.Marshal(response)
+	if !strings.Contains(string(body), `"style":1`) {
+		t.Errorf("Expected inputs to default to the short style, got %s", body)
+	}
+
+	tooMany := &Modal{Route: "setup", Title: strings.Repeat("Game setup ", 5)}
+	for i := 0; i < 6; i++ {
+		tooMany.Inputs = append(tooMany.Inputs, &discordgo.TextInput{CustomID: "same", Label: "Setting", MinLength: 10, MaxLength: 5})
+	}
+	err = tooMany.Check()
+	for _, problem := range []string{"title", "1-5 inputs", "custom_id of its own", "minimum"} {
+		if err == nil || !strings.Contains(err.Error(), problem) {
+			t.Errorf("Expected the modal to be rejected for %s, got %v", problem, err)
+		}
+	}
+}
+
+func TestRouteModal(t *testing.T) {
+	codec := testStateCodec()
+	r := NewRouter(codec)
+	var submitted *ModalContext
+	r.HandleModal(testReportModal(), func(ctx *ModalContext) (*discordgo.InteractionResponse, error) {
+		submitted = ctx
+		var state rerollState
+		if err := ctx.State(&state); err != nil {
+			return nil, err
+		}
+		return EphemeralResponse("Thanks for reporting " + *ctx.Values.Get("summary") + " with " + state.Animal), nil
+	})
+
+	open, _ := testReportModal().Response(codec, rerollState{Animal: "animal_cat"})
+	response := r.RouteModal(modalInteraction(t, open.Data.CustomID, map[string]string{"summary": " No cats "}))
+	if response.Data.Content != "Thanks for reporting No cats with animal_cat" {
+		t.Errorf("Unexpected response %+v", response.Data)
+	}
+	if submitted == nil || submitted.Values.Get("details") != nil {
+		t.Errorf("Expected details to be left out, got %+v", submitted)
+	}
+
+	for problem, values := range map[string]map[string]string{
+		"What went wrong? is required":                    {"details": "Nothing"},
+		"What went wrong? must be at least 5 characters":  {"summary": "cat"},
+		"What went wrong? must be at most 100 characters": {"summary": strings.Repeat("cat", 34)},
+	} {
+		response = r.RouteModal(modalInteraction(t, open.Data.CustomID, values))
+		if response.Data.Flags != discordgo.MessageFlagsEphemeral || !strings.Contains(response.Data.Content, problem) {
+			t.Errorf("Expected %q, got %+v", problem, response.Data)
+		}
+	}
+
+	response = r.RouteModal(modalInteraction(t, "setup", map[string]string{}))
+	if !strings.Contains(response.Data.Content, "no longer works") {
+		t.Errorf("Expected an unknown modal to be rejected, got %+v", response.Data)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"github.com/sirupsen/logrus"
+	"strings"
+)
+
+// CommandContext is a command interaction, with the subcommand that was used already picked out
+type CommandContext struct {
+	Interaction discordgo.Interaction
+	Data        discordgo.ApplicationCommandInteractionData
+	// Path is the command and subcommands used, such as "permissions guild set", or the name of a context menu command
+	Path string
+	// Options are the options given to the subcommand that was used, by name
+	Options  map[string]*discordgo.ApplicationCommandInteractionDataOption
+	deferral deferral
+}
+
+// Defer answers with Discord's "thinking" message straight away, then runs work to finish the command
+func (c *CommandContext) Defer(ephemeral bool, work DeferredWork) *discordgo.InteractionResponse {
+	return c.deferral.Defer(ephemeral, work)
+}
+
+// Option returns the named option, or nil if it wasn't given
+func (c *CommandContext) Option(name string) *discordgo.ApplicationCommandInteractionDataOption {
+	return c.Options[name]
+}
+
+// CommandHandler answers a command. An error is logged, and the user told something went wrong.
+type CommandHandler func(ctx *CommandContext) (*discordgo.InteractionResponse, error)
+
+// Router sends each interaction to the handler registered for it
+type Router struct {
+	commands     map[string]CommandHandler
+	components   map[string]ComponentHandler
+	modals       map[string]*modalRoute
+	autocomplete map[string]AutocompleteHandler
+	// State signs the state component handlers keep in custom IDs
+	State *StateCodec
+	// FollowUps finishes interactions handlers have deferred
+	FollowUps FollowUpClient
+}
+
+func NewRouter(state *StateCodec) *Router {
+	return &Router{commands: make(map[string]CommandHandler), components: make(map[string]ComponentHandler),
+		modals: make(map[string]*modalRoute), autocomplete: make(map[string]AutocompleteHandler), State: state}
+}
+
+func routeKey(commandType discordgo.ApplicationCommandType, path string) string {
+	return fmt.Sprintf("%d:%s", commandType, path)
+}
+
+func (r *Router) register(commandType discordgo.ApplicationCommandType, path string, handler CommandHandler) {
+	key := routeKey(commandType, path)
+	if _, exists := r.commands[key]; exists {
+		panic(fmt.Sprintf("a handler is already registered for %s", path))
+	}
+	r.commands[key] = handler
+}
+
+// Handle registers a handler for a chat input command, or one of its subcommands such as "permissions guild set".
+// Commands with subcommands are routed by the full path, so each subcommand needs a handler of its own.
+func (r *Router) Handle(path string, handler CommandHandler) {
+	r.register(discordgo.ChatApplicationCommand, strings.Join(strings.Fields(path), " "), handler)
+}
+
+// HandleUserCommand registers a handler for the user command with the given name
+func (r *Router) HandleUserCommand(name string, handler CommandHandler) {
+	r.register(discordgo.UserApplicationCommand, name, handler)
+}
+
+// HandleMessageCommand registers a handler for the message command with the given name
+func (r *Router) HandleMessageCommand(name string, handler CommandHandler) {
+	r.register(discordgo.MessageApplicationCommand, name, handler)
+}
+
+// commandPath follows subcommand groups and subcommands down to the options of the one that was used
+func commandPath(data discordgo.ApplicationCommandInteractionData) (string, []*discordgo.ApplicationCommandInteractionDataOption) {
+	path := []string{data.Name}
+	options := data.Options
+	for len(options) == 1 && (options[0].Type == discordgo.ApplicationCommandOptionSubCommand ||
+		options[0].Type == discordgo.ApplicationCommandOptionSubCommandGroup) {
+		path = append(path, options[0].Name)
+		options = options[0].Options
+	}
+	return strings.Join(path, " "), options
+}
+
+// RouteCommand answers a command interaction with its handler. It returns nil when a deferred
+// response has already been sent through the follow-up client.
+func (r *Router) RouteCommand(interaction discordgo.Interaction) *discordgo.InteractionResponse {
+
+	data := interaction.ApplicationCommandData()
+	ctx := &CommandContext{Interaction: interaction, Data: data, Path: data.Name,
+		Options: make(map[string]*discordgo.ApplicationCommandInteractionDataOption)}
+	// Discord leaves the type out of some older payloads, which are always chat input commands
+	commandType := data.CommandType
+	if commandType == 0 {
+		commandType = discordgo.ChatApplicationCommand
+	}
+	if commandType == discordgo.ChatApplicationCommand {
+		var options []*discordgo.ApplicationCommandInteractionDataOption
+		ctx.Path, options = commandPath(data)
+		for _, option := range options {
+			ctx.Options[option.Name] = option
+		}
+	}
+	handler, exists := r.commands[routeKey(commandType, ctx.Path)]
+	if !exists {
+		logrus.Warnf("No handler for %s", ctx.Path)
+		name := ctx.Path
+		if commandType == discordgo.ChatApplicationCommand {
+			name = "/" + name
+		}
+		return EphemeralResponse(fmt.Sprintf("Unknown command %s. It may have been removed, or not be ready yet.", name))
+	}
+
+	response, err := handler(ctx)
+	if err == nil && response == nil {
+		err = fmt.Errorf("no response")
+	}
+	if err != nil {
+		logrus.Errorf("Handler for %s failed: %s", ctx.Path, err.Error())
+		return EphemeralResponse("Sorry, something went wrong running that command.")
+	}
+	return r.finishDeferred(interaction, ctx.Path, response, &ctx.deferral)
+}
+
+// EphemeralResponse is a message only the user who used the command can see
+func EphemeralResponse(content string) *discordgo.InteractionResponse {
+	return &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: content,
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/bwmarrin/discordgo"
+	"strings"
+	"testing"
+)
+
+func testInteraction(t *testing.T, body string) discordgo.Interaction {
+	var interaction discordgo.Interaction
+	if err := json.Unmarshal([]byte(body), &interaction); err != nil {
+		t.Fatalf("Unable to decode interaction: %s", err.Error())
+	}
+	return interaction
+}
+
+func TestRouteCommandFollowsSubcommands(t *testing.T) {
+	r := NewRouter(nil)
+	var routed *CommandContext
+	handler := func(ctx *CommandContext) (*discordgo.InteractionResponse, error) {
+		routed = ctx
+		return EphemeralResponse("done"), nil
+	}
+	r.Handle("permissions guild set", handler)
+	r.Handle("permissions reset", handler)
+
+	response := r.RouteCommand(testInteraction(t, `{"type": 2, "data": {"name": "permissions", "type": 1, "options": [
+		{"name": "guild", "type": 2, "options": [{"name": "set", "type": 1, "options": [
+			{"name": "role", "type": 8, "value": "123456789012345678"}, {"name": "allow", "type": 5, "value": true}]}]}]}}`))
+	if response.Data.Content != "done" || routed == nil || routed.Path != "permissions guild set" {
+		t.Fatalf("Expected permissions guild set to be routed, got %+v", routed)
+	}
+	if len(routed.Options) != 2 || routed.Option("role").Value != "123456789012345678" || routed.Option("allow").Value != true {
+		t.Errorf("Expected the options of the subcommand, got %v", routed.Options)
+	}
+
+	routed = nil
+	r.RouteCommand(testInteraction(t, `{"type": 2, "data": {"name": "permissions", "type": 1, "options": [
+		{"name": "reset", "type": 1}]}}`))
+	if routed == nil || routed.Path != "permissions reset" || len(routed.Options) != 0 {
+		t.Errorf("Expected permissions reset to be routed, got %+v", routed)
+	}
+}
+
+func TestRouteCommandContextMenus(t *testing.T) {
+	r := NewRouter(nil)
+	var paths []string
+	handler := func(name string) CommandHandler {
+		return func(ctx *CommandContext) (*discordgo.InteractionResponse, error) {
+			paths = append(paths, name+":"+ctx.Path)
+			return EphemeralResponse(name), nil
+		}
+	}
+	// A chat command and a context menu command can share a name
+	r.Handle("blep", handler("chat"))
+	r.HandleUserCommand("blep", handler("user"))
+	r.HandleMessageCommand("Report message", handler("message"))
+
+	r.RouteCommand(testInteraction(t, `{"type": 2, "data": {"name": "blep", "type": 2, "target_id": "123456789012345678"}}`))
+	r.RouteCommand(testInteraction(t, `{"type": 2, "data": {"name": "Report message", "type": 3, "target_id": "123456789012345678"}}`))
+	r.RouteCommand(testInteraction(t, `{"type": 2, "data": {"name": "blep", "type": 1}}`))
+	if strings.Join(paths, ",") != "user:blep,message:Report message,chat:blep" {
+		t.Errorf("Expected each command type to be routed to its own handler, got %v", paths)
+	}
+}
+
+func TestRouteCommandUnknown(t *testing.T) {
+	r := NewRouter(nil)
+	r.Handle("permissions guild set", func(ctx *CommandContext) (*discordgo.InteractionResponse, error) {
+		return EphemeralResponse("done"), nil
+	})
+
+	for _, body := range []string{
+		`{"type": 2, "data": {"name": "boop", "type": 1}}`,
+		`{"type": 2, "data": {"name": "permissions", "type": 1, "options": [{"name": "guild", "type": 2, "options": [{"name": "get", "type": 1}]}]}}`,
+		`{"type": 2, "data": {"name": "permissions guild set", "type": 2}}`,
+	} {
+		response := r.RouteCommand(testInteraction(t, body))
+		if response.Data.Flags != discordgo.MessageFlagsEphemeral || !strings.HasPrefix(response.Data.Content, "Unknown command") {
+			t.Errorf("Expected an ephemeral unknown command response to %s, got %+v", body, response.Data)
+		}
+	}
+}
+
+func TestRouteCommandHandlerError(t *testing.T) {
+	r := NewRouter(nil)
+	r.Handle("blep", func(ctx *CommandContext) (*discordgo.InteractionResponse, error) {
+		return nil, errors.New("no animals available")
+	})
+
+	response := r.RouteCommand(testInteraction(t, `{"type": 2, "data": {"name": "blep", "type": 1}}`))
+	if response.Data.Flags != discordgo.MessageFlagsEphemeral || strings.Contains(response.Data.Content, "animals") {
+		t.Errorf("Expected an ephemeral error that doesn't leak the cause, got %+v", response.Data)
+	}
+}
+
+func TestRouterRejectsDuplicateHandlers(t *testing.T) {
+	r := NewRouter(nil)
+	handler := func(ctx *CommandContext) (*discordgo.InteractionResponse, error) { return nil, nil }
+	r.Handle("permissions guild set", handler)
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected registering permissions guild set twice to panic")
+		}
+	}()
+	r.Handle("permissions  guild set", handler)
+}
@@ -0,0 +1,828 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Exit codes, so CI can tell what kind of failure stopped the deployer
+const (
+	ExitOK       = 0
+	ExitError    = 1 // Anything not covered below
+	ExitUsage    = 2 // Unknown subcommand, flag or format
+	ExitInvalid  = 3 // commands.yml could not be loaded, or failed validation
+	ExitDiscord  = 4 // The bot token could not be retrieved, or Discord could not be reached
+	ExitSync     = 5 // Discord rejected a change to the commands, and they were restored to how they were
+	ExitRollback = 6 // Discord rejected a change to the commands, and they could not be restored
+	ExitStale    = 7 // Generated code or the schema is out of date
+	ExitDrift    = 8 // Live commands were changed since the last deploy
+)
+
+const FormatText = "text"
+const FormatJSON = "json"
+const FormatYAML = "yaml"
+
+// cliError carries the exit code a failure should end the deployer with
+type cliError struct {
+	code int
+	err  error
+}
+
+func (e *cliError) Error() string {
+	return e.err.Error()
+}
+
+func exitError(code int, format string, args ...interface{}) error {
+	return &cliError{code: code, err: fmt.Errorf(format, args...)}
+}
+
+// DiscordApi is every Discord call the subcommands make, so tests can stand in for Discord
+type DiscordApi struct {
+	AppId         string
+	Get           AppCmdsGetFn
+	Create        AppCmdCreateFn
+	Edit          AppCmdEditFn
+	Delete        AppCmdDeleteFn
+	BulkOverwrite AppCmdBulkOverwriteFn
+}
+
+// connectDiscord sets up a client for the saluki bot. The returned function cleans up after it.
+var connectDiscord = func() (*DiscordApi, func(), error) {
+
+	botToken, err := GetDiscordBotToken()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to retrieve bot token: %w", err)
+	}
+
+	logrus.Debugf("Discord bot token successfully retrieved, looking up the application")
+	client := NewClient(botToken)
+	appId, err := client.ApplicationID()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to look up the bot's application: %w", err)
+	}
+
+	api := &DiscordApi{
+		AppId:         appId,
+		Get:           client.ApplicationCommands,
+		Create:        client.ApplicationCommandCreate,
+		Edit:          client.ApplicationCommandEdit,
+		Delete:        client.ApplicationCommandDelete,
+		BulkOverwrite: client.ApplicationCommandBulkOverwrite,
+	}
+	return api, func() {}, nil
+}
+
+// cliOptions are the flags shared by every subcommand
+type cliOptions struct {
+	input       string
+	environment string
+	guilds      []string
+	format      string
+	logLevel    string
+
+	// Only used by some subcommands
+	live     bool
+	output   string
+	snapshot string
+	state    string
+	commit   string
+	pkg      string
+	check    bool
+	schema   bool
+}
+
+type cliCommand struct {
+	name    string
+	summary string
+	formats []string
+	run     func(opts *cliOptions, out io.Writer) error
+	// Adds the flags only this subcommand takes
+	flags func(flags *flag.FlagSet, opts *cliOptions)
+}
+
+var cliCommands = []*cliCommand{
+	{
+		name:    "validate",
+		summary: "Check commands.yml against Discord's rules",
+		formats: []string{FormatText, FormatJSON},
+		run:     runValidate,
+		flags: func(flags *flag.FlagSet, opts *cliOptions) {
+			flags.BoolVar(&opts.schema, "schema", false,
+				"check the YAML against the JSON Schema first, which catches unknown and misspelt keys")
+		},
+	},
+	{
+		name:    "plan",
+		summary: "Show what apply would change, without changing anything",
+		formats: []string{FormatText, FormatJSON},
+		run:     runPlan,
+		flags: func(flags *flag.FlagSet, opts *cliOptions) {
+			flags.StringVar(&opts.state, "state", DefaultStatePath,
+				"deploy state saved by apply, so guilds removed from commands.yml are planned too")
+		},
+	},
+	{
+		name:    "apply",
+		summary: "Sync the commands in commands.yml to Discord, restoring them if anything fails",
+		formats: []string{FormatText},
+		run:     runApply,
+		flags: func(flags *flag.FlagSet, opts *cliOptions) {
+			flags.StringVar(&opts.snapshot, "snapshot", DefaultSnapshotPath,
+				"file to save the live commands to before changing them, or empty to not save them")
+			stateFlags(flags, opts)
+		},
+	},
+	{
+		name:    "rollback",
+		summary: "Restore the live commands from a snapshot saved by apply",
+		formats: []string{FormatText},
+		run:     runRollback,
+		flags: func(flags *flag.FlagSet, opts *cliOptions) {
+			flags.StringVar(&opts.snapshot, "snapshot", DefaultSnapshotPath, "snapshot file to restore")
+			stateFlags(flags, opts)
+		},
+	},
+	{
+		name:    "drift",
+		summary: "Check the live commands haven't been changed since the last apply",
+		formats: []string{FormatText, FormatJSON},
+		run:     runDrift,
+		flags: func(flags *flag.FlagSet, opts *cliOptions) {
+			flags.StringVar(&opts.state, "state", DefaultStatePath, "deploy state saved by apply")
+		},
+	},
+	{
+		name:    "schema",
+		summary: "Write the JSON Schema for commands.yml, for editors to check it with",
+		formats: []string{FormatJSON},
+		run:     runSchema,
+		flags: func(flags *flag.FlagSet, opts *cliOptions) {
+			flags.StringVar(&opts.output, "output", "", "file to write to (default: standard output)")
+			flags.BoolVar(&opts.check, "check", false, "fail if the output file is out of date, rather than writing it")
+		},
+	},
+	{
+		name:    "export",
+		summary: "Write out commands.yml with includes and the environment applied, or the live commands",
+		formats: []string{FormatYAML, FormatJSON},
+		run:     runExport,
+		flags: func(flags *flag.FlagSet, opts *cliOptions) {
+			flags.BoolVar(&opts.live, "live", false, "export the commands registered with Discord, rather than commands.yml")
+			flags.StringVar(&opts.output, "output", "", "file to write to (default: standard output)")
+			flags.BoolVar(&opts.check, "check", false, "fail if the output file is out of date, rather than writing it")
+		},
+	},
+	{
+		name:    "generate",
+		summary: "Write Go types for the options of every command, for the interactor to parse them with",
+		formats: []string{FormatText},
+		run:     runGenerate,
+		flags: func(flags *flag.FlagSet, opts *cliOptions) {
+			flags.StringVar(&opts.output, "output", "", "file to write to (default: standard output)")
+			flags.StringVar(&opts.pkg, "package", "main", "package the generated code is in")
+			flags.BoolVar(&opts.check, "check", false, "fail if the output file is out of date, rather than writing it")
+		},
+	},
+	{
+		name:    "docs",
+		summary: "Write a reference page for the commands, as Markdown or HTML",
+		formats: []string{FormatMarkdown, FormatHTML},
+		run:     runDocs,
+		flags: func(flags *flag.FlagSet, opts *cliOptions) {
+			flags.StringVar(&opts.output, "output", "", "file to write to (default: standard output)")
+			flags.BoolVar(&opts.check, "check", false, "fail if the output file is out of date, rather than writing it")
+		},
+	},
+	{
+		name:    "clean",
+		summary: "Delete every command from the global scope and each guild",
+		formats: []string{FormatText},
+		run:     runClean,
+	},
+}
+
+// stateFlags adds the flags of the subcommands that record what they deploy
+func stateFlags(flags *flag.FlagSet, opts *cliOptions) {
+	flags.StringVar(&opts.state, "state", DefaultStatePath,
+		"file to record the deployed commands in, for drift to check, or empty to not record them")
+	flags.StringVar(&opts.commit, "commit", "", "commit being deployed (default: the commit checked out)")
+}
+
+// RunCLI runs the subcommand named in args and returns the exit code to end with
+func RunCLI(args []string, out io.Writer, errOut io.Writer) int {
+
+	usage := func() {
+		fmt.Fprintf(errOut, "Usage: slash_commands <command> [flags]\n\nCommands:\n")
+		for _, command := range cliCommands {
+			fmt.Fprintf(errOut, "  %-10s%s\n", command.name, command.summary)
+		}
+		fmt.Fprintf(errOut, "\nRun slash_commands <command> -h for the flags of each command.\n")
+	}
+
+	if len(args) == 0 {
+		usage()
+		return ExitUsage
+	}
+	var command *cliCommand
+	for _, c := range cliCommands {
+		if c.name == args[0] {
+			command = c
+		}
+	}
+	if command == nil {
+		if args[0] != "-h" && args[0] != "-help" && args[0] != "help" {
+			fmt.Fprintf(errOut, "Unknown command %q\n\n", args[0])
+		}
+		usage()
+		return ExitUsage
+	}
+
+	opts, err := parseFlags(command, args[1:], errOut)
+	if errors.Is(err, flag.ErrHelp) {
+		return ExitOK
+	}
+	if err == nil {
+		err = command.run(opts, out)
+	}
+	if err == nil {
+		return ExitOK
+	}
+
+	logrus.Error(err.Error())
+	var cliErr *cliError
+	if errors.As(err, &cliErr) {
+		return cliErr.code
+	}
+	return ExitError
+}
+
+func parseFlags(command *cliCommand, args []string, errOut io.Writer) (*cliOptions, error) {
+
+	opts := cliOptions{}
+	var guilds string
+
+	flags := flag.NewFlagSet(command.name, flag.ContinueOnError)
+	flags.SetOutput(errOut)
+	flags.StringVar(&opts.input, "input", "",
+		"commands.yml, or a directory of command files (default: slash_commands/commands.yml in this or a parent directory)")
+	flags.StringVar(&opts.environment, "env", os.Getenv("SLASH_COMMANDS_ENV"),
+		"environment in commands.yml to apply, such as dev or prod (default: $SLASH_COMMANDS_ENV)")
+	flags.StringVar(&guilds, "guilds", "",
+		"comma separated guild IDs to limit the command to, leaving global commands alone")
+	flags.StringVar(&opts.format, "format", command.formats[0],
+		fmt.Sprintf("output format: %s", strings.Join(command.formats, ", ")))
+	flags.StringVar(&opts.logLevel, "log-level", "info", "log level: debug, info, warn or error")
+	if command.flags != nil {
+		command.flags(flags, &opts)
+	}
+
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, err
+		}
+		return nil, &cliError{code: ExitUsage, err: err}
+	}
+	if flags.NArg() > 0 {
+		return nil, exitError(ExitUsage, "unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+
+	level, err := logrus.ParseLevel(opts.logLevel)
+	if err != nil {
+		return nil, &cliError{code: ExitUsage, err: err}
+	}
+	logrus.SetLevel(level)
+
+	formatKnown := false
+	for _, format := range command.formats {
+		formatKnown = formatKnown || format == opts.format
+	}
+	if !formatKnown {
+		return nil, exitError(ExitUsage, "%s cannot output %q, expected one of: %s",
+			command.name, opts.format, strings.Join(command.formats, ", "))
+	}
+
+	for _, guildId := range strings.Split(guilds, ",") {
+		if guildId = strings.TrimSpace(guildId); len(guildId) == 0 {
+			continue
+		}
+		if !IsSnowflake(guildId) {
+			return nil, exitError(ExitUsage, "invalid guild ID: %q", guildId)
+		}
+		opts.guilds = append(opts.guilds, guildId)
+	}
+	return &opts, nil
+}
+
+// findCommandsYML looks for slash_commands/commands.yml in the working directory and each of its parents
+func findCommandsYML() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("unable to build path for input file: %w", err)
+	}
+	for {
+		path := filepath.Join(dir, "slash_commands", "commands.yml")
+		if _, err = os.Stat(path); err == nil {
+			return path, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", errors.New("unable to find slash_commands/commands.yml, use -input to say where it is")
+		}
+		dir = parent
+	}
+}
+
+// loadCommands loads and validates the input with the environment applied
+func loadCommands(opts *cliOptions) (*AppCmdYml, *ValidationResult, error) {
+
+	var err error
+	if len(opts.input) == 0 {
+		if opts.input, err = findCommandsYML(); err != nil {
+			return nil, nil, &cliError{code: ExitInvalid, err: err}
+		}
+	}
+
+	yml, err := LoadYAML(opts.input)
+	if err != nil {
+		return nil, nil, &cliError{code: ExitInvalid, err: err}
+	}
+	// The schema sees the files as they were written, before the environment changes anything
+	var schemaProblems []*ValidationProblem
+	if opts.schema {
+		schemaProblems = ValidateSchema(&yml).Problems
+	}
+	if len(opts.environment) > 0 {
+		if err = ApplyEnvironment(&yml, opts.environment); err != nil {
+			return nil, nil, &cliError{code: ExitInvalid, err: err}
+		}
+	}
+
+	result := ValidateCommands(&yml)
+	result.Problems = append(schemaProblems, result.Problems...)
+	if result.HasErrors() {
+		return &yml, result, exitError(ExitInvalid, "command structure is invalid: %s", result.Summary())
+	}
+	return &yml, result, nil
+}
+
+// loadScopes loads valid commands and picks out the scopes the subcommand should act on
+func loadScopes(opts *cliOptions) (*AppCmdYml, []*CommandScope, error) {
+
+	yml, result, err := loadCommands(opts)
+	if result != nil {
+		result.Log()
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Translations are optional, but list the ones still missing for each locale
+	if coverage := LocalizationCoverage(yml); len(coverage) > 0 {
+		var report strings.Builder
+		FormatCoverageText(coverage, &report)
+		logrus.Infof("Localization coverage:\n%s", report.String())
+	}
+
+	scopes, err := SelectScopes(CommandScopes(yml), opts.guilds)
+	if err != nil {
+		return nil, nil, &cliError{code: ExitUsage, err: err}
+	}
+	return yml, scopes, nil
+}
+
+func connect() (*DiscordApi, func(), error) {
+	api, closeFn, err := connectDiscord()
+	if err != nil {
+		return nil, nil, &cliError{code: ExitDiscord, err: err}
+	}
+	return api, closeFn, nil
+}
+
+func runValidate(opts *cliOptions, out io.Writer) error {
+
+	yml, result, err := loadCommands(opts)
+	if result == nil {
+		return err
+	}
+
+	if opts.format == FormatJSON {
+		body, jsonErr := json.MarshalIndent(struct {
+			Problems []*ValidationProblem `json:"problems"`
+			Errors   int                  `json:"errors"`
+			Warnings int                  `json:"warnings"`
+		}{result.Problems, result.Count(SeverityError), result.Count(SeverityWarning)}, "", "  ")
+		if jsonErr != nil {
+			return jsonErr
+		}
+		fmt.Fprintln(out, string(body))
+		return err
+	}
+
+	for _, problem := range result.Problems {
+		fmt.Fprintln(out, problem.String())
+	}
+	fmt.Fprintf(out, "Validation finished: %s\n", result.Summary())
+	if err == nil {
+		FormatCoverageText(LocalizationCoverage(yml), out)
+	}
+	return err
+}
+
+func runPlan(opts *cliOptions, out io.Writer) error {
+
+	_, scopes, err := loadScopes(opts)
+	if err != nil {
+		return err
+	}
+	api, closeFn, err := connect()
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+	scopes = withRemovedGuilds(opts, api, scopes)
+
+	if err = PlanScopes(api.Get, &api.AppId, scopes, opts.format, out); err != nil {
+		return &cliError{code: ExitDiscord, err: err}
+	}
+	return nil
+}
+
+func runApply(opts *cliOptions, out io.Writer) error {
+
+	_, scopes, err := loadScopes(opts)
+	if err != nil {
+		return err
+	}
+	api, closeFn, err := connect()
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+	scopes = withRemovedGuilds(opts, api, scopes)
+
+	// Sync global and guild commands from our YAML, only touching what has changed
+	err = SyncScopesWithRollback(api.Get, api.Create, api.Edit, api.Delete, api.BulkOverwrite, &api.AppId,
+		scopes, opts.snapshot)
+	// A snapshot that couldn't be fetched is Discord's problem, while one that couldn't be saved is ours
+	var snapshotErr *SnapshotError
+	if errors.As(err, &snapshotErr) {
+		code := ExitError
+		if len(snapshotErr.Path) == 0 {
+			code = ExitDiscord
+		}
+		return exitError(code, "unable to sync commands to saluki: %w", err)
+	}
+	var rollbackErr *RollbackError
+	if errors.As(err, &rollbackErr) && rollbackErr.RestoreErr != nil {
+		return exitError(ExitRollback, "unable to sync commands to saluki: %w", err)
+	}
+	if err != nil {
+		return exitError(ExitSync, "unable to sync commands to saluki: %w", err)
+	}
+	return saveDeployState(opts, api, scopes)
+}
+
+// withRemovedGuilds adds the guilds the deploy state has commands in that commands.yml no longer does, so their
+// commands are deleted. Only a full deploy does this, since -guilds names the guilds to touch.
+func withRemovedGuilds(opts *cliOptions, api *DiscordApi, scopes []*CommandScope) []*CommandScope {
+
+	if len(opts.state) == 0 || len(opts.guilds) > 0 {
+		return scopes
+	}
+	state, err := LoadState(opts.state)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			logrus.Warnf("Guilds removed from commands.yml won't be synced: %s", err.Error())
+		}
+		return scopes
+	}
+	if state.AppID != api.AppId {
+		return scopes
+	}
+	for _, scope := range RemovedGuildScopes(scopes, state) {
+		logrus.Infof("Guild %s is no longer in commands.yml, so its commands will be deleted", scope.GuildID)
+		scopes = append(scopes, scope)
+	}
+	return scopes
+}
+
+func runRollback(opts *cliOptions, out io.Writer) error {
+
+	snapshot, err := LoadSnapshot(opts.snapshot)
+	if err != nil {
+		return &cliError{code: ExitInvalid, err: err}
+	}
+	if len(opts.guilds) > 0 {
+		var scopes []*SnapshotScope
+		for _, scope := range snapshot.Scopes {
+			if len(intersect([]string{scope.GuildID}, opts.guilds)) > 0 {
+				scopes = append(scopes, scope)
+			}
+		}
+		snapshot.Scopes = scopes
+	}
+
+	api, closeFn, err := connect()
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	if snapshot.AppID != api.AppId {
+		return exitError(ExitInvalid, "snapshot %s is of application %s, not %s", opts.snapshot, snapshot.AppID, api.AppId)
+	}
+	err = RestoreSnapshot(api.Get, api.Create, api.Edit, api.Delete, api.BulkOverwrite, &api.AppId, snapshot)
+	if err != nil {
+		return exitError(ExitRollback, "unable to restore snapshot: %w", err)
+	}
+	return saveDeployState(opts, api, snapshot.CommandScopes())
+}
+
+// saveDeployState records the commands now live in scopes, keeping the rest of the saved state
+func saveDeployState(opts *cliOptions, api *DiscordApi, scopes []*CommandScope) error {
+
+	if len(opts.state) == 0 {
+		return nil
+	}
+	previous, err := LoadState(opts.state)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		logrus.Warnf("Starting a new deploy state: %s", err.Error())
+	}
+	commit := opts.commit
+	if len(commit) == 0 {
+		commit = currentCommit()
+	}
+
+	state, err := RecordState(api.Get, &api.AppId, scopes, commit, previous)
+	if err == nil {
+		err = SaveState(state, opts.state)
+	}
+	if err != nil {
+		return fmt.Errorf("commands were deployed, but the deploy state could not be saved: %w", err)
+	}
+	return nil
+}
+
+func runDrift(opts *cliOptions, out io.Writer) error {
+
+	state, err := LoadState(opts.state)
+	if err != nil {
+		return &cliError{code: ExitInvalid, err: err}
+	}
+	if len(opts.guilds) > 0 {
+		var scopes []*StateScope
+		for _, scope := range state.Scopes {
+			if len(intersect([]string{scope.GuildID}, opts.guilds)) > 0 {
+				scopes = append(scopes, scope)
+			}
+		}
+		state.Scopes = scopes
+	}
+
+	api, closeFn, err := connect()
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	if state.AppID != api.AppId {
+		return exitError(ExitInvalid, "deploy state %s is of application %s, not %s", opts.state, state.AppID, api.AppId)
+	}
+	drifts, err := DetectDrift(api.Get, &api.AppId, state)
+	if err != nil {
+		return &cliError{code: ExitDiscord, err: err}
+	}
+
+	if opts.format == FormatJSON {
+		body, err := json.MarshalIndent(drifts, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, string(body))
+	} else if err = FormatDriftText(state, drifts, out); err != nil {
+		return err
+	}
+	if len(drifts) > 0 {
+		return exitError(ExitDrift, "live commands were changed outside of apply: %d command(s) drifted", len(drifts))
+	}
+	return nil
+}
+
+func runExport(opts *cliOptions, out io.Writer) error {
+
+	var exported AppCmdYml
+	if opts.live {
+		live, err := exportLive(opts)
+		if err != nil {
+			return err
+		}
+		exported = *live
+	} else {
+		yml, _, err := loadScopes(opts)
+		if err != nil {
+			return err
+		}
+
+		// Includes and environments have already been merged in, so leave them out
+		exported = AppCmdYml{Commands: yml.Commands, Guilds: yml.Guilds}
+		if len(opts.guilds) > 0 {
+			exported = AppCmdYml{}
+			for _, group := range yml.Guilds {
+				if guildIds := intersect(group.GuildIds, opts.guilds); len(guildIds) > 0 {
+					exported.Guilds = append(exported.Guilds, &GuildCmdYml{GuildIds: guildIds, Commands: group.Commands})
+				}
+			}
+		}
+	}
+
+	var body []byte
+	var err error
+	if opts.format == FormatJSON {
+		body, err = json.MarshalIndent(&exported, "", "  ")
+		body = append(body, '\n')
+	} else {
+		body, err = encodeYAML(&exported)
+	}
+	if err != nil {
+		return err
+	}
+
+	return writeGenerated(opts, body, "export it again", out)
+}
+
+// exportLive fetches the commands registered with Discord. Without a list of guilds, the guilds
+// in commands.yml are exported, or only global commands if there's no commands.yml yet.
+func exportLive(opts *cliOptions) (*AppCmdYml, error) {
+
+	guildIds := opts.guilds
+	if len(guildIds) == 0 {
+		input := opts.input
+		if len(input) == 0 {
+			found, err := findCommandsYML()
+			if err != nil {
+				logrus.Infof("No commands.yml found, only exporting global commands")
+			}
+			input = found
+		}
+		if len(input) > 0 {
+			yml, err := LoadYAML(input)
+			if err != nil {
+				return nil, &cliError{code: ExitInvalid, err: err}
+			}
+			for _, scope := range CommandScopes(&yml)[1:] {
+				guildIds = append(guildIds, scope.GuildID)
+			}
+		}
+	}
+
+	api, closeFn, err := connect()
+	if err != nil {
+		return nil, err
+	}
+	defer closeFn()
+
+	yml, err := ExportCommands(api.Get, &api.AppId, guildIds)
+	if err != nil {
+		return nil, &cliError{code: ExitDiscord, err: err}
+	}
+	return yml, nil
+}
+
+// runGenerate writes the option types. Commands from every environment are included, since the
+// interactor has to handle them all, so -env makes no difference.
+func runGenerate(opts *cliOptions, out io.Writer) error {
+
+	opts.environment = ""
+	yml, _, err := loadCommands(opts)
+	if err != nil {
+		return err
+	}
+	sets := [][]*discordgo.ApplicationCommand{allCommands(yml)}
+	for _, name := range EnvironmentNames(yml) {
+		envOpts := *opts
+		envOpts.environment = name
+		envYml, _, err := loadCommands(&envOpts)
+		if err != nil {
+			return err
+		}
+		sets = append(sets, allCommands(envYml))
+	}
+
+	commands, err := codegenCommands(sets...)
+	if err != nil {
+		return &cliError{code: ExitInvalid, err: err}
+	}
+	body, err := GenerateOptionTypes(commands, opts.pkg)
+	if err != nil {
+		return &cliError{code: ExitInvalid, err: err}
+	}
+
+	return writeGenerated(opts, body, "run go generate ./interactor/...", out)
+}
+
+func runSchema(opts *cliOptions, out io.Writer) error {
+
+	body, err := json.MarshalIndent(CommandsSchema(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeGenerated(opts, append(body, '\n'), "run go generate ./slash_commands/...", out)
+}
+
+func runDocs(opts *cliOptions, out io.Writer) error {
+
+	yml, result, err := loadCommands(opts)
+	if result != nil {
+		result.Log()
+	}
+	if err != nil {
+		return err
+	}
+
+	body := GenerateMarkdownDocs(yml)
+	if opts.format == FormatHTML {
+		if body, err = GenerateHTMLDocs(yml); err != nil {
+			return err
+		}
+	}
+	return writeGenerated(opts, body, "run go generate ./slash_commands/...", out)
+}
+
+// writeGenerated writes generated output to -output, or standard output. With -check, it instead
+// fails when the file in -output is out of date, saying how to update it.
+func writeGenerated(opts *cliOptions, body []byte, update string, out io.Writer) error {
+	if opts.check {
+		if len(opts.output) == 0 {
+			return exitError(ExitUsage, "-check needs the -output file to check")
+		}
+		existing, err := os.ReadFile(opts.output)
+		if err != nil || !bytes.Equal(existing, body) {
+			return exitError(ExitStale, "%s is out of date, %s", opts.output, update)
+		}
+		logrus.Infof("%s is up to date", opts.output)
+		return nil
+	}
+	if len(opts.output) > 0 {
+		logrus.Infof("Writing %s", opts.output)
+		return os.WriteFile(opts.output, body, 0644)
+	}
+	_, err := out.Write(body)
+	return err
+}
+
+func runClean(opts *cliOptions, out io.Writer) error {
+
+	// Without a list of guilds, clean everywhere commands.yml deploys to
+	guildIds := opts.guilds
+	if len(guildIds) == 0 {
+		_, scopes, err := loadScopes(opts)
+		if err != nil {
+			return err
+		}
+		for _, scope := range scopes {
+			guildIds = append(guildIds, scope.GuildID)
+		}
+	}
+
+	api, closeFn, err := connect()
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	var errs CommandErrors
+	for _, guildId := range guildIds {
+		scope := CommandScope{GuildID: guildId}
+		logrus.Infof("Cleaning %s", scope.String())
+		errs = appendErrors(errs, CleanCommands(api.Get, api.Delete, &api.AppId, &guildId))
+	}
+	if len(errs) > 0 {
+		// There is no snapshot to restore, so this is Discord failing rather than a rolled back sync
+		return exitError(ExitDiscord, "unable to clean commands: %w", errs)
+	}
+	return nil
+}
+
+// intersect lists the IDs in ids that are also in keep
+func intersect(ids []string, keep []string) []string {
+	kept := make(map[string]struct{})
+	for _, id := range keep {
+		kept[id] = struct{}{}
+	}
+	var result []string
+	for _, id := range ids {
+		if _, exists := kept[id]; exists {
+			result = append(result, id)
+		}
+	}
+	return result
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"errors"
+	"github.com/bwmarrin/discordgo"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useMockDiscord points the subcommands at m instead of Discord until the test ends
+func useMockDiscord(t *testing.T, m *mockDiscordApi) {
+	connect := connectDiscord
+	t.Cleanup(func() { connectDiscord = connect })
+
+	connectDiscord = func() (*DiscordApi, func(), error) {
+		return &DiscordApi{
+			AppId:         "1234",
+			Get:           m.Get,
+			Create:        m.Create,
+			Edit:          m.Edit,
+			Delete:        m.Delete,
+			BulkOverwrite: m.BulkOverwrite,
+		}, func() {}, nil
+	}
+}
+
+func runTestCLI(args ...string) (int, string) {
+	var out strings.Builder
+	code := RunCLI(args, &out, &strings.Builder{})
+	return code, out.String()
+}
+
+func testInput(t *testing.T, name string) string {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Unable to build path for input file: %s", err.Error())
+	}
+	return dir + "/test/" + name
+}
+
+func TestCLIUsageErrors(t *testing.T) {
+	cases := [][]string{
+		{},
+		{"deploy"},
+		{"validate", "-format", "yaml"},
+		{"validate", "-log-level", "loud"},
+		{"apply", "-guilds", "not-a-guild"},
+		{"validate", "extra"},
+	}
+	for _, args := range cases {
+		if code, _ := runTestCLI(args...); code != ExitUsage {
+			t.Errorf("Expected %v to exit with %d, got %d", args, ExitUsage, code)
+		}
+	}
+}
+
+func TestCLIValidate(t *testing.T) {
+	code, out := runTestCLI("validate", "-input", testInput(t, "valid/guild_commands.yml"))
+	if code != ExitOK || !strings.Contains(out, "Validation finished: 0 error(s), 0 warning(s)") {
+		t.Errorf("Expected valid commands to pass, got %d:\n%s", code, out)
+	}
+
+	code, out = runTestCLI("validate", "-input", testInput(t, "invalid/multiple_problems.yml"))
+	if code != ExitInvalid || !strings.Contains(out, "[option-description-missing]") {
+		t.Errorf("Expected invalid commands to exit with %d and list problems, got %d:\n%s", ExitInvalid, code, out)
+	}
+
+	code, out = runTestCLI("validate", "-format", "json", "-input", testInput(t, "invalid/multiple_problems.yml"))
+	if code != ExitInvalid || !strings.Contains(out, `"errors": 4`) {
+		t.Errorf("Expected JSON output with 4 errors, got %d:\n%s", code, out)
+	}
+
+	if code, _ = runTestCLI("validate", "-input", testInput(t, "missing.yml")); code != ExitInvalid {
+		t.Errorf("Expected a missing file to exit with %d, got %d", ExitInvalid, code)
+	}
+}
+
+func TestCLIValidateEnvironment(t *testing.T) {
+	input := testInput(t, "environments/overlay_breaks_rules.yml")
+	if code, _ := runTestCLI("validate", "-input", input); code != ExitOK {
+		t.Errorf("Expected the base commands to pass, got %d", code)
+	}
+	if code, _ := runTestCLI("validate", "-input", input, "-env", "dev"); code != ExitInvalid {
+		t.Errorf("Expected the dev commands to fail, got %d", code)
+	}
+}
+
+func TestCLIPlanAndApply(t *testing.T) {
+	m := newMockDiscordApi()
+	useMockDiscord(t, m)
+	input := testInput(t, "valid/guild_commands.yml")
+
+	code, out := runTestCLI("plan", "-input", input)
+	if code != ExitOK || !strings.Contains(out, "=== guild 876543210987654321 commands ===\n+ chat input command blep") {
+		t.Errorf("Expected plan to show blep being created, got %d:\n%s", code, out)
+	}
+	if m.writes() != 0 {
+		t.Errorf("Expected plan to make no write calls, got %v", m.calls)
+	}
+
+	// Limiting apply to a guild leaves global commands alone
+	if code, _ = runTestCLI("apply", "-snapshot", testSnapshotPath(t), "-state", testStatePath(t), "-input", input, "-guilds", "876543210987654321"); code != ExitOK {
+		t.Fatalf("Expected apply to succeed, got %d", code)
+	}
+	if m.find("876543210987654321", "blep") == nil || len(m.commands[""]) != 0 || len(m.commands["123456789012345678"]) != 0 {
+		t.Errorf("Expected only guild 876543210987654321 to be synced, got %v", m.commands)
+	}
+
+	if code, _ = runTestCLI("apply", "-snapshot", testSnapshotPath(t), "-state", testStatePath(t), "-input", input); code != ExitOK {
+		t.Fatalf("Expected apply to succeed, got %d", code)
+	}
+	if m.find("", "helloworld") == nil || len(m.commands["123456789012345678"]) != 2 {
+		t.Errorf("Expected every scope to be synced, got %v", m.commands)
+	}
+
+	if code, _ = runTestCLI("apply", "-snapshot", testSnapshotPath(t), "-state", testStatePath(t), "-input", input, "-guilds", "111111111111111111"); code != ExitUsage {
+		t.Errorf("Expected a guild that isn't in commands.yml to exit with %d, got %d", ExitUsage, code)
+	}
+}
+
+func TestCLIApplyDeletesFromRemovedGuilds(t *testing.T) {
+	m := newMockDiscordApi()
+	useMockDiscord(t, m)
+	statePath := testStatePath(t)
+
+	if code, _ := runTestCLI("apply", "-snapshot", testSnapshotPath(t), "-state", statePath, "-input", testInput(t, "valid/guild_commands.yml")); code != ExitOK {
+		t.Fatalf("Expected apply to succeed, got %d", code)
+	}
+	if m.find("876543210987654321", "blep") == nil {
+		t.Fatalf("Expected blep to be deployed to guild 876543210987654321, got %v", m.commands)
+	}
+
+	// The group for guild 876543210987654321 is gone, so nothing in commands.yml mentions it
+	input := testInput(t, "valid/guild_commands_only.yml")
+	code, out := runTestCLI("plan", "-state", statePath, "-input", input)
+	if code != ExitOK || !strings.Contains(out, "=== guild 876543210987654321 commands ===\n- chat input command blep") {
+		t.Errorf("Expected plan to show blep being deleted from the removed guild, got %d:\n%s", code, out)
+	}
+	if code, _ = runTestCLI("apply", "-snapshot", testSnapshotPath(t), "-state", statePath, "-input", input); code != ExitOK {
+		t.Fatalf("Expected apply to succeed, got %d", code)
+	}
+	if len(m.commands["876543210987654321"]) != 0 || m.find("123456789012345678", "blep") == nil {
+		t.Errorf("Expected the removed guild's commands to be deleted, got %v", m.commands)
+	}
+
+	state, err := LoadState(statePath)
+	if err != nil {
+		t.Fatalf("Unable to load the deploy state: %s", err.Error())
+	}
+	for _, scope := range state.Scopes {
+		if scope.GuildID == "876543210987654321" {
+			t.Errorf("Expected the emptied guild to be dropped from the deploy state, got %+v", scope)
+		}
+	}
+}
+
+func TestCLIExitCodesForDiscordFailures(t *testing.T) {
+	connect := connectDiscord
+	t.Cleanup(func() { connectDiscord = connect })
+	input := testInput(t, "valid/guild_commands.yml")
+
+	connectDiscord = func() (*DiscordApi, func(), error) {
+		return nil, nil, errors.New("no bot token")
+	}
+	if code, _ := runTestCLI("apply", "-snapshot", testSnapshotPath(t), "-state", testStatePath(t), "-input", input); code != ExitDiscord {
+		t.Errorf("Expected a failed connection to exit with %d, got %d", ExitDiscord, code)
+	}
+
+	m := newMockDiscordApi()
+	useMockDiscord(t, m)
+	api, _, _ := connectDiscord()
+	connectDiscord = func() (*DiscordApi, func(), error) {
+		api.BulkOverwrite = func(string, string, []*discordgo.ApplicationCommand) ([]*discordgo.ApplicationCommand, error) {
+			return nil, errors.New("HTTP 400 Bad Request")
+		}
+		return api, func() {}, nil
+	}
+	if code, _ := runTestCLI("apply", "-snapshot", testSnapshotPath(t), "-state", testStatePath(t), "-input", input); code != ExitSync {
+		t.Errorf("Expected a rejected sync to exit with %d, got %d", ExitSync, code)
+	}
+}
+
+func TestCLIExitCodeForFailedSnapshotFetch(t *testing.T) {
+	m := newMockDiscordApi()
+	useMockDiscord(t, m)
+	api, _, _ := connectDiscord()
+	connectDiscord = func() (*DiscordApi, func(), error) {
+		api.Get = func(string, string) ([]*discordgo.ApplicationCommand, error) {
+			return nil, errors.New("HTTP 503 Service Unavailable")
+		}
+		return api, func() {}, nil
+	}
+
+	input := testInput(t, "valid/guild_commands.yml")
+	if code, _ := runTestCLI("apply", "-snapshot", testSnapshotPath(t), "-state", testStatePath(t), "-input", input); code != ExitDiscord {
+		t.Errorf("Expected a snapshot that couldn't be fetched to exit with %d, got %d", ExitDiscord, code)
+	}
+	if m.writes() != 0 {
+		t.Errorf("Expected nothing to be deployed without a snapshot, got %v", m.calls)
+	}
+}
+
+func TestCLIExitCodeForFailedSnapshotSave(t *testing.T) {
+	m := newMockDiscordApi()
+	useMockDiscord(t, m)
+
+	input := testInput(t, "valid/guild_commands.yml")
+	snapshotPath := filepath.Join(t.TempDir(), "missing", "snapshot.json")
+	if code, _ := runTestCLI("apply", "-snapshot", snapshotPath, "-state", testStatePath(t), "-input", input); code != ExitError {
+		t.Errorf("Expected a snapshot that couldn't be saved to exit with %d, got %d", ExitError, code)
+	}
+	if m.writes() != 0 {
+		t.Errorf("Expected nothing to be deployed without a snapshot, got %v", m.calls)
+	}
+}
+
+func TestCLIExport(t *testing.T) {
+	code, out := runTestCLI("export", "-input", testInput(t, "environments/dev_and_prod.yml"), "-env", "dev")
+	if code != ExitOK {
+		t.Fatalf("Expected export to succeed, got %d", code)
+	}
+	if strings.Contains(out, "Environments") || !strings.Contains(out, `description: "[DEV] Dump the bot's state"`) {
+		t.Errorf("Expected the dev commands without the environments, got:\n%s", out)
+	}
+
+	// What is exported loads back as the same commands
+	path := t.TempDir() + "/commands.yml"
+	if err := os.WriteFile(path, []byte(out), 0644); err != nil {
+		t.Fatalf("Unable to write export: %s", err.Error())
+	}
+	yml, err := LoadYAML(path)
+	if err != nil {
+		t.Fatalf("Unable to load export: %s", err.Error())
+	}
+	if names := commandNames(yml.Commands); names != "helloworld, blep, debug" || len(yml.Guilds) != 1 {
+		t.Errorf("Expected the exported commands to load back, got %s", names)
+	}
+}
+
+func TestCLIClean(t *testing.T) {
+	m := newMockDiscordApi()
+	useMockDiscord(t, m)
+	m.seed("", liveBlep())
+	m.seed("123456789012345678", liveBlep())
+
+	if code, _ := runTestCLI("clean", "-guilds", "123456789012345678"); code != ExitOK {
+		t.Fatalf("Expected clean to succeed, got %d", code)
+	}
+	if len(m.commands["123456789012345678"]) != 0 || len(m.commands[""]) != 1 {
+		t.Errorf("Expected only the guild's commands to be cleaned, got %v", m.commands)
+	}
+
+	if code, _ := runTestCLI("clean", "-input", testInput(t, "valid/guild_commands.yml")); code != ExitOK {
+		t.Fatalf("Expected clean to succeed, got %d", code)
+	}
+	if len(m.commands[""]) != 0 {
+		t.Errorf("Expected global commands to be cleaned, got %v", m.commands)
+	}
+
+	m.seed("123456789012345678", liveBlep())
+	api, _, _ := connectDiscord()
+	connectDiscord = func() (*DiscordApi, func(), error) {
+		api.Delete = func(string, string, string) error {
+			return errors.New("HTTP 403 Forbidden")
+		}
+		return api, func() {}, nil
+	}
+	if code, _ := runTestCLI("clean", "-guilds", "123456789012345678"); code != ExitDiscord {
+		t.Errorf("Expected a rejected delete to exit with %d, got %d", ExitDiscord, code)
+	}
+}
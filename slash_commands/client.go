@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"github.com/sirupsen/logrus"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DefaultMaxRetries = 5
+const DefaultBackoff = 500 * time.Millisecond
+const DefaultMaxBackoff = 30 * time.Second
+
+// UserAgent follows the "DiscordBot ($url, $versionNumber)" form Discord requires of bots.
+// It is the same one discordgo sends for the rest of the bot.
+const UserAgent = "DiscordBot (https://github.com/bwmarrin/discordgo, v" + discordgo.VERSION + ")"
+
+// Client calls Discord's application command endpoints. It waits out rate limits before
+// they are hit where Discord says how long they last, and retries requests that failed
+// with a 429 or a server error. Its methods match the AppCmd*Fn types.
+type Client struct {
+	BaseURL    string
+	Token      string
+	HTTPClient *http.Client
+	MaxRetries int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// sleep waits between attempts, and is swapped out in tests
+	sleep func(time.Duration)
+
+	mu sync.Mutex
+	// When each route's rate limit resets, once it has run out of requests
+	resets      map[string]time.Time
+	globalReset time.Time
+}
+
+// APIError is an error response from Discord. Errors holds the per-field details, if any,
+// keyed by field name or by index for lists.
+type APIError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Code       int             `json:"code"`
+	Message    string          `json:"message"`
+	Errors     json.RawMessage `json:"errors"`
+}
+
+func (e *APIError) Error() string {
+	message := e.Message
+	if len(message) == 0 {
+		message = http.StatusText(e.StatusCode)
+	}
+	if len(e.Errors) > 0 {
+		message = fmt.Sprintf("%s %s", message, e.Errors)
+	}
+	return fmt.Sprintf("%s %s: HTTP %d: %s", e.Method, e.URL, e.StatusCode, message)
+}
+
+// retryable says whether the same request might work if it is sent again later
+func (e *APIError) retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// ResponseDecodeError is a successful response whose body couldn't be decoded. The request has
+// already taken effect, so it must not be sent again.
+type ResponseDecodeError struct {
+	Method string
+	URL    string
+	Err    error
+}
+
+func (e *ResponseDecodeError) Error() string {
+	return fmt.Sprintf("%s %s: unable to decode the response: %s", e.Method, e.URL, e.Err.Error())
+}
+
+func (e *ResponseDecodeError) Unwrap() error {
+	return e.Err
+}
+
+// rateLimitResponse is the body Discord sends with a 429
+type rateLimitResponse struct {
+	Message    string  `json:"message"`
+	RetryAfter float64 `json:"retry_after"`
+	Global     bool    `json:"global"`
+}
+
+func NewClient(botToken string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimSuffix(discordgo.EndpointAPI, "/"),
+		Token:      "Bot " + botToken,
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+		MaxRetries: DefaultMaxRetries,
+		Backoff:    DefaultBackoff,
+		MaxBackoff: DefaultMaxBackoff,
+		sleep:      time.Sleep,
+	}
+}
+
+func commandsPath(appId string, guildId string) string {
+	if len(guildId) == 0 {
+		return fmt.Sprintf("/applications/%s/commands", appId)
+	}
+	return fmt.Sprintf("/applications/%s/guilds/%s/commands", appId, guildId)
+}
+
+// ApplicationID looks up the ID of the application the bot token belongs to
+func (c *Client) ApplicationID() (string, error) {
+	var app struct {
+		ID string `json:"id"`
+	}
+	err := c.request(http.MethodGet, "/oauth2/applications/@me", "/oauth2/applications/@me", nil, &app)
+	return app.ID, err
+}
+
+func (c *Client) ApplicationCommands(appId string, guildId string) ([]*discordgo.ApplicationCommand, error) {
+	var commands []*discordgo.ApplicationCommand
+	path := commandsPath(appId, guildId)
+	err := c.request(http.MethodGet, path+"?with_localizations=true", path, nil, &commands)
+	return commands, err
+}
+
+func (c *Client) ApplicationCommandCreate(appId string, guildId string, cmd *discordgo.ApplicationCommand) (*discordgo.ApplicationCommand, error) {
+	var created discordgo.ApplicationCommand
+	path := commandsPath(appId, guildId)
+	err := c.request(http.MethodPost, path, path, cmd, &created)
+	return &created, err
+}
+
+func (c *Client) ApplicationCommandEdit(appId string, guildId string, cmdId string, cmd *discordgo.ApplicationCommand) (*discordgo.ApplicationCommand, error) {
+	var edited discordgo.ApplicationCommand
+	path := commandsPath(appId, guildId)
+	err := c.request(http.MethodPatch, path+"/"+cmdId, path+"/{id}", cmd, &edited)
+	return &edited, err
+}
+
+func (c *Client) ApplicationCommandDelete(appId string, guildId string, cmdId string) error {
+	path := commandsPath(appId, guildId)
+	return c.request(http.MethodDelete, path+"/"+cmdId, path+"/{id}", nil, nil)
+}
+
+func (c *Client) ApplicationCommandBulkOverwrite(appId string, guildId string, cmds []*discordgo.ApplicationCommand) ([]*discordgo.ApplicationCommand, error) {
+	var written []*discordgo.ApplicationCommand
+	path := commandsPath(appId, guildId)
+	err := c.request(http.MethodPut, path, path, cmds, &written)
+	return written, err
+}
+
+// request sends a request, retrying it while it fails in a way that might not last. Rate limits
+// are tracked per route, which is the path with any command ID taken out.
+func (c *Client) request(method string, path string, route string, body interface{}, result interface{}) error {
+
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	route = method + " " + route
+
+	var err error
+	for attempt := 0; attempt <= c.MaxRetries; attempt++ {
+		c.waitForRateLimit(route)
+
+		var wait time.Duration
+		wait, err = c.send(method, path, route, payload, result)
+		if err == nil {
+			return nil
+		}
+
+		// Only transport errors, 429s and server errors are worth another try
+		apiErr, isAPIErr := err.(*APIError)
+		if isAPIErr && !apiErr.retryable() {
+			return err
+		}
+		if _, isDecodeErr := err.(*ResponseDecodeError); isDecodeErr {
+			return err
+		}
+		if attempt == c.MaxRetries {
+			break
+		}
+
+		// Discord says how long to wait out a rate limit, otherwise back off exponentially
+		if wait == 0 {
+			wait = time.Duration(math.Min(float64(c.Backoff)*math.Pow(2, float64(attempt)), float64(c.MaxBackoff)))
+		}
+		logrus.Warnf("%s, retrying in %s", err.Error(), wait)
+		c.sleep(wait)
+	}
+	return err
+}
+
+// send makes a single attempt at a request. For a 429 it also returns how long Discord asked to wait.
+func (c *Client) send(method string, path string, route string, payload []byte, result interface{}) (time.Duration, error) {
+
+	url := c.BaseURL + path
+	req, err := http.NewRequest(method, url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", c.Token)
+	req.Header.Set("User-Agent", UserAgent)
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	c.trackRateLimit(route, resp.Header)
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		var limited rateLimitResponse
+		_ = json.Unmarshal(respBody, &limited)
+		wait := secondsHeader(resp.Header, "Retry-After")
+		if limited.RetryAfter > 0 {
+			wait = time.Duration(limited.RetryAfter * float64(time.Second))
+		}
+		if limited.Global || resp.Header.Get("X-RateLimit-Global") == "true" {
+			c.mu.Lock()
+			c.globalReset = time.Now().Add(wait)
+			c.mu.Unlock()
+		}
+		return wait, &APIError{Method: method, URL: url, StatusCode: resp.StatusCode, Message: limited.Message}
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		apiErr := &APIError{Method: method, URL: url, StatusCode: resp.StatusCode}
+		_ = json.Unmarshal(respBody, apiErr)
+		return 0, apiErr
+	}
+
+	if result != nil && len(respBody) > 0 {
+		if err = json.Unmarshal(respBody, result); err != nil {
+			return 0, &ResponseDecodeError{Method: method, URL: url, Err: err}
+		}
+	}
+	return 0, nil
+}
+
+// trackRateLimit remembers when a route can be used again once it has no requests left
+func (c *Client) trackRateLimit(route string, header http.Header) {
+	if header.Get("X-RateLimit-Remaining") != "0" {
+		return
+	}
+	resetAfter := secondsHeader(header, "X-RateLimit-Reset-After")
+	if resetAfter == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.resets == nil {
+		c.resets = make(map[string]time.Time)
+	}
+	c.resets[route] = time.Now().Add(resetAfter)
+}
+
+// waitForRateLimit sleeps until the route, and the global limit, have requests left
+func (c *Client) waitForRateLimit(route string) {
+	c.mu.Lock()
+	reset := c.resets[route]
+	if c.globalReset.After(reset) {
+		reset = c.globalReset
+	}
+	c.mu.Unlock()
+
+	if wait := time.Until(reset); wait > 0 {
+		logrus.Debugf("Waiting %s for the rate limit on %s to reset", wait, route)
+		c.sleep(wait)
+	}
+}
+
+// secondsHeader reads a header holding a number of seconds, which can have a fraction
+func secondsHeader(header http.Header, name string) time.Duration {
+	seconds, err := strconv.ParseFloat(header.Get(name), 64)
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
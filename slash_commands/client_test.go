@@ -0,0 +1,245 @@
+package main
+
+import (
+	"errors"
+	"github.com/bwmarrin/discordgo"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// standInResponse is a canned response from the Discord stand-in
+type standInResponse struct {
+	status  int
+	headers map[string]string
+	body    string
+}
+
+// discordStandIn is a local HTTP server in place of the Discord API. It answers requests
+// with the queued responses in order, then with the fallback once they run out.
+type discordStandIn struct {
+	server    *httptest.Server
+	responses []standInResponse
+	fallback  standInResponse
+	requests  []*http.Request
+	bodies    []string
+}
+
+func newDiscordStandIn(t *testing.T, responses ...standInResponse) *discordStandIn {
+	s := &discordStandIn{responses: responses, fallback: standInResponse{status: http.StatusOK, body: "[]"}}
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.requests = append(s.requests, r)
+		s.bodies = append(s.bodies, string(body))
+
+		resp := s.fallback
+		if len(s.responses) > 0 {
+			resp, s.responses = s.responses[0], s.responses[1:]
+		}
+		for name, value := range resp.headers {
+			w.Header().Set(name, value)
+		}
+		w.WriteHeader(resp.status)
+		_, _ = io.WriteString(w, resp.body)
+	}))
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+// client points a Client at the stand-in, recording how long it sleeps for rather than sleeping
+func (s *discordStandIn) client(slept *[]time.Duration) *Client {
+	c := NewClient("token")
+	c.BaseURL = s.server.URL
+	c.sleep = func(d time.Duration) { *slept = append(*slept, d) }
+	return c
+}
+
+func TestClientSendsAuthorizedRequests(t *testing.T) {
+	s := newDiscordStandIn(t, standInResponse{status: http.StatusOK, body: `[{"id":"1","name":"blep","type":1}]`})
+	var slept []time.Duration
+
+	commands, err := s.client(&slept).ApplicationCommands("1234", "5678")
+	if err != nil {
+		t.Fatalf("Unable to get commands: %s", err.Error())
+	}
+	if len(commands) != 1 || commands[0].Name != "blep" {
+		t.Errorf("Expected blep, got %v", commands)
+	}
+
+	req := s.requests[0]
+	if req.Method != http.MethodGet || req.URL.Path != "/applications/1234/guilds/5678/commands" ||
+		req.URL.Query().Get("with_localizations") != "true" {
+		t.Errorf("Unexpected request: %s %s", req.Method, req.URL)
+	}
+	if req.Header.Get("Authorization") != "Bot token" {
+		t.Errorf("Expected the bot token to be sent, got %q", req.Header.Get("Authorization"))
+	}
+	if agent := req.Header.Get("User-Agent"); !strings.HasPrefix(agent, "DiscordBot (https://") {
+		t.Errorf("Expected a DiscordBot user agent, got %q", agent)
+	}
+}
+
+func TestClientRetriesRateLimitedRequests(t *testing.T) {
+	s := newDiscordStandIn(t,
+		standInResponse{status: http.StatusTooManyRequests, body: `{"message":"You are being rate limited.","retry_after":1.5,"global":false}`},
+		standInResponse{status: http.StatusOK, body: `{"id":"1","name":"blep","type":1}`},
+	)
+	var slept []time.Duration
+
+	created, err := s.client(&slept).ApplicationCommandCreate("1234", "", liveBlep())
+	if err != nil {
+		t.Fatalf("Expected the retry to succeed: %s", err.Error())
+	}
+	if created.ID != "1" || len(s.requests) != 2 {
+		t.Errorf("Expected the create to be sent twice, got %d requests", len(s.requests))
+	}
+	if len(slept) != 1 || slept[0] != 1500*time.Millisecond {
+		t.Errorf("Expected to wait the 1.5s Discord asked for, waited %v", slept)
+	}
+	if s.bodies[0] != s.bodies[1] || !strings.Contains(s.bodies[1], `"name":"blep"`) {
+		t.Errorf("Expected the same body to be sent again, got %q then %q", s.bodies[0], s.bodies[1])
+	}
+}
+
+func TestClientBacksOffOnServerErrors(t *testing.T) {
+	s := newDiscordStandIn(t,
+		standInResponse{status: http.StatusBadGateway},
+		standInResponse{status: http.StatusServiceUnavailable},
+		standInResponse{status: http.StatusNoContent},
+	)
+	var slept []time.Duration
+
+	if err := s.client(&slept).ApplicationCommandDelete("1234", "", "99"); err != nil {
+		t.Fatalf("Expected the retry to succeed: %s", err.Error())
+	}
+	if len(slept) != 2 || slept[0] != DefaultBackoff || slept[1] != 2*DefaultBackoff {
+		t.Errorf("Expected to back off exponentially, waited %v", slept)
+	}
+	if s.requests[0].Method != http.MethodDelete || s.requests[0].URL.Path != "/applications/1234/commands/99" {
+		t.Errorf("Unexpected request: %s %s", s.requests[0].Method, s.requests[0].URL)
+	}
+}
+
+func TestClientDoesNotRetryUndecodableResponses(t *testing.T) {
+	s := newDiscordStandIn(t, standInResponse{status: http.StatusCreated, body: `{"id": 1234`})
+	var slept []time.Duration
+
+	// The command was created, so sending the request again would create it twice
+	_, err := s.client(&slept).ApplicationCommandCreate("1234", "", liveBlep())
+	var decodeErr *ResponseDecodeError
+	if !errors.As(err, &decodeErr) || decodeErr.Method != http.MethodPost {
+		t.Fatalf("Expected a decode error, got %v", err)
+	}
+	if len(s.requests) != 1 || len(slept) != 0 {
+		t.Errorf("Expected no retries, got %d requests", len(s.requests))
+	}
+}
+
+func TestClientGivesUp(t *testing.T) {
+	s := newDiscordStandIn(t, standInResponse{status: http.StatusBadRequest,
+		body: `{"code":50035,"message":"Invalid Form Body","errors":{"name":{"_errors":[{"code":"APPLICATION_COMMAND_INVALID_NAME"}]}}}`})
+	var slept []time.Duration
+
+	// Requests that Discord rejected outright are not retried
+	_, err := s.client(&slept).ApplicationCommandEdit("1234", "", "99", liveBlep())
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest || apiErr.Code != 50035 {
+		t.Fatalf("Expected a 400 API error, got %v", err)
+	}
+	if len(s.requests) != 1 || len(slept) != 0 {
+		t.Errorf("Expected no retries, got %d requests", len(s.requests))
+	}
+	if !strings.Contains(err.Error(), "Invalid Form Body") || !strings.Contains(err.Error(), "APPLICATION_COMMAND_INVALID_NAME") {
+		t.Errorf("Expected the error to include Discord's details, got %s", err.Error())
+	}
+
+	// Requests that keep failing are retried until the limit
+	s = newDiscordStandIn(t)
+	s.fallback = standInResponse{status: http.StatusServiceUnavailable}
+	c := s.client(&slept)
+	c.MaxRetries = 2
+	if _, err = c.ApplicationCommands("1234", ""); err == nil {
+		t.Fatalf("Expected the request to fail")
+	}
+	if len(s.requests) != 3 {
+		t.Errorf("Expected 3 attempts, got %d", len(s.requests))
+	}
+}
+
+func TestClientWaitsForRateLimitReset(t *testing.T) {
+	s := newDiscordStandIn(t, standInResponse{status: http.StatusOK, body: "[]",
+		headers: map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset-After": "2"}})
+	var slept []time.Duration
+	c := s.client(&slept)
+
+	if _, err := c.ApplicationCommands("1234", ""); err != nil {
+		t.Fatalf("Unable to get commands: %s", err.Error())
+	}
+	if len(slept) != 0 {
+		t.Fatalf("Expected no wait before the first request, waited %v", slept)
+	}
+
+	// The route has run out, so the next request waits for it to reset
+	if _, err := c.ApplicationCommands("1234", ""); err != nil {
+		t.Fatalf("Unable to get commands: %s", err.Error())
+	}
+	if len(slept) != 1 || slept[0] < time.Second || slept[0] > 2*time.Second {
+		t.Errorf("Expected to wait for the reset, waited %v", slept)
+	}
+
+	// Other routes have their own limits
+	if _, err := c.ApplicationCommands("1234", "5678"); err != nil {
+		t.Fatalf("Unable to get commands: %s", err.Error())
+	}
+	if len(slept) != 1 {
+		t.Errorf("Expected no wait for another route, waited %v", slept)
+	}
+}
+
+func TestSyncReportsEveryFailedCommand(t *testing.T) {
+	var slept []time.Duration
+	appId, guildId := "1234", ""
+	commands := []*discordgo.ApplicationCommand{
+		{Type: discordgo.ChatApplicationCommand, Name: "helloworld", Description: "Tests our command architecture"},
+		liveBlep(),
+		{Type: discordgo.ChatApplicationCommand, Name: "boop", Description: "Boop a random adorable animal"},
+	}
+
+	// A bulk overwrite names the commands Discord rejected by their index
+	s := newDiscordStandIn(t, standInResponse{status: http.StatusOK, body: "[]"}, standInResponse{
+		status: http.StatusBadRequest,
+		body:   `{"code":50035,"message":"Invalid Form Body","errors":{"1":{"name":{}},"2":{"description":{}}}}`,
+	})
+	c := s.client(&slept)
+	err := SyncCommands(c.ApplicationCommands, c.ApplicationCommandCreate, c.ApplicationCommandEdit,
+		c.ApplicationCommandDelete, c.ApplicationCommandBulkOverwrite, &appId, &guildId, &AppCmdYml{Commands: commands})
+
+	var errs CommandErrors
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Fatalf("Expected 2 failed commands, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "unable to overwrite command blep") || !strings.Contains(err.Error(), "unable to overwrite command boop") {
+		t.Errorf("Expected blep and boop to be named, got:\n%s", err.Error())
+	}
+
+	// One call per command keeps going after a failure and reports all of them
+	s = newDiscordStandIn(t, standInResponse{status: http.StatusOK, body: "[]"},
+		standInResponse{status: http.StatusBadRequest, body: `{"code":50035,"message":"Invalid Form Body"}`},
+		standInResponse{status: http.StatusCreated, body: `{"id":"2","name":"blep","type":1}`},
+		standInResponse{status: http.StatusForbidden, body: `{"code":50001,"message":"Missing Access"}`},
+	)
+	c = s.client(&slept)
+	err = SyncCommands(c.ApplicationCommands, c.ApplicationCommandCreate, c.ApplicationCommandEdit,
+		c.ApplicationCommandDelete, nil, &appId, &guildId, &AppCmdYml{Commands: commands})
+
+	if !errors.As(err, &errs) || len(errs) != 2 || len(s.requests) != 4 {
+		t.Fatalf("Expected 2 of 3 creates to fail, got %v", err)
+	}
+	if !strings.HasPrefix(err.Error(), "2 commands failed:") || !strings.Contains(err.Error(), "helloworld") ||
+		!strings.Contains(err.Error(), "Missing Access") {
+		t.Errorf("Expected helloworld and boop to be listed, got:\n%s", err.Error())
+	}
+}
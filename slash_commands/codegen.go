@@ -0,0 +1,404 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"go/format"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// codegenLeaf is a command or subcommand that takes plain options, which gets its own struct
+type codegenLeaf struct {
+	Path    []string
+	Struct  string
+	Parse   string
+	Fields  []*codegenField
+	Display string
+	// Whether any option is optional, and so a pointer
+	HasOptional bool
+}
+
+type codegenField struct {
+	Name     string
+	Option   string
+	GoType   string
+	Getter   string
+	Required bool
+	Comment  string
+	Choice   *codegenChoice
+}
+
+// codegenChoice is the typed enum made for an option with choices
+type codegenChoice struct {
+	Type      string
+	Base      string
+	Where     string
+	Option    *discordgo.ApplicationCommandOption
+	Constants []*codegenConstant
+}
+
+type codegenConstant struct {
+	Name  string
+	Value string
+	Label string
+}
+
+// codegenGoTypes are the Go types for each option type, and the generated function that reads them
+var codegenGoTypes = map[discordgo.ApplicationCommandOptionType]struct {
+	goType  string
+	getter  string
+	comment string
+}{
+	discordgo.ApplicationCommandOptionString:      {"string", "stringOption", ""},
+	discordgo.ApplicationCommandOptionInteger:     {"int64", "intOption", ""},
+	discordgo.ApplicationCommandOptionNumber:      {"float64", "floatOption", ""},
+	discordgo.ApplicationCommandOptionBoolean:     {"bool", "boolOption", ""},
+	discordgo.ApplicationCommandOptionUser:        {"string", "stringOption", "ID of the user"},
+	discordgo.ApplicationCommandOptionChannel:     {"string", "stringOption", "ID of the channel"},
+	discordgo.ApplicationCommandOptionRole:        {"string", "stringOption", "ID of the role"},
+	discordgo.ApplicationCommandOptionMentionable: {"string", "stringOption", "ID of the user or role"},
+	discordgo.ApplicationCommandOptionAttachment:  {"string", "stringOption", "ID of the attachment, in the resolved data"},
+}
+
+// GoIdentifier turns a command, option or choice name into an exported Go name,
+// for example only_smol into OnlySmol
+func GoIdentifier(name string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	identifier := b.String()
+	if len(identifier) == 0 || !unicode.IsLetter([]rune(identifier)[0]) {
+		identifier = "X" + identifier
+	}
+	return identifier
+}
+
+// codegenCommands lists the chat input commands handlers need types for. A command can be declared
+// more than once, globally, for guilds and in environments, but only with the same options.
+func codegenCommands(sets ...[]*discordgo.ApplicationCommand) ([]*discordgo.ApplicationCommand, error) {
+	byName := make(map[string]*discordgo.ApplicationCommand)
+	var commands []*discordgo.ApplicationCommand
+	for _, set := range sets {
+		for _, command := range set {
+			if command.Type != discordgo.ChatApplicationCommand {
+				continue
+			}
+			existing, exists := byName[command.Name]
+			if !exists {
+				byName[command.Name] = command
+				commands = append(commands, command)
+				continue
+			}
+			if !reflect.DeepEqual(optionShapes(existing.Options), optionShapes(command.Options)) {
+				return nil, fmt.Errorf("command %s is declared more than once with different options, "+
+					"so there is no one type for them", command.Name)
+			}
+		}
+	}
+	sort.Slice(commands, func(i, j int) bool { return commands[i].Name < commands[j].Name })
+	return commands, nil
+}
+
+// optionShape is the part of an option generated code depends on
+type optionShape struct {
+	Name     string
+	Type     discordgo.ApplicationCommandOptionType
+	Required bool
+	Choices  []interface{}
+	Options  []optionShape
+}
+
+func optionShapes(options []*discordgo.ApplicationCommandOption) []optionShape {
+	var shapes []optionShape
+	for _, option := range options {
+		shape := optionShape{Name: option.Name, Type: option.Type, Required: option.Required,
+			Options: optionShapes(option.Options)}
+		for _, choice := range option.Choices {
+			shape.Choices = append(shape.Choices, choice.Value)
+		}
+		shapes = append(shapes, shape)
+	}
+	return shapes
+}
+
+// GenerateOptionTypes writes Go code for handlers to read the options of each chat input command with:
+// a struct per command and subcommand, a typed constant for each choice, and a function that parses
+// interaction data into the struct.
+func GenerateOptionTypes(commands []*discordgo.ApplicationCommand, pkg string) ([]byte, error) {
+
+	g := &codegen{choices: make(map[string]*codegenChoice), identifiers: make(map[string]string)}
+	for _, command := range commands {
+		g.addLeaves([]string{command.Name}, command.Options)
+	}
+	if len(g.errs) > 0 {
+		return nil, errors.New(strings.Join(g.errs, "\n"))
+	}
+
+	var choices []*codegenChoice
+	for _, choice := range g.choices {
+		choices = append(choices, choice)
+	}
+	sort.Slice(choices, func(i, j int) bool { return choices[i].Type < choices[j].Type })
+
+	var b bytes.Buffer
+	err := codegenTemplate.Execute(&b, map[string]interface{}{
+		"Package": pkg,
+		"Leaves":  g.leaves,
+		"Choices": choices,
+	})
+	if err != nil {
+		return nil, err
+	}
+	source, err := format.Source(b.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("generated code does not compile: %w", err)
+	}
+	return source, nil
+}
+
+type codegen struct {
+	leaves  []*codegenLeaf
+	choices map[string]*codegenChoice
+	// What each generated name was made for, to catch two things getting the same name
+	identifiers map[string]string
+	errs        []string
+}
+
+// claim reserves a generated name, reporting it when two different things would share it
+func (g *codegen) claim(identifier string, what string) {
+	if other, exists := g.identifiers[identifier]; exists && other != what {
+		g.errs = append(g.errs, fmt.Sprintf("%s and %s would both be called %s", other, what, identifier))
+		return
+	}
+	g.identifiers[identifier] = what
+}
+
+func (g *codegen) addLeaves(path []string, options []*discordgo.ApplicationCommandOption) {
+
+	// Commands and groups with subcommands don't take options of their own
+	hasSubcommands := false
+	for _, option := range options {
+		if option.Type == discordgo.ApplicationCommandOptionSubCommand ||
+			option.Type == discordgo.ApplicationCommandOptionSubCommandGroup {
+			hasSubcommands = true
+			g.addLeaves(append(append([]string{}, path...), option.Name), option.Options)
+		}
+	}
+	if hasSubcommands {
+		return
+	}
+
+	var name string
+	for _, part := range path {
+		name += GoIdentifier(part)
+	}
+	display := "/" + strings.Join(path, " ")
+	leaf := &codegenLeaf{Path: path, Struct: name + "Options", Parse: "Parse" + name + "Options", Display: display}
+	g.claim(leaf.Struct, display)
+	g.claim(leaf.Parse, display)
+
+	for _, option := range options {
+		goType, known := codegenGoTypes[option.Type]
+		if !known {
+			g.errs = append(g.errs, fmt.Sprintf("%s option %s has unknown type %d", display, option.Name, option.Type))
+			continue
+		}
+		field := &codegenField{Name: GoIdentifier(option.Name), Option: option.Name, GoType: goType.goType,
+			Getter: goType.getter, Required: option.Required, Comment: goType.comment}
+		if len(option.Choices) > 0 {
+			field.Choice = g.addChoice(path, option, goType.goType)
+			field.GoType = field.Choice.Type
+		}
+		leaf.Fields = append(leaf.Fields, field)
+		leaf.HasOptional = leaf.HasOptional || !option.Required
+	}
+	g.leaves = append(g.leaves, leaf)
+}
+
+// addChoice makes the enum for an option's choices. Options with the same name and choices share
+// one, otherwise the enum is named after the whole path.
+func (g *codegen) addChoice(path []string, option *discordgo.ApplicationCommandOption, base string) *codegenChoice {
+
+	typeName := GoIdentifier(option.Name) + "Choice"
+	if existing, exists := g.choices[typeName]; exists {
+		if reflect.DeepEqual(optionShapes([]*discordgo.ApplicationCommandOption{existing.Option}),
+			optionShapes([]*discordgo.ApplicationCommandOption{option})) {
+			return existing
+		}
+		typeName = ""
+		for _, part := range path {
+			typeName += GoIdentifier(part)
+		}
+		typeName += GoIdentifier(option.Name) + "Choice"
+	}
+
+	where := fmt.Sprintf("/%s %s", strings.Join(path, " "), option.Name)
+	choice := &codegenChoice{Type: typeName, Base: base, Where: where, Option: option}
+	g.claim(typeName, where+" choices")
+	prefix := strings.TrimSuffix(typeName, "Choice")
+	for _, c := range option.Choices {
+		constant := &codegenConstant{Name: prefix + GoIdentifier(c.Name), Label: c.Name}
+		switch value := c.Value.(type) {
+		case string:
+			constant.Value = strconv.Quote(value)
+		case float64:
+			constant.Value = strconv.FormatFloat(value, 'f', -1, 64)
+		default:
+			constant.Value = fmt.Sprint(value)
+		}
+		g.claim(constant.Name, fmt.Sprintf("choice %s of %s", c.Name, where))
+		choice.Constants = append(choice.Constants, constant)
+	}
+	g.choices[typeName] = choice
+	return choice
+}
+
+var codegenTemplate = template.Must(template.New("options").Funcs(template.FuncMap{
+	"quote": strconv.Quote,
+	"join":  strings.Join,
+}).Parse(`// Code generated by slash_commands generate. DO NOT EDIT.
+
+package {{ .Package }}
+
+import (
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+)
+{{ range .Choices }}
+// {{ .Type }} is a choice of {{ .Where }}
+type {{ .Type }} {{ .Base }}
+
+const (
+{{- $type := .Type }}
+{{- range .Constants }}
+	{{ .Name }} {{ $type }} = {{ .Value }} // {{ .Label }}
+{{- end }}
+)
+
+// Valid says whether c is one of the choices
+func (c {{ .Type }}) Valid() bool {
+	switch c {
+	case {{ range $i, $c := .Constants }}{{ if $i }}, {{ end }}{{ $c.Name }}{{ end }}:
+		return true
+	}
+	return false
+}
+{{ end }}
+{{- range .Leaves }}
+// {{ .Struct }} are the options of {{ .Display }}{{ if .HasOptional }}. Optional options are nil when they weren't given.{{ end }}
+{{- if .Fields }}
+type {{ .Struct }} struct {
+{{- range .Fields }}
+	{{ .Name }} {{ if not .Required }}*{{ end }}{{ .GoType }}{{ if .Comment }} // {{ .Comment }}{{ end }}
+{{- end }}
+}
+{{- else }}
+type {{ .Struct }} struct{}
+{{- end }}
+
+// {{ .Parse }} reads the options of {{ .Display }} from the interaction
+func {{ .Parse }}(data discordgo.ApplicationCommandInteractionData) (*{{ .Struct }}, error) {
+	{{ if .Fields }}options{{ else }}_{{ end }}, err := commandOptions(data{{ range .Path }}, {{ quote . }}{{ end }})
+	if err != nil {
+		return nil, err
+	}
+	parsed := {{ .Struct }}{}
+{{- $display := .Display }}
+{{- range .Fields }}
+	if option := findOption(options, {{ quote .Option }}); option != nil {
+		value, err := {{ .Getter }}(option)
+		if err != nil {
+			return nil, err
+		}
+{{- if .Choice }}
+		choice := {{ .Choice.Type }}(value)
+		if !choice.Valid() {
+			return nil, fmt.Errorf("{{ $display }} option {{ .Option }} is not one of its choices: %v", value)
+		}
+		parsed.{{ .Name }} = {{ if not .Required }}&{{ end }}choice
+{{- else }}
+		parsed.{{ .Name }} = {{ if not .Required }}&{{ end }}value
+{{- end }}
+	}{{ if .Required }} else {
+		return nil, fmt.Errorf("{{ $display }} is missing required option {{ .Option }}")
+	}{{ end }}
+{{- end }}
+	return &parsed, nil
+}
+{{ end }}
+// commandOptions checks the interaction is for the command at path, and returns the options given to it
+func commandOptions(data discordgo.ApplicationCommandInteractionData, path ...string) ([]*discordgo.ApplicationCommandInteractionDataOption, error) {
+	if data.Name != path[0] {
+		return nil, fmt.Errorf("interaction is for /%s, not /%s", data.Name, path[0])
+	}
+	options := data.Options
+	for _, name := range path[1:] {
+		option := findOption(options, name)
+		if option == nil || (option.Type != discordgo.ApplicationCommandOptionSubCommand &&
+			option.Type != discordgo.ApplicationCommandOptionSubCommandGroup) {
+			return nil, fmt.Errorf("interaction is not for subcommand %s of /%s", name, data.Name)
+		}
+		options = option.Options
+	}
+	return options, nil
+}
+
+func findOption(options []*discordgo.ApplicationCommandInteractionDataOption, name string) *discordgo.ApplicationCommandInteractionDataOption {
+	for _, option := range options {
+		if option.Name == name {
+			return option
+		}
+	}
+	return nil
+}
+
+func stringOption(option *discordgo.ApplicationCommandInteractionDataOption) (string, error) {
+	value, ok := option.Value.(string)
+	if !ok {
+		return "", fmt.Errorf("option %s is %T, not a string", option.Name, option.Value)
+	}
+	return value, nil
+}
+
+// intOption reads an integer, which arrives as a JSON number like any other
+func intOption(option *discordgo.ApplicationCommandInteractionDataOption) (int64, error) {
+	value, ok := option.Value.(float64)
+	if !ok || value != float64(int64(value)) {
+		return 0, fmt.Errorf("option %s is %v, not an integer", option.Name, option.Value)
+	}
+	return int64(value), nil
+}
+
+func floatOption(option *discordgo.ApplicationCommandInteractionDataOption) (float64, error) {
+	value, ok := option.Value.(float64)
+	if !ok {
+		return 0, fmt.Errorf("option %s is %T, not a number", option.Name, option.Value)
+	}
+	return value, nil
+}
+
+func boolOption(option *discordgo.ApplicationCommandInteractionDataOption) (bool, error) {
+	value, ok := option.Value.(bool)
+	if !ok {
+		return false, fmt.Errorf("option %s is %T, not a boolean", option.Name, option.Value)
+	}
+	return value, nil
+}
+`))
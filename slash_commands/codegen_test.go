@@ -0,0 +1,98 @@
+package main
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestGoIdentifier(t *testing.T) {
+	cases := map[string]string{
+		"only_smol":   "OnlySmol",
+		"helloworld":  "Helloworld",
+		"Speed run":   "SpeedRun",
+		"8ball":       "X8ball",
+		"high-five":   "HighFive",
+		"Report User": "ReportUser",
+	}
+	for name, expected := range cases {
+		if identifier := GoIdentifier(name); identifier != expected {
+			t.Errorf("Expected %s to become %s, got %s", name, expected, identifier)
+		}
+	}
+}
+
+func TestGenerateOptionTypes(t *testing.T) {
+	yml := loadTestYAML(t, "codegen/games.yml")
+	commands, err := codegenCommands(allCommands(&yml))
+	if err != nil {
+		t.Fatalf("Unable to list commands: %s", err.Error())
+	}
+	body, err := GenerateOptionTypes(commands, "main")
+	if err != nil {
+		t.Fatalf("Unable to generate code: %s", err.Error())
+	}
+	code := string(body)
+
+	expected := []string{
+		// A struct for each subcommand, with optional options as pointers
+		"type GameStartOptions struct {\n\tMode     ModeChoice\n\tRounds   *RoundsChoice\n\tOpponent *string // ID of the user\n}",
+		"type GameSettingsTimeoutOptions struct {\n\tSeconds float64\n}",
+		"func ParseGameStartOptions(data discordgo.ApplicationCommandInteractionData) (*GameStartOptions, error) {",
+		`commandOptions(data, "game", "settings", "timeout")`,
+		// Choices become typed constants
+		"type RoundsChoice int64",
+		"RoundsThree RoundsChoice = 3 // Three",
+		`ModeSpeedRun ModeChoice = "speed_run" // Speed run`,
+		// A second mode option with other choices gets a type named after its command
+		`RaceModeSprint RaceModeChoice = "sprint" // Sprint`,
+	}
+	for _, snippet := range expected {
+		if !strings.Contains(code, snippet) {
+			t.Errorf("Expected the generated code to contain:\n%s\n\ngot:\n%s", snippet, code)
+		}
+	}
+
+	// Commands and groups with subcommands, and context menu commands, have no options of their own
+	for _, name := range []string{"GameOptions", "GameSettingsOptions", "ChallengeOptions"} {
+		if strings.Contains(code, "type "+name) {
+			t.Errorf("Expected no %s", name)
+		}
+	}
+}
+
+func TestGenerateOptionTypesRejectsClashingNames(t *testing.T) {
+	commands := []*discordgo.ApplicationCommand{
+		{Type: discordgo.ChatApplicationCommand, Name: "high-five", Description: "Give someone a high five"},
+		{Type: discordgo.ChatApplicationCommand, Name: "high_five", Description: "Give someone a high five"},
+	}
+	_, err := GenerateOptionTypes(commands, "main")
+	if err == nil || !strings.Contains(err.Error(), "/high-five and /high_five would both be called HighFiveOptions") {
+		t.Errorf("Expected the clash to be reported, got %v", err)
+	}
+
+	// The same command deployed in several places has to have the same options everywhere
+	other := *commands[0]
+	other.Options = []*discordgo.ApplicationCommandOption{{Type: discordgo.ApplicationCommandOptionUser,
+		Name: "friend", Description: "Who to high five"}}
+	if _, err = codegenCommands(commands[:1], []*discordgo.ApplicationCommand{&other}); err == nil {
+		t.Errorf("Expected a command with two sets of options to be rejected")
+	}
+}
+
+func TestGeneratedCodeIsUpToDate(t *testing.T) {
+	// CI runs the tests, so it fails when commands.yml changes without go generate being run
+	code, _ := runTestCLI("generate", "-check", "-input", "commands.yml", "-output", "../interactor/commands_gen.go")
+	if code != ExitOK {
+		t.Fatalf("interactor/commands_gen.go is out of date, run go generate ./interactor/...")
+	}
+
+	stale := t.TempDir() + "/commands_gen.go"
+	if err := os.WriteFile(stale, []byte("package main\n"), 0644); err != nil {
+		t.Fatalf("Unable to write file: %s", err.Error())
+	}
+	if code, _ = runTestCLI("generate", "-check", "-input", "commands.yml", "-output", stale); code != ExitStale {
+		t.Errorf("Expected stale code to exit with %d, got %d", ExitStale, code)
+	}
+}
@@ -0,0 +1,561 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"html/template"
+	"strings"
+)
+
+const FormatMarkdown = "markdown"
+const FormatHTML = "html"
+
+// docsHeader marks the reference pages as generated, in a comment that Markdown and HTML both hide
+const docsHeader = "<!-- Code generated by slash_commands docs. DO NOT EDIT. -->"
+
+// docContextNames say where a command can be used, for people rather than for commands.yml
+var docContextNames = map[discordgo.InteractionContextType]string{
+	discordgo.InteractionContextGuild:          "servers",
+	discordgo.InteractionContextBotDM:          "DMs with saluki",
+	discordgo.InteractionContextPrivateChannel: "group DMs and DMs with other users",
+}
+
+var docIntegrationTypeNames = map[discordgo.ApplicationIntegrationType]string{
+	discordgo.ApplicationIntegrationGuildInstall: "added to a server",
+	discordgo.ApplicationIntegrationUserInstall:  "added to a user's account",
+}
+
+// docPage is the whole reference, with a section for global commands and one for each guild group
+type docPage struct {
+	Header string
+	Title  string
+	Scopes []*docScope
+}
+
+type docScope struct {
+	Title    string
+	Note     string
+	Commands []*docCommand
+}
+
+// docCommand is a command, or a subcommand beneath one, as the reference shows it
+type docCommand struct {
+	Path        string
+	Anchor      string
+	Kind        string
+	Description string
+	// Where the command is used from, for context menu commands
+	Usage string
+	// Subcommands beneath a command, indented by depth
+	Tree []*docTreeItem
+	// Only set for top level commands, since subcommands share them
+	Facts        []docFact
+	Options      []*docOption
+	Locales      []string
+	Translations []*docTranslation
+	Subcommands  []*docCommand
+}
+
+type docTreeItem struct {
+	Depth       int
+	Path        string
+	Anchor      string
+	Description string
+}
+
+type docFact struct {
+	Name  string
+	Value string
+}
+
+type docOption struct {
+	Name        string
+	Type        string
+	Required    bool
+	Description string
+	Details     []string
+}
+
+// docString is a name and description that can be translated
+type docString struct {
+	name                     string
+	nameLocalizations        map[discordgo.Locale]string
+	descriptionLocalizations map[discordgo.Locale]string
+}
+
+func commandDocString(command *discordgo.ApplicationCommand) docString {
+	text := docString{name: command.Name}
+	if command.NameLocalizations != nil {
+		text.nameLocalizations = *command.NameLocalizations
+	}
+	if command.DescriptionLocalizations != nil {
+		text.descriptionLocalizations = *command.DescriptionLocalizations
+	}
+	return text
+}
+
+func optionDocStrings(options []*discordgo.ApplicationCommandOption) []docString {
+	var texts []docString
+	for _, option := range options {
+		texts = append(texts, docString{option.Name, option.NameLocalizations, option.DescriptionLocalizations})
+	}
+	return texts
+}
+
+// docTranslation is the translations of one name and description, in the order of the section's locales
+type docTranslation struct {
+	What  string
+	Texts []string
+}
+
+// buildDocs lays out the reference for yml, which should already have its environment applied
+func buildDocs(yml *AppCmdYml) *docPage {
+
+	page := &docPage{Header: docsHeader, Title: "saluki commands"}
+	anchors := make(map[string]int)
+
+	global := &docScope{Title: "Commands", Note: "These commands are registered in every server saluki is in."}
+	for _, command := range yml.Commands {
+		global.Commands = append(global.Commands, docForCommand(command, anchors))
+	}
+	if len(global.Commands) > 0 {
+		page.Scopes = append(page.Scopes, global)
+	}
+
+	for _, group := range yml.Guilds {
+		if len(group.Commands) == 0 {
+			continue
+		}
+		scope := &docScope{Title: "Commands in " + pluralise(len(group.GuildIds), "guild", "guilds") + " " +
+			strings.Join(group.GuildIds, ", "),
+			Note: "These commands are only registered in the guilds listed, usually while they are being tried out."}
+		for _, command := range group.Commands {
+			scope.Commands = append(scope.Commands, docForCommand(command, anchors))
+		}
+		page.Scopes = append(page.Scopes, scope)
+	}
+	return page
+}
+
+func pluralise(n int, one string, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
+
+// docAnchor turns a path into an anchor, numbering anchors that were already taken
+func docAnchor(path string, anchors map[string]int) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(path) {
+		switch {
+		case r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_':
+			b.WriteRune(r)
+		case r == ' ' || r == '-':
+			b.WriteRune('-')
+		}
+	}
+	anchor := strings.Trim(b.String(), "-")
+	anchors[anchor] += 1
+	if anchors[anchor] > 1 {
+		anchor = fmt.Sprintf("%s-%d", anchor, anchors[anchor])
+	}
+	return anchor
+}
+
+func docForCommand(command *discordgo.ApplicationCommand, anchors map[string]int) *docCommand {
+
+	doc := &docCommand{Path: command.Name, Description: command.Description}
+	switch command.Type {
+	case discordgo.UserApplicationCommand:
+		doc.Kind = "User command"
+		doc.Usage = "Right-click a user, then Apps > " + command.Name
+	case discordgo.MessageApplicationCommand:
+		doc.Kind = "Message command"
+		doc.Usage = "Right-click a message, then Apps > " + command.Name
+	default:
+		doc.Kind = "Slash command"
+		doc.Path = "/" + command.Name
+	}
+	doc.Anchor = docAnchor(doc.Path, anchors)
+	doc.Facts = docFacts(command)
+
+	texts := []docString{commandDocString(command)}
+	if !hasSubcommands(command.Options) {
+		doc.Options = docOptions(command.Options)
+		texts = append(texts, optionDocStrings(command.Options)...)
+	}
+	doc.Locales, doc.Translations = docTranslations(doc.Path, texts)
+
+	for _, option := range command.Options {
+		if option.Type == discordgo.ApplicationCommandOptionSubCommand || option.Type == discordgo.ApplicationCommandOptionSubCommandGroup {
+			doc.addSubcommand(doc.Path, option, 0, anchors)
+		}
+	}
+	return doc
+}
+
+// addSubcommand adds option to the tree of doc, with a section of its own unless it is a group
+func (doc *docCommand) addSubcommand(parent string, option *discordgo.ApplicationCommandOption, depth int, anchors map[string]int) {
+
+	path := parent + " " + option.Name
+	item := &docTreeItem{Depth: depth, Path: path, Description: option.Description}
+	doc.Tree = append(doc.Tree, item)
+
+	if option.Type == discordgo.ApplicationCommandOptionSubCommandGroup {
+		for _, sub := range option.Options {
+			doc.addSubcommand(path, sub, depth+1, anchors)
+		}
+		return
+	}
+
+	sub := &docCommand{Path: path, Kind: "Subcommand", Description: option.Description, Options: docOptions(option.Options)}
+	sub.Anchor = docAnchor(path, anchors)
+	item.Anchor = sub.Anchor
+	texts := optionDocStrings([]*discordgo.ApplicationCommandOption{option})
+	texts = append(texts, optionDocStrings(option.Options)...)
+	sub.Locales, sub.Translations = docTranslations(path, texts)
+	doc.Subcommands = append(doc.Subcommands, sub)
+}
+
+func hasSubcommands(options []*discordgo.ApplicationCommandOption) bool {
+	for _, option := range options {
+		if option.Type == discordgo.ApplicationCommandOptionSubCommand || option.Type == discordgo.ApplicationCommandOptionSubCommandGroup {
+			return true
+		}
+	}
+	return false
+}
+
+// docFacts says who can use a command, and where
+func docFacts(command *discordgo.ApplicationCommand) []docFact {
+
+	permissions := "Everyone"
+	if command.DefaultMemberPermissions != nil {
+		permissions = "Administrators only"
+		if names := PermissionNamesOf(*command.DefaultMemberPermissions); len(names) > 0 {
+			for i, name := range names {
+				names[i] = spacedWords(name)
+			}
+			permissions = "Members with " + strings.Join(names, ", ")
+		}
+	}
+	facts := []docFact{{"Permissions", permissions}}
+
+	if command.Contexts != nil {
+		var places []string
+		for _, context := range *command.Contexts {
+			places = append(places, docContextNames[context])
+		}
+		facts = append(facts, docFact{"Available in", strings.Join(places, ", ")})
+	} else if command.DMPermission != nil && !*command.DMPermission {
+		facts = append(facts, docFact{"Available in", docContextNames[discordgo.InteractionContextGuild]})
+	}
+	if command.IntegrationTypes != nil {
+		var installs []string
+		for _, integration := range *command.IntegrationTypes {
+			installs = append(installs, docIntegrationTypeNames[integration])
+		}
+		facts = append(facts, docFact{"Shows up when saluki is", strings.Join(installs, " or ")})
+	}
+	if command.NSFW != nil && *command.NSFW {
+		facts = append(facts, docFact{"Age-restricted", "Only in age-restricted channels"})
+	}
+	return facts
+}
+
+// spacedWords splits a PascalCase permission name, such as ManageGuild, into words
+func spacedWords(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if i > 0 && r >= 'A' && r <= 'Z' {
+			b.WriteRune(' ')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func docOptions(options []*discordgo.ApplicationCommandOption) []*docOption {
+	var docs []*docOption
+	for _, option := range options {
+		doc := &docOption{Name: option.Name, Type: OptionTypeNames[option.Type], Required: option.Required,
+			Description: option.Description}
+
+		if len(option.Choices) > 0 {
+			var choices []string
+			for _, choice := range option.Choices {
+				choices = append(choices, choice.Name)
+			}
+			doc.Details = append(doc.Details, "Choices: "+strings.Join(choices, ", "))
+		}
+		if option.Autocomplete {
+			doc.Details = append(doc.Details, "Suggests values as you type")
+		}
+		if option.MinValue != nil || option.MaxValue != 0 {
+			doc.Details = append(doc.Details, docRange("Value", option.MinValue, option.MaxValue))
+		}
+		if option.MinLength != nil || option.MaxLength != 0 {
+			var minLength *float64
+			if option.MinLength != nil {
+				length := float64(*option.MinLength)
+				minLength = &length
+			}
+			doc.Details = append(doc.Details, docRange("Length", minLength, float64(option.MaxLength)))
+		}
+		if len(option.ChannelTypes) > 0 {
+			var types []string
+			for _, channelType := range option.ChannelTypes {
+				types = append(types, ChannelTypeNames[channelType])
+			}
+			doc.Details = append(doc.Details, "Channels: "+strings.Join(types, ", "))
+		}
+		docs = append(docs, doc)
+	}
+	return docs
+}
+
+func docRange(what string, min *float64, max float64) string {
+	switch {
+	case min != nil && max != 0:
+		return fmt.Sprintf("%s: %v to %v", what, *min, max)
+	case min != nil:
+		return fmt.Sprintf("%s: at least %v", what, *min)
+	}
+	return fmt.Sprintf("%s: at most %v", what, max)
+}
+
+// docTranslations lays out the translations of strings with a column per locale, leaving
+// them out altogether when nothing is translated
+func docTranslations(path string, texts []docString) ([]string, []*docTranslation) {
+
+	found := make(map[discordgo.Locale]string)
+	for _, text := range texts {
+		for locale := range text.nameLocalizations {
+			found[locale] = ""
+		}
+		for locale := range text.descriptionLocalizations {
+			found[locale] = ""
+		}
+	}
+	if len(found) == 0 {
+		return nil, nil
+	}
+	locales := sortedLocales(found)
+	var headers []string
+	for _, locale := range locales {
+		headers = append(headers, fmt.Sprintf("%s (%s)", discordgo.Locales[locale], string(locale)))
+	}
+
+	var translations []*docTranslation
+	for i, text := range texts {
+		what := text.name
+		if i == 0 {
+			what = path
+		}
+		translation := &docTranslation{What: what}
+		for _, locale := range locales {
+			name, description := text.nameLocalizations[locale], text.descriptionLocalizations[locale]
+			if len(name) > 0 && len(description) > 0 {
+				translation.Texts = append(translation.Texts, name+": "+description)
+			} else {
+				translation.Texts = append(translation.Texts, name+description)
+			}
+		}
+		translations = append(translations, translation)
+	}
+	return headers, translations
+}
+
+// GenerateMarkdownDocs writes the command reference as Markdown
+func GenerateMarkdownDocs(yml *AppCmdYml) []byte {
+
+	page := buildDocs(yml)
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n\n# %s\n", page.Header, page.Title)
+	if len(page.Scopes) == 0 {
+		b.WriteString("\nThere are no commands yet.\n")
+	}
+
+	for _, scope := range page.Scopes {
+		fmt.Fprintf(&b, "\n## %s\n\n%s\n\n", scope.Title, scope.Note)
+		for _, command := range scope.Commands {
+			fmt.Fprintf(&b, "* [%s](#%s)", markdownText(command.Path), command.Anchor)
+			if len(command.Description) > 0 {
+				fmt.Fprintf(&b, ": %s", markdownText(command.Description))
+			}
+			b.WriteString("\n")
+		}
+		for _, command := range scope.Commands {
+			writeMarkdownCommand(&b, command, "###")
+			for _, sub := range command.Subcommands {
+				writeMarkdownCommand(&b, sub, "####")
+			}
+		}
+	}
+	return []byte(b.String())
+}
+
+func writeMarkdownCommand(b *strings.Builder, command *docCommand, heading string) {
+
+	fmt.Fprintf(b, "\n<a id=\"%s\"></a>\n%s %s\n\n_%s_", command.Anchor, heading, markdownText(command.Path), command.Kind)
+	if len(command.Description) > 0 {
+		fmt.Fprintf(b, ": %s", markdownText(command.Description))
+	}
+	b.WriteString("\n")
+	if len(command.Usage) > 0 {
+		fmt.Fprintf(b, "\n%s\n", markdownText(command.Usage))
+	}
+
+	if len(command.Facts) > 0 {
+		b.WriteString("\n")
+		for _, fact := range command.Facts {
+			fmt.Fprintf(b, "* **%s:** %s\n", fact.Name, markdownText(fact.Value))
+		}
+	}
+
+	if len(command.Tree) > 0 {
+		b.WriteString("\nSubcommands:\n\n")
+		for _, item := range command.Tree {
+			indent := strings.Repeat("  ", item.Depth)
+			if len(item.Anchor) > 0 {
+				fmt.Fprintf(b, "%s* [%s](#%s): %s\n", indent, markdownText(item.Path), item.Anchor, markdownText(item.Description))
+			} else {
+				fmt.Fprintf(b, "%s* %s: %s\n", indent, markdownText(item.Path), markdownText(item.Description))
+			}
+		}
+	}
+
+	if len(command.Options) > 0 {
+		b.WriteString("\n| Option | Type | Required | Description |\n| --- | --- | --- | --- |\n")
+		for _, option := range command.Options {
+			required := "No"
+			if option.Required {
+				required = "Yes"
+			}
+			description := markdownCell(option.Description)
+			for _, detail := range option.Details {
+				description += "<br>" + markdownCell(detail)
+			}
+			fmt.Fprintf(b, "| `%s` | %s | %s | %s |\n", option.Name, option.Type, required, description)
+		}
+	}
+
+	if len(command.Translations) > 0 {
+		var headers []string
+		for _, locale := range command.Locales {
+			headers = append(headers, markdownCell(locale))
+		}
+		b.WriteString("\n| Translations | " + strings.Join(headers, " | ") + " |\n")
+		b.WriteString("| --- |" + strings.Repeat(" --- |", len(command.Locales)) + "\n")
+		for _, translation := range command.Translations {
+			var cells []string
+			for _, text := range translation.Texts {
+				cells = append(cells, markdownCell(text))
+			}
+			fmt.Fprintf(b, "| %s | %s |\n", markdownCell(translation.What), strings.Join(cells, " | "))
+		}
+	}
+}
+
+// markdownText escapes the characters that would otherwise start formatting
+func markdownText(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`, "<", "&lt;", ">", "&gt;")
+	return replacer.Replace(s)
+}
+
+func markdownCell(s string) string {
+	return strings.ReplaceAll(markdownText(s), "|", `\|`)
+}
+
+var docsHTMLTemplate = template.Must(template.New("docs").Parse(`<!DOCTYPE html>
+{{ .Header }}
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{ .Title }}</title>
+<style>
+body { font-family: sans-serif; max-width: 60em; margin: 2em auto; padding: 0 1em; line-height: 1.5; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; vertical-align: top; }
+.kind { color: #666; font-style: italic; }
+.details { color: #444; font-size: 0.9em; }
+</style>
+</head>
+<body>
+<h1>{{ .Title }}</h1>
+{{- if not .Scopes }}
+<p>There are no commands yet.</p>
+{{- end }}
+{{- range .Scopes }}
+<h2>{{ .Title }}</h2>
+<p>{{ .Note }}</p>
+<ul>
+{{- range .Commands }}
+<li><a href="#{{ .Anchor }}">{{ .Path }}</a>{{ if .Description }}: {{ .Description }}{{ end }}</li>
+{{- end }}
+</ul>
+{{- range .Commands }}
+{{ template "command" . }}
+{{- range .Subcommands }}
+{{ template "command" . }}
+{{- end }}
+{{- end }}
+{{- end }}
+</body>
+</html>
+{{ define "command" -}}
+<section id="{{ .Anchor }}">
+{{ if eq .Kind "Subcommand" }}<h4>{{ .Path }}</h4>{{ else }}<h3>{{ .Path }}</h3>{{ end }}
+<p><span class="kind">{{ .Kind }}</span>{{ if .Description }}: {{ .Description }}{{ end }}</p>
+{{- if .Usage }}
+<p>{{ .Usage }}</p>
+{{- end }}
+{{- if .Facts }}
+<ul>
+{{- range .Facts }}
+<li><strong>{{ .Name }}:</strong> {{ .Value }}</li>
+{{- end }}
+</ul>
+{{- end }}
+{{- if .Tree }}
+<p>Subcommands:</p>
+<ul>
+{{- range .Tree }}
+<li style="margin-left: {{ .Depth }}.5em">{{ if .Anchor }}<a href="#{{ .Anchor }}">{{ .Path }}</a>{{ else }}{{ .Path }}{{ end }}: {{ .Description }}</li>
+{{- end }}
+</ul>
+{{- end }}
+{{- if .Options }}
+<table>
+<tr><th>Option</th><th>Type</th><th>Required</th><th>Description</th></tr>
+{{- range .Options }}
+<tr><td><code>{{ .Name }}</code></td><td>{{ .Type }}</td><td>{{ if .Required }}Yes{{ else }}No{{ end }}</td><td>{{ .Description }}{{ range .Details }}<br><span class="details">{{ . }}</span>{{ end }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+{{- if .Translations }}
+<table>
+<tr><th>Translations</th>{{ range .Locales }}<th>{{ . }}</th>{{ end }}</tr>
+{{- range .Translations }}
+<tr><td>{{ .What }}</td>{{ range .Texts }}<td>{{ . }}</td>{{ end }}</tr>
+{{- end }}
+</table>
+{{- end }}
+</section>
+{{- end }}
+`))
+
+// GenerateHTMLDocs writes the command reference as a standalone HTML page
+func GenerateHTMLDocs(yml *AppCmdYml) ([]byte, error) {
+	var b bytes.Buffer
+	page := buildDocs(yml)
+	if err := docsHTMLTemplate.Execute(&b, struct {
+		*docPage
+		Header template.HTML
+	}{page, template.HTML(page.Header)}); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
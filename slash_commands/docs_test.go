@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestGenerateMarkdownDocs(t *testing.T) {
+	yml := loadTestYAML(t, "codegen/games.yml")
+	docs := string(GenerateMarkdownDocs(&yml))
+
+	expected := []string{
+		"<!-- Code generated by slash_commands docs. DO NOT EDIT. -->",
+		// The command tree links to each subcommand, and groups are indented beneath
+		"* [/game start](#game-start): Start a game in this channel\n* /game settings: Change how games are run\n" +
+			"  * [/game settings timeout](#game-settings-timeout): Set how long a turn can last",
+		// Options with their types, whether they're required, and their choices
+		"| `mode` | string | Yes | What kind of game to play<br>Choices: Classic, Speed run |",
+		"| `opponent` | user | No | Who to play against |",
+		"### Challenge\n\n_User command_\n\nRight-click a user, then Apps &gt; Challenge",
+	}
+	for _, snippet := range expected {
+		if !strings.Contains(docs, snippet) {
+			t.Errorf("Expected the docs to contain:\n%s\n\ngot:\n%s", snippet, docs)
+		}
+	}
+}
+
+func TestDocsShowPermissionsAndTranslations(t *testing.T) {
+	yml := loadTestYAML(t, "valid/admin_commands.yml")
+	docs := string(GenerateMarkdownDocs(&yml))
+	for _, snippet := range []string{
+		"* **Permissions:** Members with Ban Members, Moderate Members\n* **Available in:** servers",
+		"* **Available in:** servers, DMs with saluki, group DMs and DMs with other users",
+		"* **Age-restricted:** Only in age-restricted channels",
+		"## Commands in guild 123456789012345678",
+		"### /lockdown\n\n_Slash command_: Stop anyone but moderators from starting games\n\n* **Permissions:** Administrators only",
+	} {
+		if !strings.Contains(docs, snippet) {
+			t.Errorf("Expected the docs to contain:\n%s\n\ngot:\n%s", snippet, docs)
+		}
+	}
+
+	yml = loadTestYAML(t, "valid/localized_commands.yml")
+	docs = string(GenerateMarkdownDocs(&yml))
+	if !strings.Contains(docs, "| Translations | German (de) | French (fr) |\n| --- | --- | --- |\n"+
+		"| /blep | blep: Sende ein zufälliges, niedliches Tierfoto | blep: Envoie une photo d'animal adorable au hasard |") {
+		t.Errorf("Expected a column of translations per locale, got:\n%s", docs)
+	}
+}
+
+func TestGenerateHTMLDocsEscapes(t *testing.T) {
+	yml := loadTestYAML(t, "codegen/games.yml")
+	yml.Commands[1].Description = "Start a <race>"
+	docs, err := GenerateHTMLDocs(&yml)
+	if err != nil {
+		t.Fatalf("Unable to generate docs: %s", err.Error())
+	}
+	for _, snippet := range []string{
+		`<section id="game-settings-timeout">`,
+		"<h4>/game settings timeout</h4>",
+		"Start a &lt;race&gt;",
+		"<tr><td><code>seconds</code></td><td>number</td><td>Yes</td><td>Seconds per turn</td></tr>",
+	} {
+		if !strings.Contains(string(docs), snippet) {
+			t.Errorf("Expected the docs to contain:\n%s\n\ngot:\n%s", snippet, docs)
+		}
+	}
+}
+
+func TestDocsAreUpToDate(t *testing.T) {
+	for _, format := range []string{FormatMarkdown, FormatHTML} {
+		output := "docs/commands.md"
+		if format == FormatHTML {
+			output = "docs/commands.html"
+		}
+		if code, _ := runTestCLI("docs", "-check", "-env=", "-format", format, "-input", "commands.yml", "-output", output); code != ExitOK {
+			t.Errorf("%s is out of date, run go generate ./slash_commands/...", output)
+		}
+	}
+
+	stale := t.TempDir() + "/commands.md"
+	if err := os.WriteFile(stale, []byte("# saluki commands\n"), 0644); err != nil {
+		t.Fatalf("Unable to write file: %s", err.Error())
+	}
+	if code, _ := runTestCLI("docs", "-check", "-input", "commands.yml", "-output", stale); code != ExitStale {
+		t.Errorf("Expected stale docs to exit with %d, got %d", ExitStale, code)
+	}
+}
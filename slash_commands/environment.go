@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"github.com/sirupsen/logrus"
+	"sort"
+	"strings"
+)
+
+// EnvironmentYml changes the commands for a single environment, such as dev or prod.
+// Commands it lists replace just the fields they set on a command of the same type and name,
+// or are added if there isn't one. Hidden commands are left out of the environment entirely.
+type EnvironmentYml struct {
+	DescriptionPrefix string            `yaml:"DescriptionPrefix" json:"DescriptionPrefix,omitempty"`
+	Hide              []string          `yaml:"Hide" json:"Hide,omitempty"`
+	Commands          []*CommandOverlay `yaml:"Commands" json:"Commands,omitempty"`
+	Guilds            []*GuildCmdYml    `yaml:"Guilds" json:"Guilds,omitempty"`
+}
+
+// CommandOverlay is a command as written in an environment, keeping only the fields it sets
+type CommandOverlay struct {
+	raw json.RawMessage
+}
+
+func (o *CommandOverlay) UnmarshalJSON(data []byte) error {
+	o.raw = append(json.RawMessage(nil), data...)
+	return nil
+}
+
+func (o *CommandOverlay) MarshalJSON() ([]byte, error) {
+	return o.raw, nil
+}
+
+// fields lists the fields the overlay sets
+func (o *CommandOverlay) fields() (map[string]json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(o.raw, &fields)
+	return fields, err
+}
+
+// applyTo sets the overlay's fields on command, leaving the rest alone.
+// Options are replaced as a whole rather than merged one by one.
+func (o *CommandOverlay) applyTo(command *discordgo.ApplicationCommand) error {
+	fields, err := o.fields()
+	if err != nil {
+		return err
+	}
+	if _, exists := fields["options"]; exists {
+		command.Options = nil
+	}
+	return json.Unmarshal(o.raw, command)
+}
+
+// mergeEnvironment adds the overlay in other to env, for environments split over several files
+func mergeEnvironment(env *EnvironmentYml, other *EnvironmentYml) {
+	if len(other.DescriptionPrefix) > 0 {
+		env.DescriptionPrefix = other.DescriptionPrefix
+	}
+	env.Hide = append(env.Hide, other.Hide...)
+	env.Commands = append(env.Commands, other.Commands...)
+	env.Guilds = append(env.Guilds, other.Guilds...)
+}
+
+// EnvironmentNames lists the environments declared in yml
+func EnvironmentNames(yml *AppCmdYml) []string {
+	var names []string
+	for name := range yml.Environments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ApplyEnvironment changes yml in place to be the commands for the named environment.
+// The result should be validated again, since the environment can break the rules too.
+func ApplyEnvironment(yml *AppCmdYml, name string) error {
+
+	env, exists := yml.Environments[name]
+	if !exists {
+		return errors.New(fmt.Sprintf("environment %q not found, expected one of: %s",
+			name, strings.Join(EnvironmentNames(yml), ", ")))
+	}
+	logrus.Infof("Applying the %s environment", name)
+
+	// Hide commands first, then make sure nothing overrides them, since the override would add them back
+	hidden := make(map[commandKey]string)
+	for _, entry := range env.Hide {
+		key := hiddenKey(entry)
+		hidden[key] = entry
+		found := false
+		yml.Commands, found = hideCommand(yml.Commands, key)
+		for _, group := range yml.Guilds {
+			var inGroup bool
+			group.Commands, inGroup = hideCommand(group.Commands, key)
+			found = found || inGroup
+		}
+		if !found {
+			return errors.New(fmt.Sprintf("environment %s hides command %s, which does not exist", name, entry))
+		}
+	}
+
+	// Override the fields of every command with the same type and name, or add it as a global command
+	for i, overlay := range env.Commands {
+		var target discordgo.ApplicationCommand
+		if err := overlay.applyTo(&target); err != nil {
+			return errors.New(fmt.Sprintf("environment %s command #%d: %s", name, i, err.Error()))
+		}
+		if entry, isHidden := hidden[keyOf(&target)]; isHidden {
+			return errors.New(fmt.Sprintf("environment %s overrides command %s, which it also hides", name, entry))
+		}
+
+		matches := 0
+		for _, command := range allCommands(yml) {
+			if keyOf(command) != keyOf(&target) {
+				continue
+			}
+			if err := overlay.applyTo(command); err != nil {
+				return errors.New(fmt.Sprintf("environment %s command %s: %s", name, target.Name, err.Error()))
+			}
+			yml.source.addOverlay(command, overlay, false)
+			matches += 1
+		}
+		if matches == 0 {
+			added := &target
+			yml.Commands = append(yml.Commands, added)
+			yml.source.addOverlay(added, overlay, true)
+		}
+	}
+	yml.Guilds = append(yml.Guilds, env.Guilds...)
+
+	// Prefix descriptions so it's obvious in Discord which environment a command is from
+	if len(env.DescriptionPrefix) > 0 {
+		for _, command := range allCommands(yml) {
+			if len(command.Description) > 0 {
+				command.Description = env.DescriptionPrefix + command.Description
+			}
+		}
+	}
+	return nil
+}
+
+// hiddenKey is the command a Hide entry names. A plain name is a chat input command, and context menu
+// commands are prefixed with their type, such as "user:Challenge".
+func hiddenKey(entry string) commandKey {
+	if split := strings.Index(entry, ":"); split > 0 {
+		for commandType, typeName := range CommandTypeNames {
+			if entry[:split] == typeName {
+				return commandKey{Type: commandType, Name: entry[split+1:]}
+			}
+		}
+	}
+	return commandKey{Type: discordgo.ChatApplicationCommand, Name: entry}
+}
+
+func hideCommand(commands []*discordgo.ApplicationCommand, key commandKey) ([]*discordgo.ApplicationCommand, bool) {
+	var kept []*discordgo.ApplicationCommand
+	for _, command := range commands {
+		if keyOf(command) != key {
+			kept = append(kept, command)
+		}
+	}
+	return kept, len(kept) != len(commands)
+}
+
+// allCommands lists global commands followed by the commands of every guild group
+func allCommands(yml *AppCmdYml) []*discordgo.ApplicationCommand {
+	commands := append([]*discordgo.ApplicationCommand(nil), yml.Commands...)
+	for _, group := range yml.Guilds {
+		commands = append(commands, group.Commands...)
+	}
+	return commands
+}
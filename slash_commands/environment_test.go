@@ -0,0 +1,132 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyEnvironmentAddsAndOverrides(t *testing.T) {
+	yml := loadTestYAML(t, "environments/dev_and_prod.yml")
+	if err := ApplyEnvironment(&yml, "dev"); err != nil {
+		t.Fatalf("Unable to apply dev environment: %s", err.Error())
+	}
+	if err := ValidCommands(&yml); err != nil {
+		t.Fatalf("Expected dev commands to validate: %s", err.Error())
+	}
+
+	if names := commandNames(yml.Commands); names != "helloworld, blep, debug" {
+		t.Fatalf("Expected debug to be added after the base commands, got %s", names)
+	}
+
+	// Only the fields the overlay sets are replaced
+	blep := yml.Commands[1]
+	if blep.Description != "[DEV] Send a random adorable animal photo" {
+		t.Errorf("Expected blep to keep its description with the dev prefix, got %q", blep.Description)
+	}
+	if len(blep.Options) != 1 || len(blep.Options[0].Choices) != 3 {
+		t.Errorf("Expected blep's options to be replaced with the dev ones, got %v", blep.Options)
+	}
+	if yml.Commands[2].Description != "[DEV] Dump the bot's state" {
+		t.Errorf("Expected added commands to get the prefix too, got %q", yml.Commands[2].Description)
+	}
+
+	if len(yml.Guilds) != 1 || commandNames(yml.Guilds[0].Commands) != "permissions" {
+		t.Errorf("Expected the dev guild group to be added, got %v", yml.Guilds)
+	}
+}
+
+func TestApplyEnvironmentHidesCommands(t *testing.T) {
+	yml := loadTestYAML(t, "environments/dev_and_prod.yml")
+	if err := ApplyEnvironment(&yml, "prod"); err != nil {
+		t.Fatalf("Unable to apply prod environment: %s", err.Error())
+	}
+
+	if names := commandNames(yml.Commands); names != "blep" {
+		t.Errorf("Expected only blep in prod, got %s", names)
+	}
+	if yml.Commands[0].Description != "Send a random adorable animal photo" {
+		t.Errorf("Expected prod to leave descriptions alone, got %q", yml.Commands[0].Description)
+	}
+}
+
+func TestApplyEnvironmentErrors(t *testing.T) {
+	yml := loadTestYAML(t, "environments/dev_and_prod.yml")
+	err := ApplyEnvironment(&yml, "staging")
+	if err == nil || !strings.Contains(err.Error(), "expected one of: dev, prod") {
+		t.Errorf("Expected an unknown environment to list the known ones, got %v", err)
+	}
+
+	yml = loadTestYAML(t, "environments/overlay_breaks_rules.yml")
+	err = ApplyEnvironment(&yml, "prod")
+	if err == nil || !strings.Contains(err.Error(), "hides command helloworld, which does not exist") {
+		t.Errorf("Expected hiding a missing command to fail, got %v", err)
+	}
+}
+
+func TestApplyEnvironmentOverlayOnHiddenCommand(t *testing.T) {
+	// Overriding a hidden command would add it back as a new global command
+	yml := loadTestYAML(t, "environments/overlay_on_hidden.yml")
+	err := ApplyEnvironment(&yml, "prod")
+	if err == nil || !strings.Contains(err.Error(), "overrides command blep, which it also hides") {
+		t.Errorf("Expected overriding a hidden command to fail, got %v", err)
+	}
+
+	// Hiding the user command leaves the chat input command of the same name to be overridden
+	yml = loadTestYAML(t, "environments/overlay_on_hidden.yml")
+	if err = ApplyEnvironment(&yml, "user_only"); err != nil {
+		t.Fatalf("Unable to apply user_only environment: %s", err.Error())
+	}
+	if len(yml.Commands) != 1 || keyOf(yml.Commands[0]) != (commandKey{Type: 1, Name: "blep"}) ||
+		!strings.HasSuffix(yml.Commands[0].Description, "without the Apps menu") {
+		t.Errorf("Expected only the overridden chat input blep to be left, got %v", yml.Commands)
+	}
+}
+
+func TestEnvironmentIsValidatedAfterMerging(t *testing.T) {
+	yml := loadTestYAML(t, "environments/overlay_breaks_rules.yml")
+	if err := ValidCommands(&yml); err != nil {
+		t.Fatalf("Expected the base commands to validate: %s", err.Error())
+	}
+
+	if err := ApplyEnvironment(&yml, "dev"); err != nil {
+		t.Fatalf("Unable to apply dev environment: %s", err.Error())
+	}
+	result := ValidateCommands(&yml)
+
+	expected := []struct {
+		path string
+		rule string
+		line int
+	}{
+		{"blep", RuleDescriptionLength, 4},
+		{"Debug", RuleDescriptionLength, 11},
+		{"Debug", RuleNameNotLowercase, 9},
+	}
+	if len(result.Problems) != len(expected) {
+		for _, problem := range result.Problems {
+			t.Log(problem.String())
+		}
+		t.Fatalf("Expected %d problems, got %s", len(expected), result.Summary())
+	}
+	for i, problem := range result.Problems {
+		if problem.Path != expected[i].path || problem.Rule != expected[i].rule {
+			t.Errorf("Expected %s at %s, got %s", expected[i].rule, expected[i].path, problem)
+		}
+		if problem.Position == nil || problem.Position.Line != expected[i].line {
+			t.Errorf("Expected %s to point at line %d, got %v", problem.Rule, expected[i].line, problem.Position)
+		}
+	}
+}
+
+func TestActualCommandsYMLEnvironments(t *testing.T) {
+	base := loadTestYAML(t, "../commands.yml")
+	for _, name := range EnvironmentNames(&base) {
+		yml := loadTestYAML(t, "../commands.yml")
+		if err := ApplyEnvironment(&yml, name); err != nil {
+			t.Fatalf("Unable to apply %s environment: %s", name, err.Error())
+		}
+		if err := ValidCommands(&yml); err != nil {
+			t.Errorf("Commands for %s are invalid: %s", name, err.Error())
+		}
+	}
+}
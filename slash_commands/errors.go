@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CommandError is a failure to create, edit or delete a single command
+type CommandError struct {
+	Action  SyncAction
+	Name    string
+	ID      string
+	GuildID string
+	Err     error
+}
+
+func (e *CommandError) Error() string {
+	name := e.Name
+	if len(name) == 0 {
+		name = e.ID
+	} else if len(e.ID) > 0 {
+		name = fmt.Sprintf("%s (ID: %s)", e.Name, e.ID)
+	}
+	where := ""
+	if len(e.GuildID) > 0 {
+		where = fmt.Sprintf(" in guild %s", e.GuildID)
+	}
+	return fmt.Sprintf("unable to %s command %s%s: %s", e.Action, name, where, e.Err.Error())
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// CommandErrors is every failure from a run of changes, so none of them are lost
+// behind the last one. errors.Is and errors.As don't look inside a list of errors
+// before Go 1.20, so find it with errors.As and check each of its errors in turn.
+type CommandErrors []error
+
+func (e CommandErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	lines := []string{fmt.Sprintf("%d commands failed:", len(e))}
+	for _, err := range e {
+		lines = append(lines, "  "+err.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// appendErrors adds err to errs, flattening it if it is a list of errors itself
+func appendErrors(errs CommandErrors, err error) CommandErrors {
+	if err == nil {
+		return errs
+	}
+	if list, isList := err.(CommandErrors); isList {
+		return append(errs, list...)
+	}
+	return append(errs, err)
+}
+
+// errorOrNil returns errs as an error, or nil when nothing failed
+func (e CommandErrors) errorOrNil() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
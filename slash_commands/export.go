@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"github.com/sirupsen/logrus"
+)
+
+// ExportCommands fetches the commands registered globally and in each of the guilds, and puts
+// them back together as commands.yml. Guilds with exactly the same commands share a group.
+func ExportCommands(getFn AppCmdsGetFn, appId *string, guildIds []string) (*AppCmdYml, error) {
+
+	logrus.Infof("Exporting global commands")
+	commands, err := getFn(*appId, "")
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve global commands: %w", err)
+	}
+	yml := AppCmdYml{Commands: stripServerFields(commands)}
+
+	groups := make(map[string]*GuildCmdYml)
+	for _, guildId := range guildIds {
+		logrus.Infof("Exporting commands in guild %s", guildId)
+		commands, err = getFn(*appId, guildId)
+		if err != nil {
+			return nil, fmt.Errorf("unable to retrieve commands in guild %s: %w", guildId, err)
+		}
+		if len(commands) == 0 {
+			continue
+		}
+
+		commands = stripServerFields(commands)
+		key, err := json.Marshal(commands)
+		if err != nil {
+			return nil, err
+		}
+		if group, exists := groups[string(key)]; exists {
+			group.GuildIds = append(group.GuildIds, guildId)
+			continue
+		}
+		group := &GuildCmdYml{GuildIds: []string{guildId}, Commands: commands}
+		groups[string(key)] = group
+		yml.Guilds = append(yml.Guilds, group)
+	}
+	return &yml, nil
+}
+
+// stripServerFields copies commands without the fields Discord fills in itself, such as IDs and
+// versions, or that are just Discord's defaults, so they read like they were written by hand
+func stripServerFields(commands []*discordgo.ApplicationCommand) []*discordgo.ApplicationCommand {
+	stripped := []*discordgo.ApplicationCommand{}
+	for _, command := range commands {
+		c := *command
+		c.ID, c.ApplicationID, c.GuildID, c.Version = "", "", "", ""
+		if c.DefaultPermission != nil && *c.DefaultPermission {
+			c.DefaultPermission = nil
+		}
+		if c.DMPermission != nil && *c.DMPermission {
+			c.DMPermission = nil
+		}
+		if c.NSFW != nil && !*c.NSFW {
+			c.NSFW = nil
+		}
+		if c.NameLocalizations != nil && len(*c.NameLocalizations) == 0 {
+			c.NameLocalizations = nil
+		}
+		if c.DescriptionLocalizations != nil && len(*c.DescriptionLocalizations) == 0 {
+			c.DescriptionLocalizations = nil
+		}
+		stripped = append(stripped, &c)
+	}
+	return stripped
+}
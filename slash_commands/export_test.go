@@ -0,0 +1,117 @@
+package main
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"os"
+	"strings"
+	"testing"
+)
+
+// registered fills in the fields Discord adds to a command once it has been registered
+func registered(cmd *discordgo.ApplicationCommand, guildId string) *discordgo.ApplicationCommand {
+	defaultPermission := true
+	cmd.ApplicationID = "1234"
+	cmd.GuildID = guildId
+	cmd.Version = "1001"
+	cmd.DefaultPermission = &defaultPermission
+	return cmd
+}
+
+func TestExportCommandsStripsServerFields(t *testing.T) {
+	m := newMockDiscordApi()
+	m.seed("", registered(liveBlep(), ""))
+	m.seed("123456789012345678", registered(&discordgo.ApplicationCommand{Type: discordgo.UserApplicationCommand,
+		Name: "Say hello"}, "123456789012345678"))
+
+	appId := "1234"
+	yml, err := ExportCommands(m.Get, &appId, []string{"123456789012345678"})
+	if err != nil {
+		t.Fatalf("Unable to export commands: %s", err.Error())
+	}
+
+	if len(yml.Commands) != 1 || len(yml.Guilds) != 1 || len(yml.Guilds[0].Commands) != 1 {
+		t.Fatalf("Expected a global command and a guild group, got %v", yml)
+	}
+	for _, cmd := range allCommands(yml) {
+		if cmd.ID != "" || cmd.ApplicationID != "" || cmd.GuildID != "" || cmd.Version != "" || cmd.DefaultPermission != nil {
+			t.Errorf("Expected server fields to be stripped from %s, got %+v", cmd.Name, cmd)
+		}
+	}
+
+	// The live commands are left alone
+	if m.find("", "blep").ID == "" {
+		t.Errorf("Expected exporting to copy the commands rather than change them")
+	}
+	if m.writes() != 0 {
+		t.Errorf("Expected export to make no write calls, got %v", m.calls)
+	}
+}
+
+func TestExportCommandsGroupsMatchingGuilds(t *testing.T) {
+	m := newMockDiscordApi()
+	m.seed("111111111111111111", registered(liveBlep(), "111111111111111111"))
+	m.seed("222222222222222222", registered(liveBlep(), "222222222222222222"))
+	m.seed("333333333333333333", registered(&discordgo.ApplicationCommand{Type: discordgo.ChatApplicationCommand,
+		Name: "helloworld", Description: "Tests our command architecture"}, "333333333333333333"))
+
+	appId := "1234"
+	yml, err := ExportCommands(m.Get, &appId, []string{"111111111111111111", "222222222222222222",
+		"333333333333333333", "444444444444444444"})
+	if err != nil {
+		t.Fatalf("Unable to export commands: %s", err.Error())
+	}
+
+	// Guilds with no commands are left out
+	if len(yml.Guilds) != 2 || strings.Join(yml.Guilds[0].GuildIds, ",") != "111111111111111111,222222222222222222" {
+		t.Errorf("Expected guilds with the same commands to share a group, got %v", yml.Guilds)
+	}
+}
+
+func TestCLIExportLive(t *testing.T) {
+	m := newMockDiscordApi()
+	useMockDiscord(t, m)
+	m.seed("", registered(liveBlep(), ""))
+	m.seed("123456789012345678", registered(&discordgo.ApplicationCommand{Type: discordgo.ChatApplicationCommand,
+		Name: "helloworld", Description: "Tests our command architecture"}, "123456789012345678"))
+
+	// The guilds to export are taken from commands.yml
+	output := t.TempDir() + "/commands.yml"
+	code, _ := runTestCLI("export", "-live", "-input", testInput(t, "valid/guild_commands.yml"), "-output", output)
+	if code != ExitOK {
+		t.Fatalf("Expected export to succeed, got %d", code)
+	}
+
+	body, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatalf("Unable to read export: %s", err.Error())
+	}
+	for _, field := range []string{"id:", "application_id:", "version:", "guild_id:", "default_permission:"} {
+		if strings.Contains(string(body), field) {
+			t.Errorf("Expected %s to be stripped from the export:\n%s", field, body)
+		}
+	}
+
+	// The export is a valid commands.yml that plans no changes against the live commands
+	yml, err := LoadYAML(output)
+	if err != nil {
+		t.Fatalf("Unable to load export: %s", err.Error())
+	}
+	if err = ValidCommands(&yml); err != nil {
+		t.Errorf("Expected the export to be valid: %s", err.Error())
+	}
+	for _, scope := range CommandScopes(&yml) {
+		live, _ := m.Get("1234", scope.GuildID)
+		if plan := PlanSync(live, scope.Commands, scope.GuildID); !plan.IsEmpty() {
+			t.Errorf("Expected no changes to %s, got:\n%s", scope, FormatPlanText(plan))
+		}
+	}
+}
+
+func TestManifestIsUpToDate(t *testing.T) {
+	// The interactor answers /help from the manifest, so it has to keep up with commands.yml
+	code, _ := runTestCLI("export", "-check", "-env=", "-format", "json", "-input", "commands.yml",
+		"-output", "../interactor/commands_manifest.json")
+	if code != ExitOK {
+		t.Fatalf("interactor/commands_manifest.json is out of date, run go generate ./interactor/...")
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// isYAMLFile checks a file in a commands directory should be loaded
+func isYAMLFile(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return ext == ".yml" || ext == ".yaml"
+}
+
+// loadYAMLPath merges a YAML file, or every YAML file beneath a directory in name order, into yml.
+// Paths already in loaded are skipped, so a file is never merged twice and includes can't loop.
+func loadYAMLPath(path string, yml *AppCmdYml, loaded map[string]struct{}) error {
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("unable to read %s: %w", path, err)
+	}
+	if !info.IsDir() {
+		return loadYAMLFile(path, yml, loaded)
+	}
+
+	var files []string
+	err = filepath.WalkDir(path, func(file string, entry os.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() && isYAMLFile(file) {
+			files = append(files, file)
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("unable to read directory %s: %w", path, err)
+	}
+
+	sort.Strings(files)
+	for _, file := range files {
+		if err = loadYAMLFile(file, yml, loaded); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadYAMLFile(file string, yml *AppCmdYml, loaded map[string]struct{}) error {
+
+	absolute, err := filepath.Abs(file)
+	if err != nil {
+		return fmt.Errorf("unable to build path for %s: %w", file, err)
+	}
+	if _, exists := loaded[absolute]; exists {
+		logrus.Debugf("Skipping %s, it has already been loaded", file)
+		return nil
+	}
+	loaded[absolute] = struct{}{}
+
+	logrus.Debugf("Loading commands from %s", file)
+	yamlFile, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("unable to read %s: %w", file, err)
+	}
+
+	// Decode through the node tree so we can keep hold of line numbers
+	var root yaml.Node
+	part := AppCmdYml{}
+	err = yaml.Unmarshal(yamlFile, &root)
+	if err == nil && root.Kind != 0 {
+		err = checkKnownFields(file, &root)
+	}
+	if err == nil && root.Kind != 0 {
+		err = resolveTypeNames(&root)
+	}
+	if err == nil && root.Kind != 0 {
+		if err = decodeNode(&root, &part); err != nil {
+			err = explainDecodeError(file, &root, err)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("unable to unmarshal %s as YAML: %w", file, err)
+	}
+	yml.source.addFile(file, &root, &part)
+
+	yml.Commands = append(yml.Commands, part.Commands...)
+	yml.Guilds = append(yml.Guilds, part.Guilds...)
+	for name, env := range part.Environments {
+		if existing, exists := yml.Environments[name]; exists {
+			mergeEnvironment(existing, env)
+		} else {
+			if yml.Environments == nil {
+				yml.Environments = make(map[string]*EnvironmentYml)
+			}
+			yml.Environments[name] = env
+		}
+	}
+
+	// Included paths are relative to the file that lists them, and can be globs
+	for _, include := range part.Include {
+		pattern := include
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(file), pattern)
+		}
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil || len(matches) == 0 {
+			return fmt.Errorf("include %q in %s does not match any files", include, file)
+		}
+		for _, match := range matches {
+			if err = loadYAMLPath(match, yml, loaded); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func commandNames(commands []*discordgo.ApplicationCommand) string {
+	var names []string
+	for _, command := range commands {
+		names = append(names, command.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+func TestGetYAMLMergesDirectory(t *testing.T) {
+	yml := loadTestYAML(t, "valid/split_commands")
+
+	// Files are merged in path order, subdirectories included
+	if names := commandNames(yml.Commands); names != "blep, helloworld" {
+		t.Errorf("Expected blep and helloworld to be merged in file order, got %s", names)
+	}
+	if len(yml.Guilds) != 1 || commandNames(yml.Guilds[0].Commands) != "permissions" {
+		t.Errorf("Expected the permissions guild group from beta/permissions.yml, got %v", yml.Guilds)
+	}
+
+	// Positions point at the file each command came from
+	position := yml.source.Position(yml.Commands[1], "name")
+	if position == nil || filepath.Base(position.File) != "helloworld.yml" || position.Line != 2 {
+		t.Errorf("Expected helloworld to point at helloworld.yml:2, got %v", position)
+	}
+}
+
+func TestGetYAMLFollowsIncludes(t *testing.T) {
+	yml := loadTestYAML(t, "valid/included_commands.yml")
+
+	// Includes are merged after the file listing them, and each file is only loaded once,
+	// even though animals/blep.yml includes helloworld.yml again
+	if names := commandNames(yml.Commands); names != "ping, helloworld, blep, boop" {
+		t.Errorf("Expected ping, helloworld, blep and boop, got %s", names)
+	}
+	if len(yml.source.files) != 4 {
+		t.Errorf("Expected 4 files to be loaded, got %v", yml.source.files)
+	}
+	if err := ValidCommands(&yml); err != nil {
+		t.Errorf("Expected included commands to validate: %s", err.Error())
+	}
+}
+
+func TestDuplicateAcrossFilesNamesBothFiles(t *testing.T) {
+	yml := loadTestYAML(t, "invalid/duplicate_command_across_files")
+	result := ValidateCommands(&yml)
+
+	if len(result.Problems) != 1 || result.Problems[0].Rule != RuleCommandNameDuplicate {
+		t.Fatalf("Expected a single %s problem, got %s", RuleCommandNameDuplicate, result.Summary())
+	}
+
+	// animals.yml sorts first, so the copy in blep.yml is the duplicate
+	problem := result.Problems[0].String()
+	if !strings.Contains(problem, "blep.yml:2:5: error") || !strings.Contains(problem, "first declared at ") ||
+		!strings.HasSuffix(problem, "animals.yml:5:5") {
+		t.Errorf("Expected the problem to name both files, got %s", problem)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"io"
+	"sort"
+	"unicode/utf8"
+)
+
+const RuleLocaleUnknown = "locale-unknown"
+
+// IsSupportedLocale checks locale is one Discord accepts in name_localizations and description_localizations
+func IsSupportedLocale(locale discordgo.Locale) bool {
+	_, supported := discordgo.Locales[locale]
+	return supported && locale != discordgo.Unknown
+}
+
+// localizedRule checks a single translated string, returning the rule it broke if it isn't valid
+type localizedRule func(value string) (string, error)
+
+func descriptionRule(description string) (string, error) {
+	return RuleDescriptionLength, ValidateDescription(description)
+}
+
+func contextMenuNameRule(name string) (string, error) {
+	if length := utf8.RuneCountInString(name); length < 1 || length > MaxNameLength {
+		return RuleNameTooLong, errors.New(fmt.Sprintf("name %q must be 1-%d characters", name, MaxNameLength))
+	}
+	return "", nil
+}
+
+func choiceNameRule(name string) (string, error) {
+	if length := utf8.RuneCountInString(name); length < 1 || length > MaxChoiceNameLength {
+		return RuleChoiceNameLength, errors.New(fmt.Sprintf("choice name %q must be 1-%d characters",
+			name, MaxChoiceNameLength))
+	}
+	return "", nil
+}
+
+// validateLocalizations checks every translation of a field is for a locale Discord knows,
+// and follows the same rules as the field itself
+func validateLocalizations(r *ValidationResult, path string, obj interface{}, field string,
+	localizations map[discordgo.Locale]string, rule localizedRule) {
+
+	for _, locale := range sortedLocales(localizations) {
+		if !IsSupportedLocale(locale) {
+			r.addError(RuleLocaleUnknown, path, obj, field, "%s has unknown locale %q", field, string(locale))
+			continue
+		}
+		if broken, err := rule(localizations[locale]); err != nil {
+			r.addError(broken, path, obj, field, "%s[%s]: %s", field, string(locale), err.Error())
+		}
+	}
+}
+
+func sortedLocales(localizations map[discordgo.Locale]string) []discordgo.Locale {
+	var locales []discordgo.Locale
+	for locale := range localizations {
+		locales = append(locales, locale)
+	}
+	sort.Slice(locales, func(i, j int) bool { return locales[i] < locales[j] })
+	return locales
+}
+
+// longestLocalization is the length of the longest of a field's default value and its translations
+func longestLocalization(value string, localizations map[discordgo.Locale]string) int {
+	longest := utf8.RuneCountInString(value)
+	for _, localized := range localizations {
+		if length := utf8.RuneCountInString(localized); length > longest {
+			longest = length
+		}
+	}
+	return longest
+}
+
+// LocaleCoverage is how much of commands.yml has been translated into a single locale.
+// Missing lists each untranslated string by its path and field, for example "blep > animal: description".
+type LocaleCoverage struct {
+	Locale     discordgo.Locale `json:"locale"`
+	Translated int              `json:"translated"`
+	Total      int              `json:"total"`
+	Missing    []string         `json:"missing,omitempty"`
+}
+
+// localizedString is a name or description that can be translated
+type localizedString struct {
+	path          string
+	field         string
+	localizations map[discordgo.Locale]string
+}
+
+// LocalizationCoverage reports, for every locale used anywhere in yml, which names and
+// descriptions are missing a translation into it. Commands deployed to several scopes are
+// only counted once.
+func LocalizationCoverage(yml *AppCmdYml) []*LocaleCoverage {
+
+	var texts []localizedString
+	seen := make(map[*discordgo.ApplicationCommand]struct{})
+	for _, scope := range CommandScopes(yml) {
+		for _, command := range scope.Commands {
+			if _, exists := seen[command]; exists {
+				continue
+			}
+			seen[command] = struct{}{}
+			texts = append(texts, commandStrings(command)...)
+		}
+	}
+
+	locales := make(map[discordgo.Locale]string)
+	for _, s := range texts {
+		for locale := range s.localizations {
+			locales[locale] = ""
+		}
+	}
+
+	var report []*LocaleCoverage
+	for _, locale := range sortedLocales(locales) {
+		coverage := &LocaleCoverage{Locale: locale, Total: len(texts)}
+		for _, s := range texts {
+			if len(s.localizations[locale]) > 0 {
+				coverage.Translated += 1
+			} else {
+				coverage.Missing = append(coverage.Missing, fmt.Sprintf("%s: %s", s.path, s.field))
+			}
+		}
+		report = append(report, coverage)
+	}
+	return report
+}
+
+func commandStrings(command *discordgo.ApplicationCommand) []localizedString {
+	texts := []localizedString{{command.Name, "name", derefLocalizations(command.NameLocalizations)}}
+	if command.Type == discordgo.ChatApplicationCommand || command.Type == 0 {
+		texts = append(texts, localizedString{command.Name, "description",
+			derefLocalizations(command.DescriptionLocalizations)})
+	}
+	for _, option := range command.Options {
+		texts = append(texts, optionStrings(command.Name, option)...)
+	}
+	return texts
+}
+
+func optionStrings(parentPath string, option *discordgo.ApplicationCommandOption) []localizedString {
+	path := joinPath(parentPath, option.Name)
+	texts := []localizedString{
+		{path, "name", option.NameLocalizations},
+		{path, "description", option.DescriptionLocalizations},
+	}
+	for _, choice := range option.Choices {
+		texts = append(texts, localizedString{path, fmt.Sprintf("choice %s", choice.Name), choice.NameLocalizations})
+	}
+	for _, sub := range option.Options {
+		texts = append(texts, optionStrings(path, sub)...)
+	}
+	return texts
+}
+
+// FormatCoverageText writes a line per locale with how much of it is translated, followed by what is missing
+func FormatCoverageText(report []*LocaleCoverage, out io.Writer) {
+	for _, coverage := range report {
+		name := discordgo.Locales[coverage.Locale]
+		if !IsSupportedLocale(coverage.Locale) {
+			name = "unknown"
+		}
+		fmt.Fprintf(out, "%s (%s): %d of %d strings translated\n", string(coverage.Locale), name,
+			coverage.Translated, coverage.Total)
+		for _, missing := range coverage.Missing {
+			fmt.Fprintf(out, "    missing %s\n", missing)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateLocalizations(t *testing.T) {
+	fixtures := map[string]string{
+		"localization_unknown_locale.yml":          RuleLocaleUnknown,
+		"localized_name_uppercase.yml":             RuleNameNotLowercase,
+		"localized_name_with_space.yml":            RuleNameInvalid,
+		"localized_description_too_long.yml":       RuleDescriptionLength,
+		"localized_context_menu_name_too_long.yml": RuleNameTooLong,
+		"localized_choice_name_too_long.yml":       RuleChoiceNameLength,
+	}
+
+	for fixture, rule := range fixtures {
+		yml := loadTestYAML(t, "invalid/"+fixture)
+		result := ValidateCommands(&yml)
+
+		if len(result.Problems) != 1 || result.Problems[0].Rule != rule {
+			for _, problem := range result.Problems {
+				t.Log(problem.String())
+			}
+			t.Errorf("Expected %s to fail only on %s", fixture, rule)
+		}
+	}
+}
+
+func TestLocalizedProblemNamesLocale(t *testing.T) {
+	yml := loadTestYAML(t, "invalid/localized_name_uppercase.yml")
+	result := ValidateCommands(&yml)
+
+	if len(result.Problems) != 1 {
+		t.Fatalf("Expected a single problem, got %s", result.Summary())
+	}
+	problem := result.Problems[0]
+	if problem.Path != "blep > animal" || !strings.HasPrefix(problem.Message, "name_localizations[de]: ") {
+		t.Errorf("Unexpected problem: %s", problem)
+	}
+	if problem.Position == nil || problem.Position.Line != 9 {
+		t.Errorf("Expected problem to point at name_localizations on line 9, got %v", problem.Position)
+	}
+}
+
+func TestLocalizationCoverage(t *testing.T) {
+	yml := loadTestYAML(t, "valid/localized_commands.yml")
+	report := LocalizationCoverage(&yml)
+
+	if len(report) != 2 || report[0].Locale != "de" || report[1].Locale != "fr" {
+		t.Fatalf("Expected coverage for de and fr, got %v", report)
+	}
+
+	// blep name and description, animal name and description, two choices, and the user command name
+	expected := map[string][]string{
+		"de": nil,
+		"fr": {"blep > animal: name", "blep > animal: choice Cat"},
+	}
+	for _, coverage := range report {
+		missing := expected[string(coverage.Locale)]
+		if coverage.Total != 7 || coverage.Translated != coverage.Total-len(missing) {
+			t.Errorf("Expected %d of 7 strings translated for %s, got %d of %d", 7-len(missing),
+				coverage.Locale, coverage.Translated, coverage.Total)
+		}
+		if strings.Join(coverage.Missing, ", ") != strings.Join(missing, ", ") {
+			t.Errorf("Expected %s to be missing %v, got %v", coverage.Locale, missing, coverage.Missing)
+		}
+	}
+
+	var out strings.Builder
+	FormatCoverageText(report, &out)
+	if !strings.Contains(out.String(), "fr (French): 5 of 7 strings translated\n    missing blep > animal: name\n") {
+		t.Errorf("Unexpected coverage report:\n%s", out.String())
+	}
+}
+
+func TestCommandLengthCountsLongestLocalization(t *testing.T) {
+	yml := loadTestYAML(t, "valid/localized_commands.yml")
+	blep := yml.Commands[0]
+
+	// The French description is the longest version of it
+	withoutDescription := CommandLength(blep) - len([]rune("Envoie une photo d'animal adorable au hasard"))
+	blep.DescriptionLocalizations = nil
+	if CommandLength(blep) != withoutDescription+len([]rune(blep.Description)) {
+		t.Errorf("Expected only the longest description to count towards the command length")
+	}
+}
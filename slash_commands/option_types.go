@@ -0,0 +1,201 @@
+package main
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"math"
+)
+
+const MaxStringOptionLength = 6000
+
+// MaxSafeInteger is the largest integer Discord accepts for integer and number options
+const MaxSafeInteger = 1 << 53
+
+const (
+	RuleChoicesNotAllowed      = "choices-not-allowed"
+	RuleChoiceValueType        = "choice-value-type"
+	RuleValueRangeNotAllowed   = "value-range-not-allowed"
+	RuleValueRangeInvalid      = "value-range-invalid"
+	RuleValueNotInteger        = "value-not-integer"
+	RuleLengthRangeNotAllowed  = "length-range-not-allowed"
+	RuleLengthRangeInvalid     = "length-range-invalid"
+	RuleChannelTypesNotAllowed = "channel-types-not-allowed"
+	RuleChannelTypeInvalid     = "channel-type-invalid"
+	RuleAutocompleteNotAllowed = "autocomplete-not-allowed"
+	RuleAutocompleteChoices    = "autocomplete-with-choices"
+)
+
+// optionTypeRules lists which of the type-specific fields an option type accepts
+type optionTypeRules struct {
+	choices      bool
+	valueRange   bool
+	lengthRange  bool
+	channelTypes bool
+	autocomplete bool
+	integer      bool
+}
+
+var OptionTypeRules = map[discordgo.ApplicationCommandOptionType]optionTypeRules{
+	discordgo.ApplicationCommandOptionSubCommand:      {},
+	discordgo.ApplicationCommandOptionSubCommandGroup: {},
+	discordgo.ApplicationCommandOptionString:          {choices: true, lengthRange: true, autocomplete: true},
+	discordgo.ApplicationCommandOptionInteger:         {choices: true, valueRange: true, autocomplete: true, integer: true},
+	discordgo.ApplicationCommandOptionBoolean:         {},
+	discordgo.ApplicationCommandOptionUser:            {},
+	discordgo.ApplicationCommandOptionChannel:         {channelTypes: true},
+	discordgo.ApplicationCommandOptionRole:            {},
+	discordgo.ApplicationCommandOptionMentionable:     {},
+	discordgo.ApplicationCommandOptionNumber:          {choices: true, valueRange: true, autocomplete: true},
+	discordgo.ApplicationCommandOptionAttachment:      {},
+}
+
+// ValidChannelTypes are the channel types a channel option can be limited to
+var ValidChannelTypes = map[discordgo.ChannelType]struct{}{
+	discordgo.ChannelTypeGuildText:          {},
+	discordgo.ChannelTypeGuildVoice:         {},
+	discordgo.ChannelTypeGuildCategory:      {},
+	discordgo.ChannelTypeGuildNews:          {},
+	discordgo.ChannelTypeGuildNewsThread:    {},
+	discordgo.ChannelTypeGuildPublicThread:  {},
+	discordgo.ChannelTypeGuildPrivateThread: {},
+	discordgo.ChannelTypeGuildStageVoice:    {},
+	discordgo.ChannelTypeGuildDirectory:     {},
+	discordgo.ChannelTypeGuildForum:         {},
+	discordgo.ChannelTypeGuildMedia:         {},
+}
+
+// ValidateOptionType checks the option only uses the fields its type allows, and that
+// the values in them make sense for that type
+func ValidateOptionType(r *ValidationResult, path string, option *discordgo.ApplicationCommandOption) {
+
+	rules, known := OptionTypeRules[option.Type]
+	if !known {
+		if option.Type != 0 {
+			r.addError(RuleOptionTypeMissing, path, option, "type", "option has unknown type %d", option.Type)
+		}
+		return
+	}
+
+	// Choices are only for strings, integers and numbers, and must match the option's type
+	if len(option.Choices) > 0 && !rules.choices {
+		r.addError(RuleChoicesNotAllowed, path, option, "choices", "%s options cannot have choices", option.Type)
+	} else {
+		for _, choice := range option.Choices {
+			if !choiceValueMatches(option.Type, choice.Value) {
+				r.addError(RuleChoiceValueType, path, choice, "value", "choice %s value %v is not a valid %s",
+					choice.Name, choice.Value, option.Type)
+			}
+		}
+	}
+
+	// Minimum and maximum values are only for integers and numbers
+	if option.MinValue != nil || option.MaxValue != 0 {
+		if !rules.valueRange {
+			r.addError(RuleValueRangeNotAllowed, path, option, firstSetField(option.MinValue != nil, "min_value", "max_value"),
+				"%s options cannot have min_value or max_value", option.Type)
+		} else {
+			validateValueRange(r, path, option, rules)
+		}
+	}
+
+	// Minimum and maximum lengths are only for strings
+	if option.MinLength != nil || option.MaxLength != 0 {
+		if !rules.lengthRange {
+			r.addError(RuleLengthRangeNotAllowed, path, option, firstSetField(option.MinLength != nil, "min_length", "max_length"),
+				"%s options cannot have min_length or max_length", option.Type)
+		} else {
+			validateLengthRange(r, path, option)
+		}
+	}
+
+	// Channel types are only for channels
+	if len(option.ChannelTypes) > 0 {
+		if !rules.channelTypes {
+			r.addError(RuleChannelTypesNotAllowed, path, option, "channel_types",
+				"%s options cannot have channel_types", option.Type)
+		}
+		for _, channelType := range option.ChannelTypes {
+			if _, valid := ValidChannelTypes[channelType]; !valid {
+				r.addError(RuleChannelTypeInvalid, path, option, "channel_types",
+					"channel type %d cannot be used in a channel option", channelType)
+			}
+		}
+	}
+
+	// Autocomplete suggests values itself, so it can't be combined with fixed choices
+	if option.Autocomplete {
+		if !rules.autocomplete {
+			r.addError(RuleAutocompleteNotAllowed, path, option, "autocomplete",
+				"%s options cannot use autocomplete", option.Type)
+		} else if len(option.Choices) > 0 {
+			r.addError(RuleAutocompleteChoices, path, option, "autocomplete",
+				"autocomplete cannot be used together with choices")
+		}
+	}
+}
+
+func validateValueRange(r *ValidationResult, path string, option *discordgo.ApplicationCommandOption, rules optionTypeRules) {
+
+	// A max_value of zero can't be told apart from one that was never set
+	bounds := map[string]float64{"max_value": option.MaxValue}
+	if option.MinValue != nil {
+		bounds["min_value"] = *option.MinValue
+	}
+
+	for _, field := range []string{"min_value", "max_value"} {
+		value, set := bounds[field]
+		if !set || (field == "max_value" && value == 0) {
+			continue
+		}
+		if math.Abs(value) > MaxSafeInteger {
+			r.addError(RuleValueRangeInvalid, path, option, field, "%s %v is outside of -2^53 to 2^53", field, value)
+		}
+		if rules.integer && value != math.Trunc(value) {
+			r.addError(RuleValueNotInteger, path, option, field, "%s %v is not a whole number", field, value)
+		}
+	}
+
+	if option.MinValue != nil && option.MaxValue != 0 && *option.MinValue > option.MaxValue {
+		r.addError(RuleValueRangeInvalid, path, option, "min_value", "min_value %v is greater than max_value %v",
+			*option.MinValue, option.MaxValue)
+	}
+}
+
+func validateLengthRange(r *ValidationResult, path string, option *discordgo.ApplicationCommandOption) {
+
+	if option.MinLength != nil && (*option.MinLength < 0 || *option.MinLength > MaxStringOptionLength) {
+		r.addError(RuleLengthRangeInvalid, path, option, "min_length", "min_length %d must be 0-%d",
+			*option.MinLength, MaxStringOptionLength)
+	}
+	if option.MaxLength != 0 && (option.MaxLength < 1 || option.MaxLength > MaxStringOptionLength) {
+		r.addError(RuleLengthRangeInvalid, path, option, "max_length", "max_length %d must be 1-%d",
+			option.MaxLength, MaxStringOptionLength)
+	}
+	if option.MinLength != nil && option.MaxLength != 0 && *option.MinLength > option.MaxLength {
+		r.addError(RuleLengthRangeInvalid, path, option, "min_length", "min_length %d is greater than max_length %d",
+			*option.MinLength, option.MaxLength)
+	}
+}
+
+// firstSetField picks which of a minimum and maximum field to point a problem at
+func firstSetField(minSet bool, minField string, maxField string) string {
+	if minSet {
+		return minField
+	}
+	return maxField
+}
+
+// choiceValueMatches checks a choice value decoded from YAML or JSON is the kind of value the option takes
+func choiceValueMatches(optionType discordgo.ApplicationCommandOptionType, value interface{}) bool {
+	switch optionType {
+	case discordgo.ApplicationCommandOptionString:
+		_, isString := value.(string)
+		return isString
+	case discordgo.ApplicationCommandOptionInteger:
+		n, isNumber := toFloat(value)
+		return isNumber && n == math.Trunc(n) && math.Abs(n) <= MaxSafeInteger
+	case discordgo.ApplicationCommandOptionNumber:
+		n, isNumber := toFloat(value)
+		return isNumber && math.Abs(n) <= MaxSafeInteger
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestValidateOptionTypeRules(t *testing.T) {
+	fixtures := map[string]string{
+		"choices_on_boolean_option.yml":          RuleChoicesNotAllowed,
+		"choices_on_subcommand.yml":              RuleChoicesNotAllowed,
+		"choice_value_not_string.yml":            RuleChoiceValueType,
+		"choice_value_not_integer.yml":           RuleChoiceValueType,
+		"choice_value_not_whole_number.yml":      RuleChoiceValueType,
+		"choice_value_not_number.yml":            RuleChoiceValueType,
+		"min_value_greater_than_max_value.yml":   RuleValueRangeInvalid,
+		"max_value_out_of_range.yml":             RuleValueRangeInvalid,
+		"min_value_on_string_option.yml":         RuleValueRangeNotAllowed,
+		"max_value_on_boolean_option.yml":        RuleValueRangeNotAllowed,
+		"min_value_not_whole_number.yml":         RuleValueNotInteger,
+		"min_length_on_integer_option.yml":       RuleLengthRangeNotAllowed,
+		"max_length_on_user_option.yml":          RuleLengthRangeNotAllowed,
+		"min_length_greater_than_max_length.yml": RuleLengthRangeInvalid,
+		"max_length_out_of_range.yml":            RuleLengthRangeInvalid,
+		"channel_types_on_string_option.yml":     RuleChannelTypesNotAllowed,
+		"channel_type_invalid.yml":               RuleChannelTypeInvalid,
+		"autocomplete_with_choices.yml":          RuleAutocompleteChoices,
+		"autocomplete_on_boolean_option.yml":     RuleAutocompleteNotAllowed,
+	}
+
+	for fixture, rule := range fixtures {
+		yml := loadTestYAML(t, "invalid/"+fixture)
+		result := ValidateCommands(&yml)
+
+		if len(result.Problems) != 1 || result.Problems[0].Rule != rule {
+			for _, problem := range result.Problems {
+				t.Log(problem.String())
+			}
+			t.Errorf("Expected %s to fail only on %s", fixture, rule)
+		}
+	}
+}
+
+func TestValidateOptionTypeAllowedFields(t *testing.T) {
+	yml := loadTestYAML(t, "valid/typed_options.yml")
+	result := ValidateCommands(&yml)
+
+	if len(result.Problems) != 0 {
+		for _, problem := range result.Problems {
+			t.Error(problem.String())
+		}
+	}
+
+	// Values come through YAML as JSON numbers, whatever they were written as
+	options := yml.Commands[0].Options
+	if options[1].MinValue == nil || *options[1].MinValue != 1 || options[1].MaxValue != 10 {
+		t.Errorf("Expected count to range from 1 to 10, got %v to %v", options[1].MinValue, options[1].MaxValue)
+	}
+	if options[0].MinLength == nil || *options[0].MinLength != 1 || options[0].MaxLength != 32 {
+		t.Errorf("Expected animal to be 1-32 characters, got %v to %v", options[0].MinLength, options[0].MaxLength)
+	}
+	if len(options[5].ChannelTypes) != 3 {
+		t.Errorf("Expected channel to allow 3 channel types, got %v", options[5].ChannelTypes)
+	}
+}
+
+func TestValidChannelTypesHaveNames(t *testing.T) {
+	// The schema offers the named channel types, so both lists have to agree for editors to accept what validate does
+	if len(ChannelTypeNames) != len(ValidChannelTypes) {
+		t.Errorf("Expected %d channel type names, got %d", len(ValidChannelTypes), len(ChannelTypeNames))
+	}
+	for channelType := range ValidChannelTypes {
+		if _, named := ChannelTypeNames[channelType]; !named {
+			t.Errorf("Channel type %d has no name", channelType)
+		}
+	}
+
+	yml := loadTestYAML(t, "valid/forum_and_media_channels.yml")
+	if result := ValidateCommands(&yml); len(result.Problems) != 0 {
+		for _, problem := range result.Problems {
+			t.Error(problem.String())
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	RulePermissionUnknown      = "permission-unknown"
+	RuleContextInvalid         = "context-invalid"
+	RuleIntegrationTypeInvalid = "integration-type-invalid"
+	RuleAvailabilityConflict   = "availability-conflict"
+	RuleGlobalOnlyField        = "global-only-field"
+)
+
+// PermissionNames are the names default_member_permissions can list, as Discord's documentation
+// writes them but in PascalCase, such as ManageGuild for MANAGE_GUILD
+var PermissionNames = map[string]int64{
+	"CreateInstantInvite":              discordgo.PermissionCreateInstantInvite,
+	"KickMembers":                      discordgo.PermissionKickMembers,
+	"BanMembers":                       discordgo.PermissionBanMembers,
+	"Administrator":                    discordgo.PermissionAdministrator,
+	"ManageChannels":                   discordgo.PermissionManageChannels,
+	"ManageGuild":                      discordgo.PermissionManageGuild,
+	"AddReactions":                     discordgo.PermissionAddReactions,
+	"ViewAuditLog":                     discordgo.PermissionViewAuditLogs,
+	"PrioritySpeaker":                  discordgo.PermissionVoicePrioritySpeaker,
+	"Stream":                           discordgo.PermissionVoiceStreamVideo,
+	"ViewChannel":                      discordgo.PermissionViewChannel,
+	"SendMessages":                     discordgo.PermissionSendMessages,
+	"SendTTSMessages":                  discordgo.PermissionSendTTSMessages,
+	"ManageMessages":                   discordgo.PermissionManageMessages,
+	"EmbedLinks":                       discordgo.PermissionEmbedLinks,
+	"AttachFiles":                      discordgo.PermissionAttachFiles,
+	"ReadMessageHistory":               discordgo.PermissionReadMessageHistory,
+	"MentionEveryone":                  discordgo.PermissionMentionEveryone,
+	"UseExternalEmojis":                discordgo.PermissionUseExternalEmojis,
+	"ViewGuildInsights":                discordgo.PermissionViewGuildInsights,
+	"Connect":                          discordgo.PermissionVoiceConnect,
+	"Speak":                            discordgo.PermissionVoiceSpeak,
+	"MuteMembers":                      discordgo.PermissionVoiceMuteMembers,
+	"DeafenMembers":                    discordgo.PermissionVoiceDeafenMembers,
+	"MoveMembers":                      discordgo.PermissionVoiceMoveMembers,
+	"UseVAD":                           discordgo.PermissionVoiceUseVAD,
+	"ChangeNickname":                   discordgo.PermissionChangeNickname,
+	"ManageNicknames":                  discordgo.PermissionManageNicknames,
+	"ManageRoles":                      discordgo.PermissionManageRoles,
+	"ManageWebhooks":                   discordgo.PermissionManageWebhooks,
+	"ManageGuildExpressions":           discordgo.PermissionManageGuildExpressions,
+	"UseApplicationCommands":           discordgo.PermissionUseApplicationCommands,
+	"RequestToSpeak":                   discordgo.PermissionVoiceRequestToSpeak,
+	"ManageEvents":                     discordgo.PermissionManageEvents,
+	"ManageThreads":                    discordgo.PermissionManageThreads,
+	"CreatePublicThreads":              discordgo.PermissionCreatePublicThreads,
+	"CreatePrivateThreads":             discordgo.PermissionCreatePrivateThreads,
+	"UseExternalStickers":              discordgo.PermissionUseExternalStickers,
+	"SendMessagesInThreads":            discordgo.PermissionSendMessagesInThreads,
+	"UseEmbeddedActivities":            discordgo.PermissionUseEmbeddedActivities,
+	"ModerateMembers":                  discordgo.PermissionModerateMembers,
+	"ViewCreatorMonetizationAnalytics": discordgo.PermissionViewCreatorMonetizationAnalytics,
+	"UseSoundboard":                    discordgo.PermissionUseSoundboard,
+	"CreateGuildExpressions":           discordgo.PermissionCreateGuildExpressions,
+	"CreateEvents":                     discordgo.PermissionCreateEvents,
+	"UseExternalSounds":                discordgo.PermissionUseExternalSounds,
+	"SendVoiceMessages":                discordgo.PermissionSendVoiceMessages,
+	"SendPolls":                        discordgo.PermissionSendPolls,
+	"UseExternalApps":                  discordgo.PermissionUseExternalApps,
+}
+
+// ContextNames are the places a command can be used, as listed in contexts
+var ContextNames = map[discordgo.InteractionContextType]string{
+	discordgo.InteractionContextGuild:          "guild",
+	discordgo.InteractionContextBotDM:          "bot_dm",
+	discordgo.InteractionContextPrivateChannel: "private_channel",
+}
+
+// IntegrationTypeNames are the ways the app can be installed, as listed in integration_types
+var IntegrationTypeNames = map[discordgo.ApplicationIntegrationType]string{
+	discordgo.ApplicationIntegrationGuildInstall: "guild_install",
+	discordgo.ApplicationIntegrationUserInstall:  "user_install",
+}
+
+// PermissionBits adds up the bits of the named permissions, returning any names it doesn't know
+func PermissionBits(names []string) (int64, []string) {
+	var bits int64
+	var unknown []string
+	for _, name := range names {
+		bit, known := PermissionNames[name]
+		if !known {
+			unknown = append(unknown, name)
+		}
+		bits |= bit
+	}
+	return bits, unknown
+}
+
+// PermissionNamesOf lists the names of the permissions in bits, in alphabetical order.
+// Bits without a name are listed as numbers.
+func PermissionNamesOf(bits int64) []string {
+	var names []string
+	for name, bit := range PermissionNames {
+		if bits&bit != 0 {
+			names = append(names, name)
+			bits &^= bit
+		}
+	}
+	sort.Strings(names)
+	for bit := int64(1); bits != 0 && bit > 0; bit <<= 1 {
+		if bits&bit != 0 {
+			names = append(names, strconv.FormatInt(bit, 10))
+			bits &^= bit
+		}
+	}
+	return names
+}
+
+// permissionNamesIn reads the names given for default_member_permissions. A bitfield, written
+// as a number the way Discord sends it, has no names.
+func permissionNamesIn(value interface{}) ([]string, bool) {
+	switch v := value.(type) {
+	case string:
+		if _, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return nil, false
+		}
+		return []string{v}, true
+	case []interface{}:
+		names := []string{}
+		for _, item := range v {
+			names = append(names, fmt.Sprint(item))
+		}
+		return names, true
+	}
+	return nil, false
+}
+
+// resolvePermissionNames replaces the permission names in every default_member_permissions
+// beneath raw with the bitfield Discord expects. Unknown names are left out, for validation to report.
+func resolvePermissionNames(raw interface{}) {
+	switch v := raw.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if key != "default_member_permissions" {
+				resolvePermissionNames(value)
+				continue
+			}
+			if names, named := permissionNamesIn(value); named {
+				bits, _ := PermissionBits(names)
+				v[key] = strconv.FormatInt(bits, 10)
+			} else if n, isInt := value.(int); isInt {
+				v[key] = strconv.Itoa(n)
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			resolvePermissionNames(item)
+		}
+	}
+}
+
+// suggestPermission finds the permission a misspelt name was most likely meant to be
+func suggestPermission(name string) string {
+	for known := range PermissionNames {
+		if strings.EqualFold(known, name) {
+			return fmt.Sprintf(", did you mean %s?", known)
+		}
+	}
+	return ""
+}
+
+// validatePermissions checks the names in default_member_permissions are all permissions.
+// They are turned into a bitfield as the YAML is decoded, so they are read from the YAML itself.
+func validatePermissions(r *ValidationResult, path string, command *discordgo.ApplicationCommand) {
+	node := r.source.Value(command, "default_member_permissions")
+	if node == nil {
+		return
+	}
+	var value interface{}
+	if err := node.Decode(&value); err != nil {
+		return
+	}
+	names, _ := permissionNamesIn(value)
+	_, unknown := PermissionBits(names)
+	for _, name := range unknown {
+		r.addError(RulePermissionUnknown, path, command, "default_member_permissions",
+			"unknown permission %q%s", name, suggestPermission(name))
+	}
+}
+
+// validateAvailability checks where a command can be used makes sense, and doesn't say two different things
+func validateAvailability(r *ValidationResult, path string, command *discordgo.ApplicationCommand) {
+
+	validatePermissions(r, path, command)
+
+	contexts := make(map[discordgo.InteractionContextType]bool)
+	if command.Contexts != nil {
+		if len(*command.Contexts) == 0 {
+			r.addError(RuleAvailabilityConflict, path, command, "contexts",
+				"contexts is empty, so the command can't be used anywhere")
+		}
+		for _, context := range *command.Contexts {
+			if _, known := ContextNames[context]; !known {
+				r.addError(RuleContextInvalid, path, command, "contexts", "unknown context %d", context)
+			}
+			contexts[context] = true
+		}
+	}
+
+	integrationTypes := make(map[discordgo.ApplicationIntegrationType]bool)
+	if command.IntegrationTypes != nil {
+		if len(*command.IntegrationTypes) == 0 {
+			r.addError(RuleAvailabilityConflict, path, command, "integration_types",
+				"integration_types is empty, so the command can't be installed anywhere")
+		}
+		for _, integrationType := range *command.IntegrationTypes {
+			if _, known := IntegrationTypeNames[integrationType]; !known {
+				r.addError(RuleIntegrationTypeInvalid, path, command, "integration_types",
+					"unknown integration type %d", integrationType)
+			}
+			integrationTypes[integrationType] = true
+		}
+	}
+
+	// dm_permission is the older way of saying whether the bot_dm context is allowed
+	if command.DMPermission != nil && command.Contexts != nil && *command.DMPermission != contexts[discordgo.InteractionContextBotDM] {
+		r.addError(RuleAvailabilityConflict, path, command, "dm_permission",
+			"dm_permission is %t, but contexts %s bot_dm", *command.DMPermission,
+			map[bool]string{true: "includes", false: "does not include"}[contexts[discordgo.InteractionContextBotDM]])
+	}
+
+	// Only a user installing the app makes it available in other people's DMs and group DMs
+	if contexts[discordgo.InteractionContextPrivateChannel] && command.IntegrationTypes != nil &&
+		!integrationTypes[discordgo.ApplicationIntegrationUserInstall] {
+		r.addError(RuleAvailabilityConflict, path, command, "contexts",
+			"contexts includes private_channel, which needs the user_install integration type")
+	}
+}
+
+// validateGuildAvailability warns about fields that Discord ignores on guild commands,
+// which can only ever be used in the guilds they are registered to
+func validateGuildAvailability(r *ValidationResult, path string, command *discordgo.ApplicationCommand) {
+	fields := map[string]bool{
+		"dm_permission":     command.DMPermission != nil,
+		"contexts":          command.Contexts != nil,
+		"integration_types": command.IntegrationTypes != nil,
+	}
+	for _, field := range []string{"dm_permission", "contexts", "integration_types"} {
+		if fields[field] {
+			r.addWarning(RuleGlobalOnlyField, path, command, field, "%s has no effect on guild commands", field)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"strings"
+	"testing"
+)
+
+func TestPermissionNamesBecomeBitfields(t *testing.T) {
+	yml := loadTestYAML(t, "valid/admin_commands.yml")
+
+	expected := map[string]int64{
+		"settings":    discordgo.PermissionManageGuild,
+		"ban":         discordgo.PermissionBanMembers | discordgo.PermissionModerateMembers,
+		"shutdown":    discordgo.PermissionAdministrator,
+		"Report User": discordgo.PermissionAdministrator,
+		"lockdown":    0,
+	}
+	for _, command := range allCommands(&yml) {
+		bits, restricted := expected[command.Name]
+		if !restricted {
+			if command.DefaultMemberPermissions != nil {
+				t.Errorf("Expected %s to be usable by everyone, got %d", command.Name, *command.DefaultMemberPermissions)
+			}
+			continue
+		}
+		if command.DefaultMemberPermissions == nil || *command.DefaultMemberPermissions != bits {
+			t.Errorf("Expected %s to have permissions %d, got %v", command.Name, bits, command.DefaultMemberPermissions)
+		}
+	}
+
+	// The bitfield is sent to Discord as a string
+	body, err := encodeYAML(yml.Commands[1])
+	if err != nil {
+		t.Fatalf("Unable to encode command: %s", err.Error())
+	}
+	if !strings.Contains(string(body), `default_member_permissions: "1099511627780"`) {
+		t.Errorf("Expected the bitfield as a string, got:\n%s", body)
+	}
+}
+
+func TestPermissionNamesOf(t *testing.T) {
+	names := PermissionNamesOf(discordgo.PermissionManageGuild | discordgo.PermissionBanMembers | 1<<60)
+	if strings.Join(names, ",") != "BanMembers,ManageGuild,1152921504606846976" {
+		t.Errorf("Unexpected permission names: %v", names)
+	}
+}
+
+func TestUnknownPermissionsPointAtTheirLine(t *testing.T) {
+	yml := loadTestYAML(t, "invalid/permission_unknown.yml")
+	result := ValidateCommands(&yml)
+
+	if len(result.Problems) != 1 || result.Problems[0].Rule != RulePermissionUnknown {
+		t.Fatalf("Expected an unknown permission, got %v", result.Problems)
+	}
+	problem := result.Problems[0]
+	if problem.Position == nil || problem.Position.Line != 5 || problem.Message != `unknown permission "ManageServer"` {
+		t.Errorf("Unexpected problem: %s", problem)
+	}
+
+	// Names in the wrong case get a suggestion
+	yml.Commands[0].DefaultMemberPermissions = nil
+	yml.source.Value(yml.Commands[0], "default_member_permissions").Content[0].Value = "banmembers"
+	result = ValidateCommands(&yml)
+	if len(result.Problems) != 1 || !strings.HasSuffix(result.Problems[0].Message, "did you mean BanMembers?") {
+		t.Errorf("Expected a suggestion, got %v", result.Problems)
+	}
+}
+
+func TestAvailabilityConflicts(t *testing.T) {
+	cases := map[string]string{
+		"invalid/dm_permission_contradicts_contexts.yml":   "dm_permission is true, but contexts does not include bot_dm",
+		"invalid/private_channel_without_user_install.yml": "contexts includes private_channel, which needs the user_install integration type",
+		"invalid/contexts_empty.yml":                       "contexts is empty, so the command can't be used anywhere",
+	}
+	for file, message := range cases {
+		yml := loadTestYAML(t, file)
+		result := ValidateCommands(&yml)
+		if len(result.Problems) != 1 || result.Problems[0].Rule != RuleAvailabilityConflict || result.Problems[0].Message != message {
+			t.Errorf("Expected %q from %s, got %v", message, file, result.Problems)
+		}
+	}
+}
+
+func TestGuildCommandsWarnAboutGlobalOnlyFields(t *testing.T) {
+	dmPermission := false
+	yml := AppCmdYml{Guilds: []*GuildCmdYml{{GuildIds: []string{"123456789012345678"},
+		Commands: []*discordgo.ApplicationCommand{{Type: discordgo.ChatApplicationCommand, Name: "lockdown",
+			Description: "Stop anyone but moderators from starting games", DMPermission: &dmPermission}}}}}
+
+	result := ValidateCommands(&yml)
+	if result.HasErrors() || result.Count(SeverityWarning) != 1 || result.Problems[0].Rule != RuleGlobalOnlyField {
+		t.Errorf("Expected a warning about dm_permission, got %v", result.Problems)
+	}
+}
+
+func TestSyncDetectsPermissionChanges(t *testing.T) {
+	live := liveBlep()
+	desired := liveBlep()
+	manageGuild := int64(discordgo.PermissionManageGuild)
+	nsfw := true
+	desired.DefaultMemberPermissions = &manageGuild
+	desired.NSFW = &nsfw
+
+	changes := DiffCommand(live, desired, "")
+	if len(changes) != 2 || changes[0].Path != "default_member_permissions" || changes[1].Path != "nsfw" {
+		t.Fatalf("Expected permissions and nsfw to change, got %v", changes)
+	}
+	if formatValue(changes[0].Old) != "(unset)" || formatValue(changes[0].New) != `["ManageGuild"]` {
+		t.Errorf("Expected permissions to be shown by name, got %s -> %s", formatValue(changes[0].Old), formatValue(changes[0].New))
+	}
+
+	// Discord fills in contexts and dm_permission itself when commands.yml leaves them out
+	dmPermission := false
+	live.DMPermission = &dmPermission
+	live.Contexts = &[]discordgo.InteractionContextType{discordgo.InteractionContextGuild}
+	desired.Contexts = &[]discordgo.InteractionContextType{discordgo.InteractionContextGuild}
+	if changes = DiffCommand(live, desired, ""); len(changes) != 2 {
+		t.Errorf("Expected dm_permission to follow contexts, got %v", changes)
+	}
+}
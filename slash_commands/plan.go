@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"io"
+	"strings"
+)
+
+// PlanScopes writes the changes a sync of the given scopes would make without making any write calls
+func PlanScopes(getFn AppCmdsGetFn, appId *string, scopes []*CommandScope, format string, out io.Writer) error {
+
+	if format != FormatText && format != FormatJSON && format != "" {
+		return fmt.Errorf("unknown plan format: %s", format)
+	}
+
+	var plans []*SyncPlan
+	for _, scope := range scopes {
+		guildId := scope.GuildID
+		plan, err := GetSyncPlan(getFn, appId, &guildId, &AppCmdYml{Commands: scope.Commands})
+		if err != nil {
+			return fmt.Errorf("unable to plan %s: %w", scope, err)
+		}
+		plans = append(plans, plan)
+	}
+
+	if format == FormatJSON {
+		body, err := FormatPlanJSON(plans)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(out, string(body))
+		return err
+	}
+
+	var b strings.Builder
+	for _, plan := range plans {
+		scope := CommandScope{GuildID: plan.GuildID}
+		fmt.Fprintf(&b, "=== %s ===\n%s\n", scope.String(), FormatPlanText(plan))
+	}
+	_, err := io.WriteString(out, b.String())
+	return err
+}
+
+func FormatPlanJSON(plans []*SyncPlan) ([]byte, error) {
+	return json.MarshalIndent(plans, "", "  ")
+}
+
+// FormatPlanText renders a plan as a diff, one line per command and per changed field
+func FormatPlanText(plan *SyncPlan) string {
+
+	var b strings.Builder
+	for _, op := range plan.Operations {
+		switch op.Action {
+		case SyncCreate:
+			fmt.Fprintf(&b, "+ %s %s\n", commandTypeName(op.Type), op.Name)
+			for _, option := range op.Desired.Options {
+				writeOption(&b, "+", "    ", option)
+			}
+		case SyncEdit:
+			fmt.Fprintf(&b, "~ %s %s (ID: %s)\n", commandTypeName(op.Type), op.Name, op.ID)
+			for _, change := range op.Changes {
+				writeChange(&b, change)
+			}
+		case SyncDelete:
+			fmt.Fprintf(&b, "- %s %s (ID: %s)\n", commandTypeName(op.Type), op.Name, op.ID)
+		}
+	}
+
+	if plan.IsEmpty() {
+		b.WriteString("No changes. Live commands match commands.yml\n")
+	}
+	fmt.Fprintf(&b, "Plan: %d to create, %d to edit, %d to delete, %d unchanged\n",
+		plan.Count(SyncCreate), plan.Count(SyncEdit), plan.Count(SyncDelete), len(plan.Unchanged))
+	return b.String()
+}
+
+func writeChange(b *strings.Builder, change FieldChange) {
+	switch change.Kind {
+	case ChangeAdded:
+		writeOption(b, "+", "    ", change.New.(*discordgo.ApplicationCommandOption))
+	case ChangeRemoved:
+		option := change.Old.(*discordgo.ApplicationCommandOption)
+		fmt.Fprintf(b, "    - option %s (%s)\n", change.Path, option.Type)
+	default:
+		fmt.Fprintf(b, "    ~ %s: %s -> %s\n", change.Path, formatValue(change.Old), formatValue(change.New))
+	}
+}
+
+func writeOption(b *strings.Builder, marker string, indent string, option *discordgo.ApplicationCommandOption) {
+
+	required := ""
+	if option.Required {
+		required = ", required"
+	}
+	fmt.Fprintf(b, "%s%s option %s (%s%s)\n", indent, marker, option.Name, option.Type, required)
+	for _, sub := range option.Options {
+		writeOption(b, marker, indent+"  ", sub)
+	}
+}
+
+func formatValue(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return "(unset)"
+	case string:
+		return fmt.Sprintf("%q", value)
+	case *float64:
+		if value == nil {
+			return "(unset)"
+		}
+		return fmt.Sprintf("%v", *value)
+	case *int:
+		if value == nil {
+			return "(unset)"
+		}
+		return fmt.Sprintf("%v", *value)
+	}
+
+	body, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(body)
+}
+
+func commandTypeName(t discordgo.ApplicationCommandType) string {
+	switch t {
+	case discordgo.ChatApplicationCommand:
+		return "chat input command"
+	case discordgo.UserApplicationCommand:
+		return "user command"
+	case discordgo.MessageApplicationCommand:
+		return "message command"
+	}
+	return fmt.Sprintf("command (type %d)", t)
+}
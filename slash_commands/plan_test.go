@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/bwmarrin/discordgo"
+	"strings"
+	"testing"
+)
+
+func TestPlanScopesMakesNoWrites(t *testing.T) {
+	api := newMockDiscordApi()
+	api.seed("", liveBlep(), &discordgo.ApplicationCommand{
+		Type: discordgo.ChatApplicationCommand, Name: "stale", Description: "No longer in the YAML"})
+
+	appId := "1234"
+	for _, format := range []string{FormatText, FormatJSON} {
+		var out bytes.Buffer
+		if err := PlanScopes(api.Get, &appId, CommandScopes(&mockYml), format, &out); err != nil {
+			t.Fatalf("Planning failed: %s", err.Error())
+		}
+		if out.Len() == 0 {
+			t.Errorf("Expected %s plan output", format)
+		}
+	}
+
+	if api.writes() != 0 {
+		t.Errorf("Expected plan mode to make no write calls, got %v", api.calls)
+	}
+	if len(api.commands[""]) != 2 {
+		t.Errorf("Expected live commands to be untouched")
+	}
+}
+
+func TestFormatPlanText(t *testing.T) {
+	desired := liveBlep()
+	desired.Description = "Send a cute animal photo"
+	desired.Options = append(desired.Options, &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionBoolean,
+		Name:        "only_smol",
+		Description: "Whether to show only baby animals",
+	})
+	live := liveBlep()
+	live.ID = "42"
+
+	plan := PlanSync([]*discordgo.ApplicationCommand{live,
+		{ID: "99", Type: discordgo.UserApplicationCommand, Name: "stale"}},
+		[]*discordgo.ApplicationCommand{desired,
+			{Type: discordgo.ChatApplicationCommand, Name: "helloworld", Description: "Tests our command architecture"}}, "")
+	text := FormatPlanText(plan)
+
+	expected := []string{
+		"~ chat input command blep (ID: 42)",
+		"    ~ description: \"Send a random adorable animal photo\" -> \"Send a cute animal photo\"",
+		"    + option only_smol (Boolean)",
+		"+ chat input command helloworld",
+		"- user command stale (ID: 99)",
+		"Plan: 1 to create, 1 to edit, 1 to delete, 0 unchanged",
+	}
+	for _, line := range expected {
+		if !strings.Contains(text, line+"\n") {
+			t.Errorf("Expected plan to contain %q, got:\n%s", line, text)
+		}
+	}
+}
+
+func TestFormatPlanJSON(t *testing.T) {
+	desired := liveBlep()
+	desired.Options = desired.Options[:0]
+	live := liveBlep()
+	live.ID = "42"
+
+	plan := PlanSync([]*discordgo.ApplicationCommand{live}, []*discordgo.ApplicationCommand{desired}, "")
+	body, err := FormatPlanJSON([]*SyncPlan{plan})
+	if err != nil {
+		t.Fatalf("Unable to format plan as JSON: %s", err.Error())
+	}
+
+	var decoded []struct {
+		Operations []struct {
+			Action  string `json:"action"`
+			Name    string `json:"name"`
+			ID      string `json:"id"`
+			Changes []struct {
+				Kind string `json:"kind"`
+				Path string `json:"path"`
+			} `json:"changes"`
+		} `json:"operations"`
+	}
+	if err = json.Unmarshal(body, &decoded); err != nil {
+		t.Fatalf("Plan JSON did not decode: %s", err.Error())
+	}
+
+	if len(decoded) != 1 {
+		t.Fatalf("Expected a single plan, got %s", body)
+	}
+	operations := decoded[0].Operations
+	if len(operations) != 1 || operations[0].Action != "edit" || operations[0].ID != "42" {
+		t.Fatalf("Expected a single edit of command 42, got %s", body)
+	}
+	changes := operations[0].Changes
+	if len(changes) != 1 || changes[0].Kind != "removed" || changes[0].Path != "animal" {
+		t.Errorf("Expected option animal to be removed, got %s", body)
+	}
+}
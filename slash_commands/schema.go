@@ -0,0 +1,582 @@
+package main
+
+import (
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"gopkg.in/yaml.v3"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const DefaultSchemaPath = "commands.schema.json"
+
+const (
+	RuleSchemaUnknownKey = "schema-unknown-key"
+	RuleSchemaType       = "schema-type"
+	RuleSchemaValue      = "schema-value"
+	RuleSchemaRequired   = "schema-required"
+)
+
+// Schema is a JSON Schema, kept as a map so it marshals the way the specification writes it
+type Schema map[string]interface{}
+
+// CommandTypeNames are readable names for each command type
+var CommandTypeNames = map[discordgo.ApplicationCommandType]string{
+	discordgo.ChatApplicationCommand:    "chat_input",
+	discordgo.UserApplicationCommand:    "user",
+	discordgo.MessageApplicationCommand: "message",
+}
+
+// OptionTypeNames are readable names for each option type
+var OptionTypeNames = map[discordgo.ApplicationCommandOptionType]string{
+	discordgo.ApplicationCommandOptionSubCommand:      "subcommand",
+	discordgo.ApplicationCommandOptionSubCommandGroup: "subcommand_group",
+	discordgo.ApplicationCommandOptionString:          "string",
+	discordgo.ApplicationCommandOptionInteger:         "integer",
+	discordgo.ApplicationCommandOptionBoolean:         "boolean",
+	discordgo.ApplicationCommandOptionUser:            "user",
+	discordgo.ApplicationCommandOptionChannel:         "channel",
+	discordgo.ApplicationCommandOptionRole:            "role",
+	discordgo.ApplicationCommandOptionMentionable:     "mentionable",
+	discordgo.ApplicationCommandOptionNumber:          "number",
+	discordgo.ApplicationCommandOptionAttachment:      "attachment",
+}
+
+// ChannelTypeNames are readable names for the channel types in ValidChannelTypes
+var ChannelTypeNames = map[discordgo.ChannelType]string{
+	discordgo.ChannelTypeGuildText:          "guild_text",
+	discordgo.ChannelTypeGuildVoice:         "guild_voice",
+	discordgo.ChannelTypeGuildCategory:      "guild_category",
+	discordgo.ChannelTypeGuildNews:          "guild_news",
+	discordgo.ChannelTypeGuildNewsThread:    "guild_news_thread",
+	discordgo.ChannelTypeGuildPublicThread:  "guild_public_thread",
+	discordgo.ChannelTypeGuildPrivateThread: "guild_private_thread",
+	discordgo.ChannelTypeGuildStageVoice:    "guild_stage_voice",
+	discordgo.ChannelTypeGuildDirectory:     "guild_directory",
+	discordgo.ChannelTypeGuildForum:         "guild_forum",
+	discordgo.ChannelTypeGuildMedia:         "guild_media",
+}
+
+// schemaDefinitions are the types that get a definition of their own, to be referred to by name
+var schemaDefinitions = map[reflect.Type]string{
+	reflect.TypeOf(discordgo.ApplicationCommand{}):             "command",
+	reflect.TypeOf(discordgo.ApplicationCommandOption{}):       "option",
+	reflect.TypeOf(discordgo.ApplicationCommandOptionChoice{}): "choice",
+	reflect.TypeOf(GuildCmdYml{}):                              "guild_group",
+	reflect.TypeOf(EnvironmentYml{}):                           "environment",
+}
+
+// schemaSkipped are fields Discord fills in itself, which have no place in commands.yml
+var schemaSkipped = map[string]bool{
+	"command.id":             true,
+	"command.application_id": true,
+	"command.guild_id":       true,
+	"command.version":        true,
+}
+
+// schemaRequired are the fields each definition can't do without
+var schemaRequired = map[string][]string{
+	"command":     {"name"},
+	"option":      {"name", "type"},
+	"choice":      {"name", "value"},
+	"guild_group": {"GuildIds", "Commands"},
+}
+
+var schemaDescriptions = map[string]string{
+	"Commands":                   "Commands registered globally",
+	"Guilds":                     "Commands only registered to the listed guilds",
+	"Include":                    "Files, directories or globs to merge in, relative to this file",
+	"Environments":               "Changes to the commands for each environment, such as dev or prod",
+	"GuildIds":                   "IDs of the guilds to register the commands to",
+	"DescriptionPrefix":          "Put in front of every description, such as [DEV]",
+	"Hide":                       "Names of chat input commands to leave out of the environment. Prefix user or message commands with their type, such as user:Challenge",
+	"name":                       "1-32 characters. Chat input names are lowercase with no spaces",
+	"choice.name":                "1-100 characters, shown to users in place of the value",
+	"description":                "1-100 characters, only for chat input commands",
+	"name_localizations":         "Translations of the name, keyed by locale",
+	"description_localizations":  "Translations of the description, keyed by locale",
+	"options":                    "Up to 25 options, or subcommands",
+	"required":                   "Whether the option has to be given. Required options come first",
+	"choices":                    "Up to 25 values to pick from",
+	"autocomplete":               "Whether the bot suggests values as they are typed. Not allowed with choices",
+	"channel_types":              "Channel types a channel option can be limited to",
+	"min_value":                  "Smallest value of an integer or number option",
+	"max_value":                  "Largest value of an integer or number option",
+	"min_length":                 "Shortest length of a string option, 0-6000",
+	"max_length":                 "Longest length of a string option, 1-6000",
+	"value":                      "Sent to the bot when the choice is picked",
+	"default_member_permissions": "Permissions a member needs to use the command, by name, or as a bitfield",
+	"dm_permission":              "Whether the command can be used in DMs with the bot. Prefer contexts",
+	"default_permission":         "Deprecated, use default_member_permissions",
+	"nsfw":                       "Whether the command is limited to age-restricted channels",
+	"contexts":                   "Where the command can be used",
+	"integration_types":          "How the app has to be installed for the command to show up",
+}
+
+// CommandsSchema builds the JSON Schema for commands.yml from the types it is decoded into
+func CommandsSchema() Schema {
+
+	definitions := make(map[string]interface{})
+	root := schemaFor(reflect.TypeOf(AppCmdYml{}), "", definitions)
+	root["$schema"] = "http://json-schema.org/draft-07/schema#"
+	root["title"] = "saluki slash commands"
+	root["definitions"] = definitions
+
+	// Environments list commands that only set the fields they change
+	overlay := Schema{}
+	for key, value := range definitions["command"].(Schema) {
+		if key != "required" {
+			overlay[key] = value
+		}
+	}
+	definitions["overlay"] = overlay
+	environment := definitions["environment"].(Schema)["properties"].(Schema)
+	environment["Commands"] = Schema{"type": "array", "items": schemaRef("overlay"), "description": schemaDescriptions["Commands"]}
+	return root
+}
+
+func schemaRef(definition string) Schema {
+	return Schema{"$ref": "#/definitions/" + definition}
+}
+
+// schemaFor describes t, adding the definitions it refers to. field names the struct
+// field t is the type of, as definition.field, for fields that need special handling.
+func schemaFor(t reflect.Type, field string, definitions map[string]interface{}) Schema {
+
+	if special := schemaForField(field); special != nil {
+		return special
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if enum := schemaEnum(t); enum != nil {
+		// Command and option types can be written by name too
+		if names := symbolicTypeNames(t); len(names) > 0 {
+			return Schema{"oneOf": []interface{}{enum, Schema{"type": "string", "enum": names}}}
+		}
+		return enum
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return Schema{"type": "string"}
+	case reflect.Bool:
+		return Schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Schema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return Schema{"type": "number"}
+	case reflect.Slice:
+		return Schema{"type": "array", "items": schemaFor(t.Elem(), "", definitions)}
+	case reflect.Map:
+		schema := Schema{"type": "object", "additionalProperties": schemaFor(t.Elem(), "", definitions)}
+		if t.Key() == reflect.TypeOf(discordgo.Locale("")) {
+			schema["propertyNames"] = Schema{"enum": schemaLocales()}
+		}
+		return schema
+	case reflect.Struct:
+		definition, named := schemaDefinitions[t]
+		if named {
+			if _, exists := definitions[definition]; exists {
+				return schemaRef(definition)
+			}
+			// Reserve the name first, since options contain options
+			definitions[definition] = Schema{}
+		}
+
+		properties := Schema{}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := strings.Split(f.Tag.Get("json"), ",")[0]
+			if f.PkgPath != "" || name == "-" || len(name) == 0 || schemaSkipped[definition+"."+name] {
+				continue
+			}
+			property := schemaFor(f.Type, definition+"."+name, definitions)
+			if description, exists := schemaDescriptions[definition+"."+name]; exists {
+				property["description"] = description
+			} else if description, exists = schemaDescriptions[name]; exists {
+				property["description"] = description
+			}
+			properties[name] = property
+		}
+		schema := Schema{"type": "object", "properties": properties, "additionalProperties": false}
+		if required, exists := schemaRequired[definition]; exists {
+			schema["required"] = required
+		}
+		if !named {
+			return schema
+		}
+		definitions[definition] = schema
+		return schemaRef(definition)
+	}
+	return Schema{}
+}
+
+// schemaForField covers fields whose Go type doesn't say what commands.yml accepts
+func schemaForField(field string) Schema {
+	switch field {
+	case "command.default_member_permissions":
+		var names []string
+		for name := range PermissionNames {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return Schema{"oneOf": []interface{}{
+			Schema{"type": "string", "pattern": "^[0-9]+$"},
+			Schema{"type": "string", "enum": names},
+			Schema{"type": "array", "items": Schema{"type": "string", "enum": names}},
+		}}
+	case "choice.value":
+		return Schema{"type": []interface{}{"string", "number"}}
+	case "environment.Commands":
+		// Replaced once the command definition exists
+		return Schema{}
+	}
+	return nil
+}
+
+// schemaEnum lists the values of the numeric types that have names, so editors can show them
+func schemaEnum(t reflect.Type) Schema {
+	names := make(map[int64]string)
+	switch t {
+	case reflect.TypeOf(discordgo.ApplicationCommandType(0)):
+		for value, name := range CommandTypeNames {
+			names[int64(value)] = name
+		}
+	case reflect.TypeOf(discordgo.ApplicationCommandOptionType(0)):
+		for value, name := range OptionTypeNames {
+			names[int64(value)] = name
+		}
+	case reflect.TypeOf(discordgo.ChannelType(0)):
+		for value, name := range ChannelTypeNames {
+			names[int64(value)] = name
+		}
+	case reflect.TypeOf(discordgo.InteractionContextType(0)):
+		for value, name := range ContextNames {
+			names[int64(value)] = name
+		}
+	case reflect.TypeOf(discordgo.ApplicationIntegrationType(0)):
+		for value, name := range IntegrationTypeNames {
+			names[int64(value)] = name
+		}
+	default:
+		return nil
+	}
+
+	var values []int64
+	for value := range names {
+		values = append(values, value)
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	var alternatives []interface{}
+	for _, value := range values {
+		alternatives = append(alternatives, Schema{"const": value, "title": names[value]})
+	}
+	return Schema{"type": "integer", "oneOf": alternatives}
+}
+
+// symbolicTypeNames lists the names commands.yml accepts in place of the numbers of t
+func symbolicTypeNames(t reflect.Type) []string {
+	var names []string
+	switch t {
+	case reflect.TypeOf(discordgo.ApplicationCommandType(0)):
+		for _, name := range CommandTypeNames {
+			names = append(names, name)
+		}
+	case reflect.TypeOf(discordgo.ApplicationCommandOptionType(0)):
+		for _, name := range OptionTypeNames {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func schemaLocales() []string {
+	var locales []string
+	for _, locale := range sortedLocales(discordgo.Locales) {
+		if len(locale) > 0 {
+			locales = append(locales, string(locale))
+		}
+	}
+	return locales
+}
+
+// ValidateSchema checks every file that was loaded against the schema. Unlike ValidateCommands,
+// it sees the YAML as written, so it points at values that decoding would reject without a line,
+// such as a string where a number belongs.
+func ValidateSchema(yml *AppCmdYml) *ValidationResult {
+	r := &ValidationResult{source: yml.source}
+	if yml.source == nil {
+		return r
+	}
+	schema := CommandsSchema()
+	v := &schemaValidator{r: r, definitions: schema["definitions"].(map[string]interface{})}
+	for i, file := range yml.source.files {
+		root := yml.source.roots[i]
+		if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+			root = root.Content[0]
+		}
+		if root.Kind == 0 || root.Tag == "!!null" {
+			continue
+		}
+		v.file = file
+		v.check(schema, root, "")
+	}
+	return r
+}
+
+type schemaValidator struct {
+	r           *ValidationResult
+	definitions map[string]interface{}
+	file        string
+}
+
+func (v *schemaValidator) addError(rule string, path string, node *yaml.Node, format string, args ...interface{}) {
+	v.r.Problems = append(v.r.Problems, &ValidationProblem{
+		Path:     path,
+		Rule:     rule,
+		Severity: SeverityError,
+		Message:  fmt.Sprintf(format, args...),
+		Position: &SourcePosition{File: v.file, Line: node.Line, Column: node.Column},
+	})
+}
+
+// matches checks node against schema without reporting anything
+func (v *schemaValidator) matches(schema Schema, node *yaml.Node) bool {
+	quiet := &schemaValidator{r: &ValidationResult{}, definitions: v.definitions, file: v.file}
+	quiet.check(schema, node, "")
+	return len(quiet.r.Problems) == 0
+}
+
+func (v *schemaValidator) check(schema Schema, node *yaml.Node, path string) {
+
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if ref, isRef := schema["$ref"].(string); isRef {
+		schema = v.definitions[strings.TrimPrefix(ref, "#/definitions/")].(Schema)
+	}
+
+	if types, exists := schema["type"]; exists && !schemaTypeMatches(types, node) {
+		v.addError(RuleSchemaType, path, node, "expected %s, got %s", schemaTypeNames(types), yamlKindName(node))
+		return
+	}
+
+	if alternatives, exists := schema["oneOf"].([]interface{}); exists {
+		var sameType []Schema
+		for _, alternative := range alternatives {
+			if v.matches(alternative.(Schema), node) {
+				return
+			}
+			if types, exists := alternative.(Schema)["type"]; exists && schemaTypeMatches(types, node) {
+				sameType = append(sameType, alternative.(Schema))
+			}
+		}
+
+		// When only one form is of the right type, the problem is inside it
+		if len(sameType) == 1 {
+			v.check(sameType[0], node, path)
+			return
+		}
+		var allowed []string
+		for _, alternative := range alternatives {
+			if value, isConst := alternative.(Schema)["const"]; isConst {
+				allowed = append(allowed, fmt.Sprintf("%v (%s)", value, alternative.(Schema)["title"]))
+			}
+		}
+		if len(allowed) > 0 {
+			v.addError(RuleSchemaValue, path, node, "%s is not one of: %s", node.Value, strings.Join(allowed, ", "))
+		} else {
+			v.addError(RuleSchemaValue, path, node, "%s is not in any of the forms this field accepts", yamlKindName(node))
+		}
+		return
+	}
+
+	if value, exists := schema["const"]; exists && node.Value != fmt.Sprint(value) {
+		v.addError(RuleSchemaValue, path, node, "expected %v, got %s", value, node.Value)
+	}
+	if enum, exists := schema["enum"].([]string); exists && !containsString(enum, node.Value) {
+		v.addError(RuleSchemaValue, path, node, "%q is not one of the allowed values%s", node.Value,
+			suggestKey(node.Value, enum))
+	}
+	if pattern, exists := schema["pattern"].(string); exists && !regexp.MustCompile(pattern).MatchString(node.Value) {
+		v.addError(RuleSchemaValue, path, node, "%q does not match %s", node.Value, pattern)
+	}
+
+	switch node.Kind {
+	case yaml.SequenceNode:
+		if items, exists := schema["items"].(Schema); exists {
+			for i, item := range node.Content {
+				v.check(items, item, fmt.Sprintf("%s[%d]", path, i))
+			}
+		}
+	case yaml.MappingNode:
+		v.checkMapping(schema, node, path)
+	}
+}
+
+func (v *schemaValidator) checkMapping(schema Schema, node *yaml.Node, path string) {
+
+	properties, _ := schema["properties"].(Schema)
+	var known []string
+	for name := range properties {
+		known = append(known, name)
+	}
+	sort.Strings(known)
+
+	present := make(map[string]bool)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		present[key.Value] = true
+		keyPath := key.Value
+		if len(path) > 0 {
+			keyPath = path + "." + key.Value
+		}
+
+		if names, exists := schema["propertyNames"].(Schema); exists {
+			v.check(names, key, keyPath)
+		}
+		if property, exists := properties[key.Value]; exists {
+			v.check(property.(Schema), value, keyPath)
+			continue
+		}
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				v.addError(RuleSchemaUnknownKey, keyPath, key, "unknown key %q%s", key.Value, suggestKey(key.Value, known))
+			}
+		case Schema:
+			v.check(additional, value, keyPath)
+		}
+	}
+
+	if required, exists := schema["required"].([]string); exists {
+		for _, name := range required {
+			if !present[name] {
+				v.addError(RuleSchemaRequired, path, node, "missing required key %q", name)
+			}
+		}
+	}
+}
+
+func schemaTypeMatches(types interface{}, node *yaml.Node) bool {
+	switch t := types.(type) {
+	case string:
+		switch t {
+		case "object":
+			return node.Kind == yaml.MappingNode
+		case "array":
+			return node.Kind == yaml.SequenceNode
+		case "string":
+			return node.Kind == yaml.ScalarNode && node.Tag == "!!str"
+		case "boolean":
+			return node.Kind == yaml.ScalarNode && node.Tag == "!!bool"
+		case "integer":
+			return node.Kind == yaml.ScalarNode && node.Tag == "!!int"
+		case "number":
+			return node.Kind == yaml.ScalarNode && (node.Tag == "!!int" || node.Tag == "!!float")
+		}
+	case []interface{}:
+		for _, alternative := range t {
+			if schemaTypeMatches(alternative, node) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func schemaTypeNames(types interface{}) string {
+	if list, isList := types.([]interface{}); isList {
+		var names []string
+		for _, name := range list {
+			names = append(names, fmt.Sprint(name))
+		}
+		return strings.Join(names, " or ")
+	}
+	return fmt.Sprint(types)
+}
+
+// yamlKindName describes a node the way the schema would
+func yamlKindName(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "object"
+	case yaml.SequenceNode:
+		return "array"
+	}
+	switch node.Tag {
+	case "!!str":
+		return "string " + strconv.Quote(node.Value)
+	case "!!bool":
+		return "boolean " + node.Value
+	case "!!int":
+		return "integer " + node.Value
+	case "!!float":
+		return "number " + node.Value
+	case "!!null":
+		return "null"
+	}
+	return node.Value
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// suggestKey finds the known name that a misspelt one is closest to, if any is close enough
+func suggestKey(name string, known []string) string {
+	best, bestDistance := "", minInt(3, len([]rune(name))/3+1)
+	for _, candidate := range known {
+		if distance := editDistance(strings.ToLower(name), strings.ToLower(candidate)); distance < bestDistance {
+			best, bestDistance = candidate, distance
+		}
+	}
+	if len(best) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(", did you mean %s?", best)
+}
+
+// editDistance counts the letters to add, remove, change or swap to turn a into b
+func editDistance(a string, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = minInt(d[i-1][j]+1, minInt(d[i][j-1]+1, d[i-1][j-1]+cost))
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = minInt(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateSchemaPointsAtMistakes(t *testing.T) {
+	yml := loadTestYAML(t, "schema/mistakes.yml")
+	result := ValidateSchema(&yml)
+
+	expected := []struct {
+		rule    string
+		line    int
+		message string
+	}{
+		{RuleSchemaValue, 12, "12 is not one of:"},
+		{RuleSchemaRequired, 13, `missing required key "name"`},
+		{RuleSchemaValue, 22, "99 is not one of:"},
+	}
+	if len(result.Problems) != len(expected) {
+		for _, problem := range result.Problems {
+			t.Log(problem.String())
+		}
+		t.Fatalf("Expected %d problems, got %d", len(expected), len(result.Problems))
+	}
+	for i, problem := range result.Problems {
+		if problem.Rule != expected[i].rule || !strings.HasPrefix(problem.Message, expected[i].message) {
+			t.Errorf("Expected %s %q, got %s", expected[i].rule, expected[i].message, problem)
+		}
+		if problem.Position == nil || problem.Position.Line != expected[i].line {
+			t.Errorf("Expected %s to point at line %d, got %v", problem.Rule, expected[i].line, problem.Position)
+		}
+	}
+}
+
+func TestValidCommandsMatchTheSchema(t *testing.T) {
+	files, err := filepath.Glob("test/valid/*.yml")
+	if err != nil {
+		t.Fatalf("Unable to list files: %s", err.Error())
+	}
+	files = append(files, "commands.yml", "test/environments/dev_and_prod.yml")
+	for _, file := range files {
+		yml := GetYAML(&file)
+		if result := ValidateSchema(&yml); len(result.Problems) > 0 {
+			t.Errorf("Expected %s to match the schema, got %v", file, result.Problems)
+		}
+	}
+}
+
+func TestValidateWithSchemaFlag(t *testing.T) {
+	input := testInput(t, "schema/mistakes.yml")
+	if _, out := runTestCLI("validate", "-input", input); strings.Contains(out, RuleSchemaValue) {
+		t.Errorf("Expected the schema to be left alone without -schema, got:\n%s", out)
+	}
+	if code, out := runTestCLI("validate", "-schema", "-input", input); code != ExitInvalid || !strings.Contains(out, RuleSchemaRequired) {
+		t.Errorf("Expected -schema to report the missing name, got %d:\n%s", code, out)
+	}
+}
+
+func TestSchemaIsUpToDate(t *testing.T) {
+	// CI runs the tests, so it fails when the command types change without go generate being run
+	if code, _ := runTestCLI("schema", "-check", "-output", DefaultSchemaPath); code != ExitOK {
+		t.Fatalf("%s is out of date, run go generate ./slash_commands/...", DefaultSchemaPath)
+	}
+
+	stale := t.TempDir() + "/" + DefaultSchemaPath
+	if err := os.WriteFile(stale, []byte("{}\n"), 0644); err != nil {
+		t.Fatalf("Unable to write file: %s", err.Error())
+	}
+	if code, _ := runTestCLI("schema", "-check", "-output", stale); code != ExitStale {
+		t.Errorf("Expected a stale schema to exit with %d, got %d", ExitStale, code)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"github.com/sirupsen/logrus"
+)
+
+// CommandScope is the set of commands registered in one place: globally when
+// GuildID is empty, otherwise in that guild alone
+type CommandScope struct {
+	GuildID  string
+	Commands []*discordgo.ApplicationCommand
+}
+
+// CommandScopes splits the YAML into the global scope followed by one scope per guild,
+// in the order guilds first appear. A guild listed in several groups gets all of their
+// commands. The global scope is always included so stale global commands get removed.
+func CommandScopes(yml *AppCmdYml) []*CommandScope {
+
+	scopes := []*CommandScope{{GuildID: "", Commands: yml.Commands}}
+	byGuild := make(map[string]*CommandScope)
+	for _, group := range yml.Guilds {
+		for _, guildId := range group.GuildIds {
+			scope, exists := byGuild[guildId]
+			if !exists {
+				scope = &CommandScope{GuildID: guildId}
+				byGuild[guildId] = scope
+				scopes = append(scopes, scope)
+			}
+			scope.Commands = append(scope.Commands, group.Commands...)
+		}
+	}
+	return scopes
+}
+
+// RemovedGuildScopes are empty scopes for the guilds the last deploy left commands in that no longer have a
+// scope, such as a guild whose group was removed when its commands were made global. Syncing them deletes
+// the commands left behind, which would otherwise never be synced again.
+func RemovedGuildScopes(scopes []*CommandScope, state *DeployState) []*CommandScope {
+
+	kept := make(map[string]struct{})
+	for _, scope := range scopes {
+		kept[scope.GuildID] = struct{}{}
+	}
+	var removed []*CommandScope
+	for _, scope := range state.Scopes {
+		if _, exists := kept[scope.GuildID]; !exists && len(scope.Commands) > 0 {
+			removed = append(removed, &CommandScope{GuildID: scope.GuildID, Commands: []*discordgo.ApplicationCommand{}})
+		}
+	}
+	return removed
+}
+
+func (s *CommandScope) String() string {
+	if s.GuildID == "" {
+		return "global commands"
+	}
+	return fmt.Sprintf("guild %s commands", s.GuildID)
+}
+
+// IsSnowflake checks the string looks like a Discord ID
+func IsSnowflake(id string) bool {
+	if len(id) == 0 || len(id) > 20 {
+		return false
+	}
+	for _, c := range id {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// SelectScopes picks out the scopes of the listed guilds, leaving out the global scope.
+// With no guilds listed, every scope is kept.
+func SelectScopes(scopes []*CommandScope, guildIds []string) ([]*CommandScope, error) {
+
+	if len(guildIds) == 0 {
+		return scopes, nil
+	}
+
+	byGuild := make(map[string]*CommandScope)
+	for _, scope := range scopes {
+		byGuild[scope.GuildID] = scope
+	}
+
+	var selected []*CommandScope
+	for _, guildId := range guildIds {
+		scope, exists := byGuild[guildId]
+		if !exists || guildId == "" {
+			return nil, fmt.Errorf("guild %s has no commands in commands.yml", guildId)
+		}
+		selected = append(selected, scope)
+	}
+	return selected, nil
+}
+
+// SyncAllCommands syncs the global commands and then each guild's commands on their own
+func SyncAllCommands(getFn AppCmdsGetFn, createFn AppCmdCreateFn, editFn AppCmdEditFn, deleteFn AppCmdDeleteFn,
+	bulkFn AppCmdBulkOverwriteFn, appId *string, yml *AppCmdYml) error {
+	return SyncScopes(getFn, createFn, editFn, deleteFn, bulkFn, appId, CommandScopes(yml))
+}
+
+// SyncScopes is SyncAllCommands for just the given scopes
+func SyncScopes(getFn AppCmdsGetFn, createFn AppCmdCreateFn, editFn AppCmdEditFn, deleteFn AppCmdDeleteFn,
+	bulkFn AppCmdBulkOverwriteFn, appId *string, scopes []*CommandScope) error {
+
+	var errs CommandErrors
+	for _, scope := range scopes {
+		logrus.Infof("Syncing %s", scope)
+		scopeYml := AppCmdYml{Commands: scope.Commands}
+		guildId := scope.GuildID
+		if err := SyncCommands(getFn, createFn, editFn, deleteFn, bulkFn, appId, &guildId, &scopeYml); err != nil {
+			logrus.Errorf("Unable to sync %s: %s", scope, err.Error())
+			errs = appendErrors(errs, err)
+		}
+	}
+	return errs.errorOrNil()
+}
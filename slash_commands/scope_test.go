@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"github.com/bwmarrin/discordgo"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCommandScopes(t *testing.T) {
+	yamlPath, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Unable to build path for input file: %s", err.Error())
+	}
+
+	yamlPath += "/test/valid/guild_commands.yml"
+	yml := GetYAML(&yamlPath)
+	scopes := CommandScopes(&yml)
+
+	expected := []struct {
+		guildId string
+		names   []string
+	}{
+		{"", []string{"helloworld"}},
+		{"123456789012345678", []string{"blep", "helloworld"}},
+		{"876543210987654321", []string{"blep"}},
+	}
+
+	if len(scopes) != len(expected) {
+		t.Fatalf("Expected %d scopes, got %d", len(expected), len(scopes))
+	}
+	for i, scope := range scopes {
+		if scope.GuildID != expected[i].guildId {
+			t.Errorf("Expected scope %d to be guild %q, got %q", i, expected[i].guildId, scope.GuildID)
+		}
+		var names []string
+		for _, cmd := range scope.Commands {
+			names = append(names, cmd.Name)
+		}
+		if strings.Join(names, ",") != strings.Join(expected[i].names, ",") {
+			t.Errorf("Expected %s to hold %v, got %v", scope, expected[i].names, names)
+		}
+	}
+}
+
+func TestSyncAllCommands(t *testing.T) {
+	api := newMockDiscordApi()
+	api.seed("", liveBlep())
+	api.seed("123456789012345678", &discordgo.ApplicationCommand{
+		Type: discordgo.ChatApplicationCommand, Name: "stale", Description: "Promoted to global"})
+
+	yml := AppCmdYml{
+		Commands: []*discordgo.ApplicationCommand{liveBlep()},
+		Guilds: []*GuildCmdYml{{
+			GuildIds: []string{"123456789012345678"},
+			Commands: []*discordgo.ApplicationCommand{
+				{Type: discordgo.ChatApplicationCommand, Name: "helloworld", Description: "Tests our command architecture"},
+			},
+		}},
+	}
+
+	appId := "1234"
+	err := SyncAllCommands(api.Get, api.Create, api.Edit, api.Delete, nil, &appId, &yml)
+	if err != nil {
+		t.Fatalf("Sync failed: %s", err.Error())
+	}
+
+	if len(api.commands[""]) != 1 || api.find("", "blep") == nil {
+		t.Errorf("Expected global commands to be left alone")
+	}
+	guildCmds := api.commands["123456789012345678"]
+	if len(guildCmds) != 1 || guildCmds[0].Name != "helloworld" {
+		t.Errorf("Expected only helloworld in the guild, got %+v", guildCmds)
+	}
+}
+
+func TestPlanScopesPerScope(t *testing.T) {
+	api := newMockDiscordApi()
+	yml := AppCmdYml{
+		Guilds: []*GuildCmdYml{{
+			GuildIds: []string{"123456789012345678"},
+			Commands: []*discordgo.ApplicationCommand{liveBlep()},
+		}},
+	}
+
+	appId := "1234"
+	var out bytes.Buffer
+	if err := PlanScopes(api.Get, &appId, CommandScopes(&yml), FormatText, &out); err != nil {
+		t.Fatalf("Planning failed: %s", err.Error())
+	}
+
+	text := out.String()
+	for _, expected := range []string{"=== global commands ===", "=== guild 123456789012345678 commands ===",
+		"+ chat input command blep"} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("Expected plan to contain %q, got:\n%s", expected, text)
+		}
+	}
+}
+
+func TestIsSnowflake(t *testing.T) {
+	for _, id := range []string{"123456789012345678", "1"} {
+		if !IsSnowflake(id) {
+			t.Errorf("Expected %q to be a snowflake", id)
+		}
+	}
+	for _, id := range []string{"", "guild", "12-34", "123456789012345678901"} {
+		if IsSnowflake(id) {
+			t.Errorf("Expected %q not to be a snowflake", id)
+		}
+	}
+}
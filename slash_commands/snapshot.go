@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"github.com/sirupsen/logrus"
+	"os"
+	"time"
+)
+
+const DefaultSnapshotPath = "commands-snapshot.json"
+
+// Snapshot is every live command in a set of scopes, taken before a deploy so it can be undone
+type Snapshot struct {
+	TakenAt time.Time        `json:"taken_at"`
+	AppID   string           `json:"application_id"`
+	Scopes  []*SnapshotScope `json:"scopes"`
+}
+
+// SnapshotScope is the live commands of a single scope. GuildID is empty for global commands.
+type SnapshotScope struct {
+	GuildID  string                          `json:"guild_id,omitempty"`
+	Commands []*discordgo.ApplicationCommand `json:"commands"`
+}
+
+// RollbackError is a deploy that failed, along with how restoring the snapshot went
+type RollbackError struct {
+	Err        error
+	RestoreErr error
+}
+
+func (e *RollbackError) Error() string {
+	if e.RestoreErr != nil {
+		return fmt.Sprintf("%s\nunable to restore the snapshot, commands may be left half deployed: %s",
+			e.Err.Error(), e.RestoreErr.Error())
+	}
+	return fmt.Sprintf("%s\nthe snapshot was restored, so the live commands are as they were before", e.Err.Error())
+}
+
+func (e *RollbackError) Unwrap() error {
+	return e.Err
+}
+
+// SnapshotError is a deploy that stopped before changing anything, because the snapshot couldn't be
+// taken or saved. Path is where it was being saved, and is empty when the live commands couldn't be fetched.
+type SnapshotError struct {
+	Path string
+	Err  error
+}
+
+func (e *SnapshotError) Error() string {
+	if len(e.Path) > 0 {
+		return fmt.Sprintf("unable to save snapshot to %s, so nothing was deployed: %s", e.Path, e.Err.Error())
+	}
+	return fmt.Sprintf("%s, so nothing was deployed", e.Err.Error())
+}
+
+func (e *SnapshotError) Unwrap() error {
+	return e.Err
+}
+
+// TakeSnapshot fetches the live commands of every scope
+func TakeSnapshot(getFn AppCmdsGetFn, appId *string, scopes []*CommandScope) (*Snapshot, error) {
+
+	snapshot := Snapshot{TakenAt: time.Now().UTC(), AppID: *appId}
+	for _, scope := range scopes {
+		logrus.Debugf("Taking a snapshot of %s", scope)
+		live, err := getFn(*appId, scope.GuildID)
+		if err != nil {
+			return nil, fmt.Errorf("unable to snapshot %s: %w", scope, err)
+		}
+		snapshot.Scopes = append(snapshot.Scopes, &SnapshotScope{GuildID: scope.GuildID, Commands: live})
+	}
+	return &snapshot, nil
+}
+
+func SaveSnapshot(snapshot *Snapshot, path string) error {
+	body, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	logrus.Infof("Saving a snapshot of the live commands to %s", path)
+	return os.WriteFile(path, append(body, '\n'), 0644)
+}
+
+func LoadSnapshot(path string) (*Snapshot, error) {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read snapshot %s: %w", path, err)
+	}
+	var snapshot Snapshot
+	if err = json.Unmarshal(body, &snapshot); err != nil {
+		return nil, fmt.Errorf("unable to parse snapshot %s: %w", path, err)
+	}
+	return &snapshot, nil
+}
+
+// CommandScopes turns the snapshot back into scopes that can be synced, without the fields
+// Discord fills in itself
+func (s *Snapshot) CommandScopes() []*CommandScope {
+	var scopes []*CommandScope
+	for _, scope := range s.Scopes {
+		scopes = append(scopes, &CommandScope{GuildID: scope.GuildID, Commands: stripServerFields(scope.Commands)})
+	}
+	return scopes
+}
+
+// RestoreSnapshot syncs every scope in the snapshot back to how it was
+func RestoreSnapshot(getFn AppCmdsGetFn, createFn AppCmdCreateFn, editFn AppCmdEditFn, deleteFn AppCmdDeleteFn,
+	bulkFn AppCmdBulkOverwriteFn, appId *string, snapshot *Snapshot) error {
+
+	logrus.Infof("Restoring the snapshot taken at %s", snapshot.TakenAt.Format(time.RFC3339))
+	return SyncScopes(getFn, createFn, editFn, deleteFn, bulkFn, appId, snapshot.CommandScopes())
+}
+
+// SyncScopesWithRollback snapshots the live commands of each scope before syncing them, and
+// restores the snapshot if anything fails. The snapshot is saved to snapshotPath first, unless it's empty.
+func SyncScopesWithRollback(getFn AppCmdsGetFn, createFn AppCmdCreateFn, editFn AppCmdEditFn, deleteFn AppCmdDeleteFn,
+	bulkFn AppCmdBulkOverwriteFn, appId *string, scopes []*CommandScope, snapshotPath string) error {
+
+	// Nothing has changed yet, so if the snapshot can't be taken there is nothing to undo
+	snapshot, err := TakeSnapshot(getFn, appId, scopes)
+	if err != nil {
+		return &SnapshotError{Err: err}
+	}
+	if len(snapshotPath) > 0 {
+		if err = SaveSnapshot(snapshot, snapshotPath); err != nil {
+			return &SnapshotError{Path: snapshotPath, Err: err}
+		}
+	}
+
+	err = SyncScopes(getFn, createFn, editFn, deleteFn, bulkFn, appId, scopes)
+	if err == nil {
+		return nil
+	}
+
+	logrus.Errorf("Deploy failed, restoring the live commands from before it")
+	restoreErr := RestoreSnapshot(getFn, createFn, editFn, deleteFn, bulkFn, appId, snapshot)
+	if restoreErr != nil {
+		logrus.Errorf("Unable to restore the snapshot: %s", restoreErr.Error())
+	}
+	return &RollbackError{Err: err, RestoreErr: restoreErr}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"github.com/bwmarrin/discordgo"
+	"os"
+	"testing"
+)
+
+// testSnapshotPath keeps the snapshot apply saves out of the source tree
+func testSnapshotPath(t *testing.T) string {
+	return t.TempDir() + "/" + DefaultSnapshotPath
+}
+
+func TestSyncScopesWithRollbackRestoresOnFailure(t *testing.T) {
+	m := newMockDiscordApi()
+	m.seed("", liveBlep())
+	appId := "1234"
+	path := testSnapshotPath(t)
+
+	// Editing blep works, but creating boop fails, so blep has to be put back
+	create := func(appId string, guildId string, cmd *discordgo.ApplicationCommand) (*discordgo.ApplicationCommand, error) {
+		return nil, errors.New("HTTP 400 Bad Request")
+	}
+	edited := liveBlep()
+	edited.Description = "Send a random adorable animal video"
+	scopes := []*CommandScope{{Commands: []*discordgo.ApplicationCommand{edited,
+		{Type: discordgo.ChatApplicationCommand, Name: "boop", Description: "Boop a random adorable animal"}}}}
+
+	err := SyncScopesWithRollback(m.Get, create, m.Edit, m.Delete, nil, &appId, scopes, path)
+	var rollbackErr *RollbackError
+	if !errors.As(err, &rollbackErr) || rollbackErr.RestoreErr != nil {
+		t.Fatalf("Expected the deploy to fail and be rolled back, got %v", err)
+	}
+	var errs CommandErrors
+	if !errors.As(err, &errs) {
+		t.Errorf("Expected the failed commands to be kept, got %v", err)
+	}
+	if blep := m.find("", "blep"); blep == nil || blep.Description != liveBlep().Description || len(m.commands[""]) != 1 {
+		t.Errorf("Expected blep to be restored, got %v", m.commands[""])
+	}
+
+	snapshot, err := LoadSnapshot(path)
+	if err != nil {
+		t.Fatalf("Expected the snapshot to be saved: %s", err.Error())
+	}
+	if snapshot.AppID != appId || len(snapshot.Scopes) != 1 || len(snapshot.Scopes[0].Commands) != 1 ||
+		snapshot.Scopes[0].Commands[0].Description != liveBlep().Description {
+		t.Errorf("Expected the snapshot to hold the original blep, got %+v", snapshot)
+	}
+}
+
+func TestSyncScopesWithRollbackReportsFailedRestore(t *testing.T) {
+	m := newMockDiscordApi()
+	m.seed("", liveBlep())
+	appId := "1234"
+
+	// Deleting blep works but nothing can be created, including blep when restoring it
+	create := func(appId string, guildId string, cmd *discordgo.ApplicationCommand) (*discordgo.ApplicationCommand, error) {
+		return nil, errors.New("HTTP 403 Forbidden")
+	}
+	scopes := []*CommandScope{{Commands: []*discordgo.ApplicationCommand{
+		{Type: discordgo.ChatApplicationCommand, Name: "boop", Description: "Boop a random adorable animal"}}}}
+
+	err := SyncScopesWithRollback(m.Get, create, m.Edit, m.Delete, nil, &appId, scopes, "")
+	var rollbackErr *RollbackError
+	if !errors.As(err, &rollbackErr) || rollbackErr.RestoreErr == nil {
+		t.Fatalf("Expected the restore to fail, got %v", err)
+	}
+}
+
+func TestCLIRollback(t *testing.T) {
+	m := newMockDiscordApi()
+	useMockDiscord(t, m)
+	ping := &discordgo.ApplicationCommand{Type: discordgo.ChatApplicationCommand, Name: "ping", Description: "Check saluki is up"}
+	m.seed("", ping)
+	input := testInput(t, "valid/guild_commands.yml")
+	path := testSnapshotPath(t)
+
+	if code, _ := runTestCLI("apply", "-snapshot", path, "-state", testStatePath(t), "-input", input); code != ExitOK {
+		t.Fatalf("Expected apply to succeed, got %d", code)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("Expected apply to save a snapshot: %s", err.Error())
+	}
+	if m.find("", "ping") != nil || m.find("876543210987654321", "blep") == nil {
+		t.Fatalf("Expected apply to replace ping, got %v", m.commands)
+	}
+
+	// Rolling back a single guild leaves the rest as deployed
+	if code, _ := runTestCLI("rollback", "-snapshot", path, "-state", testStatePath(t), "-guilds", "876543210987654321"); code != ExitOK {
+		t.Fatalf("Expected rollback to succeed, got %d", code)
+	}
+	if len(m.commands["876543210987654321"]) != 0 || m.find("", "helloworld") == nil {
+		t.Errorf("Expected only guild 876543210987654321 to be rolled back, got %v", m.commands)
+	}
+
+	if code, _ := runTestCLI("rollback", "-snapshot", path, "-state", testStatePath(t)); code != ExitOK {
+		t.Fatalf("Expected rollback to succeed, got %d", code)
+	}
+	if m.find("", "ping") == nil || len(m.commands[""]) != 1 || len(m.commands["123456789012345678"]) != 0 {
+		t.Errorf("Expected the commands from before apply, got %v", m.commands)
+	}
+
+	if code, _ := runTestCLI("rollback", "-snapshot", t.TempDir()+"/missing.json"); code != ExitInvalid {
+		t.Errorf("Expected a missing snapshot to exit with %d, got %d", ExitInvalid, code)
+	}
+}
+
+func TestCLIExitCodeForFailedRollback(t *testing.T) {
+	m := newMockDiscordApi()
+	useMockDiscord(t, m)
+	m.seed("", &discordgo.ApplicationCommand{Type: discordgo.ChatApplicationCommand, Name: "ping", Description: "Check saluki is up"})
+
+	// The global commands are overwritten, then Discord starts refusing everything
+	api, _, _ := connectDiscord()
+	overwrites := 0
+	connectDiscord = func() (*DiscordApi, func(), error) {
+		api.BulkOverwrite = func(appId string, guildId string, cmds []*discordgo.ApplicationCommand) ([]*discordgo.ApplicationCommand, error) {
+			overwrites += 1
+			if overwrites > 1 {
+				return nil, errors.New("HTTP 503 Service Unavailable")
+			}
+			return m.BulkOverwrite(appId, guildId, cmds)
+		}
+		return api, func() {}, nil
+	}
+
+	code, _ := runTestCLI("apply", "-snapshot", testSnapshotPath(t), "-state", testStatePath(t), "-input", testInput(t, "valid/guild_commands.yml"))
+	if code != ExitRollback {
+		t.Errorf("Expected a failed restore to exit with %d, got %d", ExitRollback, code)
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"gopkg.in/yaml.v3"
+	"strconv"
+	"strings"
+)
+
+// SourcePosition is a place in a YAML file
+type SourcePosition struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
+
+func (p *SourcePosition) String() string {
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+// decodeNode decodes YAML by way of JSON, so commands.yml uses the same field names as
+// the Discord API, such as min_value and channel_types. Permissions can be given by name.
+func decodeNode(node *yaml.Node, v interface{}) error {
+	var raw interface{}
+	if err := node.Decode(&raw); err != nil {
+		return err
+	}
+	resolvePermissionNames(raw)
+
+	body, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+// encodeYAML is the reverse of decodeNode. Fields keep the order they are declared in,
+// and strings are quoted the way commands.yml quotes them.
+func encodeYAML(v interface{}) ([]byte, error) {
+
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	node, err := jsonNode(decoder)
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	encoder := yaml.NewEncoder(&b)
+	encoder.SetIndent(2)
+	if err = encoder.Encode(node); err != nil {
+		return nil, err
+	}
+	err = encoder.Close()
+	return b.Bytes(), err
+}
+
+// jsonNode reads the next JSON value from decoder as a YAML node
+func jsonNode(decoder *json.Decoder) (*yaml.Node, error) {
+
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch value := token.(type) {
+	case json.Delim:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		if value == '{' {
+			node = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		}
+		for decoder.More() {
+			var key interface{}
+			if node.Kind == yaml.MappingNode {
+				if key, err = decoder.Token(); err != nil {
+					return nil, err
+				}
+			}
+			item, err := jsonNode(decoder)
+			if err != nil {
+				return nil, err
+			}
+
+			// Fields that aren't set are left out, rather than written as null
+			if node.Kind == yaml.MappingNode {
+				if item.Tag == "!!null" {
+					continue
+				}
+				node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: fmt.Sprint(key)})
+			}
+			node.Content = append(node.Content, item)
+		}
+		// Consume the closing delimiter
+		_, err = decoder.Token()
+		return node, err
+	case string:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value, Style: yaml.DoubleQuotedStyle}, nil
+	case json.Number:
+		tag := "!!int"
+		if strings.ContainsAny(value.String(), ".eE") {
+			tag = "!!float"
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value.String()}, nil
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(value)}, nil
+	}
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}, nil
+}
+
+// yamlSource remembers the file and YAML node each command, option and choice was decoded from
+type yamlSource struct {
+	files []string
+	// The node tree of each file, in the same order as files
+	roots []*yaml.Node
+	nodes map[interface{}]sourceNode
+}
+
+type sourceNode struct {
+	file string
+	node *yaml.Node
+}
+
+func newYamlSource() *yamlSource {
+	return &yamlSource{nodes: make(map[interface{}]sourceNode)}
+}
+
+// addFile records where everything in yml was declared in file, whose node tree starts at root
+func (s *yamlSource) addFile(file string, root *yaml.Node, yml *AppCmdYml) {
+
+	s.files = append(s.files, file)
+	s.roots = append(s.roots, root)
+	if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		root = root.Content[0]
+	}
+
+	commands := mappingValue(root, "Commands")
+	s.addCommands(file, commands, yml.Commands)
+
+	guilds := mappingValue(root, "Guilds")
+	for i, group := range yml.Guilds {
+		node := sequenceItem(guilds, i)
+		s.add(file, group, node)
+		s.addCommands(file, mappingValue(node, "Commands"), group.Commands)
+	}
+
+	environments := mappingValue(root, "Environments")
+	for name, env := range yml.Environments {
+		envNode := mappingValue(environments, name)
+		overlays := mappingValue(envNode, "Commands")
+		for i, overlay := range env.Commands {
+			s.add(file, overlay, sequenceItem(overlays, i))
+		}
+		envGuilds := mappingValue(envNode, "Guilds")
+		for i, group := range env.Guilds {
+			node := sequenceItem(envGuilds, i)
+			s.add(file, group, node)
+			s.addCommands(file, mappingValue(node, "Commands"), group.Commands)
+		}
+	}
+}
+
+// addOverlay points command at the environment overlay that changed it. Commands the overlay
+// added point at it entirely, otherwise only options it replaced do.
+func (s *yamlSource) addOverlay(command *discordgo.ApplicationCommand, overlay *CommandOverlay, added bool) {
+	if s == nil {
+		return
+	}
+	source, exists := s.nodes[overlay]
+	if !exists {
+		return
+	}
+	if added {
+		s.add(source.file, command, source.node)
+	}
+	if options := mappingValue(source.node, "options"); options != nil {
+		s.addOptions(source.file, options, command.Options)
+	}
+}
+
+func (s *yamlSource) add(file string, obj interface{}, node *yaml.Node) {
+	if node != nil {
+		s.nodes[obj] = sourceNode{file: file, node: node}
+	}
+}
+
+func (s *yamlSource) addCommands(file string, node *yaml.Node, commands []*discordgo.ApplicationCommand) {
+	for i, command := range commands {
+		commandNode := sequenceItem(node, i)
+		s.add(file, command, commandNode)
+		s.addOptions(file, mappingValue(commandNode, "options"), command.Options)
+	}
+}
+
+func (s *yamlSource) addOptions(file string, node *yaml.Node, options []*discordgo.ApplicationCommandOption) {
+	for i, option := range options {
+		optionNode := sequenceItem(node, i)
+		s.add(file, option, optionNode)
+		s.addOptions(file, mappingValue(optionNode, "options"), option.Options)
+
+		choices := mappingValue(optionNode, "choices")
+		for j, choice := range option.Choices {
+			s.add(file, choice, sequenceItem(choices, j))
+		}
+	}
+}
+
+// Position finds where obj was declared. When field is set and obj declares it,
+// the position of that field's key is returned instead.
+func (s *yamlSource) Position(obj interface{}, field string) *SourcePosition {
+	if s == nil || obj == nil {
+		return nil
+	}
+
+	source, exists := s.nodes[obj]
+	if !exists {
+		return nil
+	}
+	node := source.node
+	if key := mappingKey(node, field); key != nil {
+		node = key
+	}
+	return &SourcePosition{File: source.file, Line: node.Line, Column: node.Column}
+}
+
+// Value finds the YAML node obj's field was decoded from
+func (s *yamlSource) Value(obj interface{}, field string) *yaml.Node {
+	if s == nil || obj == nil {
+		return nil
+	}
+	source, exists := s.nodes[obj]
+	if !exists {
+		return nil
+	}
+	return mappingValue(source.node, field)
+}
+
+func mappingKey(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode || len(key) == 0 {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i]
+		}
+	}
+	return nil
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func sequenceItem(node *yaml.Node, i int) *yaml.Node {
+	if node == nil || node.Kind != yaml.SequenceNode || i >= len(node.Content) {
+		return nil
+	}
+	return node.Content[i]
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const DefaultStatePath = "commands-state.json"
+
+// DeployState records the commands the last apply left live, so anything changed outside
+// of the pipeline, such as a command edited by hand, can be found later on
+type DeployState struct {
+	DeployedAt time.Time     `json:"deployed_at"`
+	AppID      string        `json:"application_id"`
+	Commit     string        `json:"commit,omitempty"`
+	Scopes     []*StateScope `json:"scopes"`
+}
+
+// StateScope is the deployed commands of a single scope. GuildID is empty for global commands.
+type StateScope struct {
+	GuildID  string          `json:"guild_id,omitempty"`
+	Commands []*StateCommand `json:"commands"`
+}
+
+// StateCommand is a deployed command. Commit is the commit it last changed in.
+type StateCommand struct {
+	Type    discordgo.ApplicationCommandType `json:"type"`
+	Name    string                           `json:"name"`
+	ID      string                           `json:"id"`
+	Version string                           `json:"version"`
+	Hash    string                           `json:"hash"`
+	Commit  string                           `json:"commit,omitempty"`
+}
+
+// CommandHash hashes everything about a command except the fields Discord fills in itself,
+// so the same command has the same hash whatever its ID
+func CommandHash(command *discordgo.ApplicationCommand) (string, error) {
+	body, err := json.Marshal(stripServerFields([]*discordgo.ApplicationCommand{command})[0])
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(body)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// currentCommit is the commit being deployed. CodeBuild checks out a detached HEAD and says
+// which commit it is in the environment, anywhere else git is asked.
+func currentCommit() string {
+	if commit := os.Getenv("CODEBUILD_RESOLVED_SOURCE_VERSION"); len(commit) > 0 {
+		return commit
+	}
+	out, err := exec.Command("git", "rev-parse", "HEAD").Output()
+	if err != nil {
+		logrus.Debugf("Unable to find the current commit: %s", err.Error())
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// RecordState fetches the live commands of every scope after a deploy. Scopes in previous that
+// weren't deployed are kept, and commands that haven't changed keep the commit they came from.
+func RecordState(getFn AppCmdsGetFn, appId *string, scopes []*CommandScope, commit string,
+	previous *DeployState) (*DeployState, error) {
+
+	state := DeployState{DeployedAt: time.Now().UTC(), AppID: *appId, Commit: commit}
+	recorded := make(map[string]*StateScope)
+	if previous != nil && previous.AppID == *appId {
+		for _, scope := range previous.Scopes {
+			recorded[scope.GuildID] = scope
+		}
+	}
+
+	deployed := make(map[string]struct{})
+	for _, scope := range scopes {
+		deployed[scope.GuildID] = struct{}{}
+		live, err := getFn(*appId, scope.GuildID)
+		if err != nil {
+			return nil, fmt.Errorf("unable to record %s: %w", scope, err)
+		}
+
+		before := make(map[string]*StateCommand)
+		if old, exists := recorded[scope.GuildID]; exists {
+			for _, command := range old.Commands {
+				before[command.ID] = command
+			}
+		}
+		stateScope := &StateScope{GuildID: scope.GuildID, Commands: []*StateCommand{}}
+		for _, command := range live {
+			hash, err := CommandHash(command)
+			if err != nil {
+				return nil, err
+			}
+			recordedCommand := &StateCommand{Type: command.Type, Name: command.Name, ID: command.ID,
+				Version: command.Version, Hash: hash, Commit: commit}
+			if old, exists := before[command.ID]; exists && old.Hash == hash {
+				recordedCommand.Commit = old.Commit
+			}
+			stateScope.Commands = append(stateScope.Commands, recordedCommand)
+		}
+		// A guild left with no commands has nothing to check, and no longer needs syncing
+		if len(stateScope.Commands) > 0 || scope.GuildID == "" {
+			state.Scopes = append(state.Scopes, stateScope)
+		}
+	}
+
+	if previous != nil && previous.AppID == *appId {
+		for _, scope := range previous.Scopes {
+			if _, exists := deployed[scope.GuildID]; !exists {
+				state.Scopes = append(state.Scopes, scope)
+			}
+		}
+	}
+	return &state, nil
+}
+
+func SaveState(state *DeployState, path string) error {
+	body, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	logrus.Infof("Saving the deploy state to %s", path)
+	return os.WriteFile(path, append(body, '\n'), 0644)
+}
+
+func LoadState(path string) (*DeployState, error) {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read deploy state %s: %w", path, err)
+	}
+	var state DeployState
+	if err = json.Unmarshal(body, &state); err != nil {
+		return nil, fmt.Errorf("unable to parse deploy state %s: %w", path, err)
+	}
+	return &state, nil
+}
+
+const (
+	DriftChanged = "changed"
+	DriftDeleted = "deleted"
+	DriftAdded   = "added"
+)
+
+// Drift is a live command that isn't the way the last deploy left it
+type Drift struct {
+	GuildID string                           `json:"guild_id,omitempty"`
+	Kind    string                           `json:"kind"`
+	Type    discordgo.ApplicationCommandType `json:"type"`
+	Name    string                           `json:"name"`
+	ID      string                           `json:"id"`
+	// The version that was deployed and the version that is live, for changed commands
+	Version     string `json:"version,omitempty"`
+	LiveVersion string `json:"live_version,omitempty"`
+	// The commit the deployed command came from
+	Commit string `json:"commit,omitempty"`
+}
+
+// DetectDrift compares the live commands of every scope in state with what was deployed.
+// A command is changed when Discord has given it a new version, or its content no longer hashes the same.
+func DetectDrift(getFn AppCmdsGetFn, appId *string, state *DeployState) ([]*Drift, error) {
+
+	drifts := []*Drift{}
+	for _, scope := range state.Scopes {
+		commandScope := &CommandScope{GuildID: scope.GuildID}
+		logrus.Debugf("Checking %s for drift", commandScope)
+		live, err := getFn(*appId, scope.GuildID)
+		if err != nil {
+			return nil, fmt.Errorf("unable to fetch %s: %w", commandScope, err)
+		}
+
+		byId := make(map[string]*discordgo.ApplicationCommand)
+		for _, command := range live {
+			byId[command.ID] = command
+		}
+		deployed := make(map[string]struct{})
+		for _, command := range scope.Commands {
+			deployed[command.ID] = struct{}{}
+			drift := &Drift{GuildID: scope.GuildID, Type: command.Type, Name: command.Name, ID: command.ID,
+				Commit: command.Commit}
+
+			current, exists := byId[command.ID]
+			if !exists {
+				drift.Kind = DriftDeleted
+				drifts = append(drifts, drift)
+				continue
+			}
+			hash, err := CommandHash(current)
+			if err != nil {
+				return nil, err
+			}
+			if current.Version != command.Version || hash != command.Hash {
+				drift.Kind = DriftChanged
+				drift.Name = current.Name
+				drift.Version = command.Version
+				drift.LiveVersion = current.Version
+				drifts = append(drifts, drift)
+			}
+		}
+
+		for _, command := range live {
+			if _, exists := deployed[command.ID]; !exists {
+				drifts = append(drifts, &Drift{GuildID: scope.GuildID, Kind: DriftAdded, Type: command.Type,
+					Name: command.Name, ID: command.ID})
+			}
+		}
+	}
+	return drifts, nil
+}
+
+// FormatDriftText lists the drift of each scope, one line per command
+func FormatDriftText(state *DeployState, drifts []*Drift, out io.Writer) error {
+
+	var b strings.Builder
+	byScope := make(map[string][]*Drift)
+	for _, drift := range drifts {
+		byScope[drift.GuildID] = append(byScope[drift.GuildID], drift)
+	}
+	for _, scope := range state.Scopes {
+		scopeDrifts := byScope[scope.GuildID]
+		if len(scopeDrifts) == 0 {
+			continue
+		}
+		commandScope := CommandScope{GuildID: scope.GuildID}
+		fmt.Fprintf(&b, "=== %s ===\n", commandScope.String())
+		for _, drift := range scopeDrifts {
+			from := ""
+			if len(drift.Commit) > 0 {
+				from = ", deployed from " + drift.Commit
+			}
+			switch drift.Kind {
+			case DriftChanged:
+				fmt.Fprintf(&b, "~ %s %s (ID: %s): version %s -> %s%s\n", commandTypeName(drift.Type), drift.Name,
+					drift.ID, drift.Version, drift.LiveVersion, from)
+			case DriftDeleted:
+				fmt.Fprintf(&b, "- %s %s (ID: %s)%s\n", commandTypeName(drift.Type), drift.Name, drift.ID, from)
+			case DriftAdded:
+				fmt.Fprintf(&b, "+ %s %s (ID: %s)\n", commandTypeName(drift.Type), drift.Name, drift.ID)
+			}
+		}
+	}
+
+	if len(drifts) == 0 {
+		fmt.Fprintf(&b, "No drift. Live commands match the deploy at %s\n", state.DeployedAt.Format(time.RFC3339))
+	} else {
+		counts := make(map[string]int)
+		for _, drift := range drifts {
+			counts[drift.Kind] += 1
+		}
+		fmt.Fprintf(&b, "Drift: %d changed, %d deleted, %d added since the deploy at %s\n", counts[DriftChanged],
+			counts[DriftDeleted], counts[DriftAdded], state.DeployedAt.Format(time.RFC3339))
+	}
+	_, err := io.WriteString(out, b.String())
+	return err
+}
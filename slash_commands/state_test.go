@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/bwmarrin/discordgo"
+	"strings"
+	"testing"
+)
+
+// testStatePath keeps the deploy state apply records out of the source tree
+func testStatePath(t *testing.T) string {
+	return t.TempDir() + "/" + DefaultStatePath
+}
+
+func TestCommandHashIgnoresServerFields(t *testing.T) {
+	deployed := liveBlep()
+	hash, err := CommandHash(deployed)
+	if err != nil {
+		t.Fatalf("Unable to hash command: %s", err.Error())
+	}
+
+	live := liveBlep()
+	live.ID, live.Version, live.ApplicationID = "42", "7", "1234"
+	if other, _ := CommandHash(live); other != hash {
+		t.Errorf("Expected the same hash whatever the ID and version, got %s and %s", hash, other)
+	}
+	live.Description = "Send a random animal photo"
+	if other, _ := CommandHash(live); other == hash {
+		t.Errorf("Expected a changed description to change the hash")
+	}
+}
+
+func TestDetectDrift(t *testing.T) {
+	m := newMockDiscordApi()
+	ping := &discordgo.ApplicationCommand{Type: discordgo.ChatApplicationCommand, Name: "ping", Description: "Check saluki is up"}
+	m.seed("", liveBlep(), ping)
+	m.seed("123456789012345678", liveBlep())
+	appId := "1234"
+	scopes := []*CommandScope{{GuildID: ""}, {GuildID: "123456789012345678"}}
+
+	state, err := RecordState(m.Get, &appId, scopes, "abc123", nil)
+	if err != nil {
+		t.Fatalf("Unable to record state: %s", err.Error())
+	}
+	if len(state.Scopes) != 2 || len(state.Scopes[0].Commands) != 2 || state.Scopes[0].Commands[0].Commit != "abc123" {
+		t.Fatalf("Expected both scopes to be recorded, got %+v", state.Scopes)
+	}
+	if drifts, _ := DetectDrift(m.Get, &appId, state); len(drifts) != 0 {
+		t.Fatalf("Expected no drift straight after a deploy, got %v", drifts)
+	}
+
+	// Someone edits blep, deletes ping and adds a command by hand
+	changed := liveBlep()
+	changed.Description = "Send a random animal photo"
+	if _, err = m.Edit(appId, "", m.find("", "blep").ID, changed); err != nil {
+		t.Fatalf("Unable to edit blep: %s", err.Error())
+	}
+	_ = m.Delete(appId, "", ping.ID)
+	m.seed("123456789012345678", &discordgo.ApplicationCommand{Type: discordgo.UserApplicationCommand, Name: "Report User"})
+
+	drifts, err := DetectDrift(m.Get, &appId, state)
+	if err != nil {
+		t.Fatalf("Unable to detect drift: %s", err.Error())
+	}
+	var found []string
+	for _, drift := range drifts {
+		found = append(found, drift.Kind+" "+drift.Name)
+	}
+	if strings.Join(found, ", ") != "changed blep, deleted ping, added Report User" {
+		t.Fatalf("Unexpected drift: %v", found)
+	}
+	if drifts[0].Version == drifts[0].LiveVersion || drifts[0].Commit != "abc123" {
+		t.Errorf("Expected the versions and the commit blep was deployed from, got %+v", drifts[0])
+	}
+}
+
+func TestRecordStateKeepsCommitsOfUnchangedCommands(t *testing.T) {
+	m := newMockDiscordApi()
+	m.seed("", liveBlep())
+	m.seed("123456789012345678", liveBlep())
+	appId := "1234"
+
+	first, _ := RecordState(m.Get, &appId, []*CommandScope{{GuildID: ""}, {GuildID: "123456789012345678"}}, "abc123", nil)
+	m.seed("", &discordgo.ApplicationCommand{Type: discordgo.ChatApplicationCommand, Name: "ping", Description: "Check saluki is up"})
+
+	// Only the global scope is deployed the second time
+	second, err := RecordState(m.Get, &appId, []*CommandScope{{GuildID: ""}}, "def456", first)
+	if err != nil {
+		t.Fatalf("Unable to record state: %s", err.Error())
+	}
+	if len(second.Scopes) != 2 || second.Scopes[1].GuildID != "123456789012345678" {
+		t.Fatalf("Expected the guild scope to be kept, got %+v", second.Scopes)
+	}
+	commits := make(map[string]string)
+	for _, command := range second.Scopes[0].Commands {
+		commits[command.Name] = command.Commit
+	}
+	if commits["blep"] != "abc123" || commits["ping"] != "def456" {
+		t.Errorf("Expected blep to keep its commit and ping to get the new one, got %v", commits)
+	}
+}
+
+func TestCLIDrift(t *testing.T) {
+	m := newMockDiscordApi()
+	useMockDiscord(t, m)
+	state := testStatePath(t)
+	input := testInput(t, "valid/guild_commands.yml")
+
+	if code, _ := runTestCLI("apply", "-snapshot", testSnapshotPath(t), "-state", state, "-commit", "abc123", "-input", input); code != ExitOK {
+		t.Fatalf("Expected apply to succeed, got %d", code)
+	}
+	if code, out := runTestCLI("drift", "-state", state); code != ExitOK || !strings.HasPrefix(out, "No drift") {
+		t.Fatalf("Expected no drift after apply, got %d:\n%s", code, out)
+	}
+
+	blep := m.find("876543210987654321", "blep")
+	_ = m.Delete("1234", "876543210987654321", blep.ID)
+	code, out := runTestCLI("drift", "-state", state)
+	if code != ExitDrift || !strings.Contains(out, "- chat input command blep (ID: "+blep.ID+"), deployed from abc123") {
+		t.Errorf("Expected the deleted command to be drift, got %d:\n%s", code, out)
+	}
+
+	// Other guilds can be checked on their own
+	if code, _ = runTestCLI("drift", "-state", state, "-guilds", "123456789012345678"); code != ExitOK {
+		t.Errorf("Expected no drift in guild 123456789012345678, got %d", code)
+	}
+
+	code, out = runTestCLI("drift", "-state", state, "-format", "json")
+	var drifts []*Drift
+	if err := json.Unmarshal([]byte(out), &drifts); err != nil || code != ExitDrift || len(drifts) != 1 {
+		t.Errorf("Expected a single drift as JSON, got %d:\n%s", code, out)
+	}
+
+	if code, _ = runTestCLI("drift", "-state", t.TempDir()+"/missing.json"); code != ExitInvalid {
+		t.Errorf("Expected a missing deploy state to exit with %d, got %d", ExitInvalid, code)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DecodeError lists the problems that stop a file from being decoded, each with its line
+type DecodeError struct {
+	Problems []*ValidationProblem
+}
+
+func (e *DecodeError) Error() string {
+	var lines []string
+	for _, problem := range e.Problems {
+		lines = append(lines, fmt.Sprintf("line %d: %s: %s", problem.Position.Line, problem.Path, problem.Message))
+	}
+	return "unmarshal errors:\n  " + strings.Join(lines, "\n  ")
+}
+
+// checkKnownFields is the KnownFields of yaml.v3 for commands.yml. Decoding goes through JSON,
+// which ignores keys it doesn't know, so the keys are checked against the schema beforehand.
+func checkKnownFields(file string, root *yaml.Node) error {
+	return schemaDecodeError(file, root, RuleSchemaUnknownKey)
+}
+
+// explainDecodeError finds the lines behind err. JSON reports a value of the wrong type by its
+// path alone, so the schema is asked where it is, and err is kept if the schema doesn't know.
+func explainDecodeError(file string, root *yaml.Node, err error) error {
+	if explained := schemaDecodeError(file, root, RuleSchemaType); explained != nil {
+		return explained
+	}
+	return err
+}
+
+// schemaDecodeError checks root against the schema, keeping only the problems with one of rules
+func schemaDecodeError(file string, root *yaml.Node, rules ...string) error {
+
+	schema := CommandsSchema()
+	v := &schemaValidator{r: &ValidationResult{}, definitions: schema["definitions"].(map[string]interface{}), file: file}
+	if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		v.check(schema, root.Content[0], "")
+	}
+
+	err := &DecodeError{}
+	for _, problem := range v.r.Problems {
+		if containsString(rules, problem.Rule) {
+			err.Problems = append(err.Problems, problem)
+		}
+	}
+	if len(err.Problems) > 0 {
+		return err
+	}
+	return nil
+}
+
+// resolveTypeNames turns command and option types written by name, such as type: string,
+// into their numbers, in the node tree itself so environment overlays get numbers too
+func resolveTypeNames(root *yaml.Node) error {
+	if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		root = root.Content[0]
+	}
+
+	var commands []*yaml.Node
+	commands = append(commands, sequenceItems(mappingValue(root, "Commands"))...)
+	for _, group := range sequenceItems(mappingValue(root, "Guilds")) {
+		commands = append(commands, sequenceItems(mappingValue(group, "Commands"))...)
+	}
+	if environments := mappingValue(root, "Environments"); environments != nil && environments.Kind == yaml.MappingNode {
+		for i := 1; i < len(environments.Content); i += 2 {
+			env := environments.Content[i]
+			commands = append(commands, sequenceItems(mappingValue(env, "Commands"))...)
+			for _, group := range sequenceItems(mappingValue(env, "Guilds")) {
+				commands = append(commands, sequenceItems(mappingValue(group, "Commands"))...)
+			}
+		}
+	}
+
+	commandTypes := make(map[string]int)
+	for value, name := range CommandTypeNames {
+		commandTypes[name] = int(value)
+	}
+	optionTypes := make(map[string]int)
+	for value, name := range OptionTypeNames {
+		optionTypes[name] = int(value)
+	}
+
+	for _, command := range commands {
+		if err := resolveTypeName(mappingValue(command, "type"), "command", commandTypes); err != nil {
+			return err
+		}
+		if err := resolveOptionTypeNames(mappingValue(command, "options"), optionTypes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func resolveOptionTypeNames(options *yaml.Node, optionTypes map[string]int) error {
+	for _, option := range sequenceItems(options) {
+		if err := resolveTypeName(mappingValue(option, "type"), "option", optionTypes); err != nil {
+			return err
+		}
+		if err := resolveOptionTypeNames(mappingValue(option, "options"), optionTypes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveTypeName replaces a type name in node with its number. Numbers are left as they are.
+func resolveTypeName(node *yaml.Node, kind string, types map[string]int) error {
+	if node == nil || node.Kind != yaml.ScalarNode || node.Tag != "!!str" {
+		return nil
+	}
+
+	value, exists := types[node.Value]
+	if !exists {
+		var names []string
+		for name := range types {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("line %d: unknown %s type %q, expected a number or one of %s%s", node.Line, kind,
+			node.Value, strings.Join(names, ", "), suggestKey(node.Value, names))
+	}
+	node.Value = strconv.Itoa(value)
+	node.Tag = "!!int"
+	node.Style = 0
+	return nil
+}
+
+// sequenceItems lists the items of a sequence node, or nothing for any other node
+func sequenceItems(node *yaml.Node) []*yaml.Node {
+	if node == nil || node.Kind != yaml.SequenceNode {
+		return nil
+	}
+	return node.Content
+}
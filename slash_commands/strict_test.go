@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"github.com/bwmarrin/discordgo"
+	"strings"
+	"testing"
+)
+
+func TestUnknownKeysFailTheLoad(t *testing.T) {
+	_, err := LoadYAML(testInput(t, "strict/unknown_keys.yml"))
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("Expected a DecodeError, got %v", err)
+	}
+
+	expected := []struct {
+		line    int
+		message string
+	}{
+		{9, `unknown key "requierd", did you mean required?`},
+		{12, `unknown key "Comands", did you mean Commands?`},
+	}
+	if len(decodeErr.Problems) != len(expected) {
+		t.Fatalf("Expected %d problems, got %s", len(expected), err.Error())
+	}
+	for i, problem := range decodeErr.Problems {
+		if problem.Position.Line != expected[i].line || problem.Message != expected[i].message {
+			t.Errorf("Expected %q on line %d, got %s", expected[i].message, expected[i].line, problem)
+		}
+	}
+	if !strings.Contains(err.Error(), "line 9: Commands[0].options[0].requierd: unknown key") {
+		t.Errorf("Expected the error to point at the line, got %s", err.Error())
+	}
+}
+
+func TestValuesOfTheWrongTypeFailTheLoad(t *testing.T) {
+	_, err := LoadYAML(testInput(t, "strict/wrong_value_type.yml"))
+	if err == nil || !strings.Contains(err.Error(), `line 9: Commands[0].options[0].required: expected boolean`) {
+		t.Errorf("Expected the wrong type to point at line 9, got %v", err)
+	}
+}
+
+func TestSymbolicTypeNames(t *testing.T) {
+	yml := loadTestYAML(t, "valid/symbolic_types.yml")
+
+	game := yml.Commands[0]
+	if game.Type != discordgo.ChatApplicationCommand || game.Options[0].Type != discordgo.ApplicationCommandOptionSubCommand ||
+		game.Options[1].Type != discordgo.ApplicationCommandOptionSubCommandGroup {
+		t.Errorf("Expected chat_input, subcommand and subcommand_group, got %+v", game)
+	}
+	start := game.Options[0].Options
+	if start[0].Type != discordgo.ApplicationCommandOptionInteger || start[1].Type != discordgo.ApplicationCommandOptionUser {
+		t.Errorf("Expected integer and user options, got %v and %v", start[0].Type, start[1].Type)
+	}
+
+	// user is a context menu command at the top level, and an option beneath it
+	if yml.Commands[1].Type != discordgo.UserApplicationCommand || yml.Commands[2].Type != discordgo.MessageApplicationCommand {
+		t.Errorf("Expected a user and a message command, got %v and %v", yml.Commands[1].Type, yml.Commands[2].Type)
+	}
+
+	// Environments are decoded as JSON later on, so they need the numbers too
+	if err := ApplyEnvironment(&yml, "dev"); err != nil {
+		t.Fatalf("Unable to apply environment: %s", err.Error())
+	}
+	if len(yml.Commands) != 3 || yml.Commands[1].NSFW == nil || !*yml.Commands[1].NSFW {
+		t.Errorf("Expected the dev overlay to change Challenge, got %s", commandNames(yml.Commands))
+	}
+}
+
+func TestUnknownTypeNames(t *testing.T) {
+	_, err := LoadYAML(testInput(t, "strict/unknown_type_name.yml"))
+	if err == nil || !strings.Contains(err.Error(), `line 8: unknown option type "strnig"`) ||
+		!strings.HasSuffix(err.Error(), "did you mean string?") {
+		t.Errorf("Expected the unknown type to point at line 8, got %v", err)
+	}
+}
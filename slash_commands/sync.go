@@ -0,0 +1,530 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"github.com/sirupsen/logrus"
+	"reflect"
+	"sort"
+)
+
+type AppCmdEditFn = func(string, string, string, *discordgo.ApplicationCommand) (*discordgo.ApplicationCommand, error)
+type AppCmdBulkOverwriteFn = func(string, string, []*discordgo.ApplicationCommand) ([]*discordgo.ApplicationCommand, error)
+
+type SyncAction string
+
+const (
+	SyncCreate SyncAction = "create"
+	SyncEdit   SyncAction = "edit"
+	SyncDelete SyncAction = "delete"
+
+	// SyncOverwrite is never planned, it is how a command sent in a bulk overwrite is reported
+	SyncOverwrite SyncAction = "overwrite"
+)
+
+type ChangeKind string
+
+const (
+	ChangeAdded   ChangeKind = "added"
+	ChangeChanged ChangeKind = "changed"
+	ChangeRemoved ChangeKind = "removed"
+)
+
+// FieldChange describes a single field that differs between a live command and
+// its definition in commands.yml. Options that only exist on one side are reported
+// as added or removed, with the whole option in New or Old.
+type FieldChange struct {
+	Kind ChangeKind  `json:"kind"`
+	Path string      `json:"path"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// SyncOperation is a single Discord API call needed to bring a command in line with commands.yml
+type SyncOperation struct {
+	Action  SyncAction                       `json:"action"`
+	Name    string                           `json:"name"`
+	Type    discordgo.ApplicationCommandType `json:"type"`
+	ID      string                           `json:"id,omitempty"`
+	Changes []FieldChange                    `json:"changes,omitempty"`
+	Live    *discordgo.ApplicationCommand    `json:"-"`
+	Desired *discordgo.ApplicationCommand    `json:"desired,omitempty"`
+}
+
+// SyncPlan is the smallest set of create, edit and delete calls that turns the live
+// commands into the ones described by commands.yml
+type SyncPlan struct {
+	GuildID    string           `json:"guild_id"`
+	Operations []*SyncOperation `json:"operations"`
+	Unchanged  []string         `json:"unchanged"`
+}
+
+func (p *SyncPlan) IsEmpty() bool {
+	return len(p.Operations) == 0
+}
+
+// Count returns how many operations of the given action the plan holds
+func (p *SyncPlan) Count(action SyncAction) int {
+	n := 0
+	for _, op := range p.Operations {
+		if op.Action == action {
+			n += 1
+		}
+	}
+	return n
+}
+
+type commandKey struct {
+	Type discordgo.ApplicationCommandType
+	Name string
+}
+
+func keyOf(cmd *discordgo.ApplicationCommand) commandKey {
+
+	// Discord treats a missing type as a chat input command
+	cmdType := cmd.Type
+	if cmdType == 0 {
+		cmdType = discordgo.ChatApplicationCommand
+	}
+	return commandKey{Type: cmdType, Name: cmd.Name}
+}
+
+// PlanSync works out which commands need to be created, edited or deleted in a scope, which is global when
+// guildId is empty. Commands are matched on type and name, since that is what Discord keys them on.
+func PlanSync(live []*discordgo.ApplicationCommand, desired []*discordgo.ApplicationCommand, guildId string) *SyncPlan {
+
+	plan := SyncPlan{GuildID: guildId}
+	liveByKey := make(map[commandKey]*discordgo.ApplicationCommand)
+	for _, cmd := range live {
+		liveByKey[keyOf(cmd)] = cmd
+	}
+
+	seen := make(map[commandKey]struct{})
+	for _, cmd := range desired {
+		key := keyOf(cmd)
+		seen[key] = struct{}{}
+
+		liveCmd, exists := liveByKey[key]
+		if !exists {
+			plan.Operations = append(plan.Operations, &SyncOperation{
+				Action:  SyncCreate,
+				Name:    key.Name,
+				Type:    key.Type,
+				Desired: cmd,
+			})
+			continue
+		}
+
+		changes := DiffCommand(liveCmd, cmd, guildId)
+		if len(changes) == 0 {
+			plan.Unchanged = append(plan.Unchanged, key.Name)
+			continue
+		}
+
+		// Editing rather than recreating keeps the command ID stable
+		plan.Operations = append(plan.Operations, &SyncOperation{
+			Action:  SyncEdit,
+			Name:    key.Name,
+			Type:    key.Type,
+			ID:      liveCmd.ID,
+			Changes: changes,
+			Live:    liveCmd,
+			Desired: cmd,
+		})
+	}
+
+	for _, cmd := range live {
+		if _, exists := seen[keyOf(cmd)]; exists {
+			continue
+		}
+		plan.Operations = append(plan.Operations, &SyncOperation{
+			Action: SyncDelete,
+			Name:   cmd.Name,
+			Type:   keyOf(cmd).Type,
+			ID:     cmd.ID,
+			Live:   cmd,
+		})
+	}
+
+	return &plan
+}
+
+// GetSyncPlan fetches the live commands and plans the changes needed to match yml
+func GetSyncPlan(getFn AppCmdsGetFn, appId *string, guildId *string, yml *AppCmdYml) (*SyncPlan, error) {
+
+	logrus.Debugf("Fetching live commands to plan sync...")
+	live, err := getFn(*appId, *guildId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve live commands: %w", err)
+	}
+
+	return PlanSync(live, yml.Commands, *guildId), nil
+}
+
+// ApplySyncPlan makes one create, edit or delete call per operation in the plan. Deletes go first, then
+// edits, then creates, so a renamed command isn't created while Discord's limit of 100 is still full.
+func ApplySyncPlan(createFn AppCmdCreateFn, editFn AppCmdEditFn, deleteFn AppCmdDeleteFn,
+	appId *string, guildId *string, plan *SyncPlan) error {
+
+	var errs CommandErrors
+	for _, action := range []SyncAction{SyncDelete, SyncEdit, SyncCreate} {
+		for _, op := range plan.Operations {
+			if op.Action != action {
+				continue
+			}
+			var err error
+			switch op.Action {
+			case SyncCreate:
+				logrus.Debugf("Creating command (Name: %s)", op.Name)
+				_, err = createFn(*appId, *guildId, op.Desired)
+			case SyncEdit:
+				logrus.Debugf("Editing command (ID: %s, Name: %s)", op.ID, op.Name)
+				_, err = editFn(*appId, *guildId, op.ID, op.Desired)
+			case SyncDelete:
+				logrus.Debugf("Deleting command (ID: %s, Name: %s)", op.ID, op.Name)
+				err = deleteFn(*appId, *guildId, op.ID)
+			}
+
+			if err != nil {
+				logrus.Errorf("Unable to %s command %s: %s", op.Action, op.Name, err.Error())
+				errs = append(errs, &CommandError{Action: op.Action, Name: op.Name, ID: op.ID, GuildID: *guildId, Err: err})
+			}
+		}
+	}
+	return errs.errorOrNil()
+}
+
+// SyncCommands brings the live commands in line with yml. When bulkFn is set and
+// something needs to change, the whole command set is sent in a single bulk overwrite,
+// which Discord applies by name so unchanged commands keep their IDs.
+func SyncCommands(getFn AppCmdsGetFn, createFn AppCmdCreateFn, editFn AppCmdEditFn, deleteFn AppCmdDeleteFn,
+	bulkFn AppCmdBulkOverwriteFn, appId *string, guildId *string, yml *AppCmdYml) error {
+
+	plan, err := GetSyncPlan(getFn, appId, guildId, yml)
+	if err != nil {
+		return err
+	}
+
+	logrus.Infof("Sync plan: %d to create, %d to edit, %d to delete, %d unchanged",
+		plan.Count(SyncCreate), plan.Count(SyncEdit), plan.Count(SyncDelete), len(plan.Unchanged))
+	if plan.IsEmpty() {
+		return nil
+	}
+
+	if bulkFn != nil {
+		logrus.Debugf("Overwriting %d commands in bulk", len(yml.Commands))
+		if _, err = bulkFn(*appId, *guildId, yml.Commands); err != nil {
+			return bulkOverwriteErrors(*guildId, yml.Commands, err)
+		}
+		return nil
+	}
+
+	return ApplySyncPlan(createFn, editFn, deleteFn, appId, guildId, plan)
+}
+
+// bulkOverwriteErrors names the commands a failed bulk overwrite was rejected for. Discord
+// reports problems with each command under its index in the list, otherwise every command failed.
+func bulkOverwriteErrors(guildId string, commands []*discordgo.ApplicationCommand, err error) error {
+
+	var errs CommandErrors
+	if apiErr, isAPIErr := err.(*APIError); isAPIErr && len(apiErr.Errors) > 0 {
+		var byIndex map[string]json.RawMessage
+		if json.Unmarshal(apiErr.Errors, &byIndex) == nil {
+			for i, command := range commands {
+				if details, exists := byIndex[fmt.Sprint(i)]; exists {
+					errs = append(errs, &CommandError{Action: SyncOverwrite, Name: command.Name, GuildID: guildId,
+						Err: fmt.Errorf("%s: %s", apiErr.Message, details)})
+				}
+			}
+		}
+	}
+	if len(errs) == 0 {
+		for _, command := range commands {
+			errs = append(errs, &CommandError{Action: SyncOverwrite, Name: command.Name, GuildID: guildId, Err: err})
+		}
+	}
+	return errs
+}
+
+// DiffCommand compares a live command against its definition field by field. Commands in a guild, when guildId
+// isn't empty, can't be used in DMs or installed to users, so their DM and install settings aren't compared.
+func DiffCommand(live *discordgo.ApplicationCommand, desired *discordgo.ApplicationCommand, guildId string) []FieldChange {
+
+	var changes []FieldChange
+	if live.Description != desired.Description {
+		changes = append(changes, FieldChange{Kind: ChangeChanged, Path: "description",
+			Old: live.Description, New: desired.Description})
+	}
+	if !localizationsEqual(derefLocalizations(live.NameLocalizations), derefLocalizations(desired.NameLocalizations)) {
+		changes = append(changes, FieldChange{Kind: ChangeChanged, Path: "name_localizations",
+			Old: derefLocalizations(live.NameLocalizations), New: derefLocalizations(desired.NameLocalizations)})
+	}
+	if !localizationsEqual(derefLocalizations(live.DescriptionLocalizations), derefLocalizations(desired.DescriptionLocalizations)) {
+		changes = append(changes, FieldChange{Kind: ChangeChanged, Path: "description_localizations",
+			Old: derefLocalizations(live.DescriptionLocalizations), New: derefLocalizations(desired.DescriptionLocalizations)})
+	}
+
+	// Discord reports default_permission as true when it was never set
+	if boolOrTrue(live.DefaultPermission) != boolOrTrue(desired.DefaultPermission) {
+		changes = append(changes, FieldChange{Kind: ChangeChanged, Path: "default_permission",
+			Old: boolOrTrue(live.DefaultPermission), New: boolOrTrue(desired.DefaultPermission)})
+	}
+	if !int64PtrEqual(live.DefaultMemberPermissions, desired.DefaultMemberPermissions) {
+		changes = append(changes, FieldChange{Kind: ChangeChanged, Path: "default_member_permissions",
+			Old: permissionsValue(live.DefaultMemberPermissions), New: permissionsValue(desired.DefaultMemberPermissions)})
+	}
+	if boolOrFalse(live.NSFW) != boolOrFalse(desired.NSFW) {
+		changes = append(changes, FieldChange{Kind: ChangeChanged, Path: "nsfw",
+			Old: boolOrFalse(live.NSFW), New: boolOrFalse(desired.NSFW)})
+	}
+
+	if len(guildId) > 0 {
+		return append(changes, diffOptions("", live.Options, desired.Options)...)
+	}
+	// Discord picks the contexts and integration types of commands that don't set them, and
+	// works out dm_permission from contexts, so those are only compared when commands.yml sets them
+	if desired.Contexts == nil && boolOrTrue(live.DMPermission) != boolOrTrue(desired.DMPermission) {
+		changes = append(changes, FieldChange{Kind: ChangeChanged, Path: "dm_permission",
+			Old: boolOrTrue(live.DMPermission), New: boolOrTrue(desired.DMPermission)})
+	}
+	if desired.Contexts != nil && (live.Contexts == nil || !contextsEqual(*live.Contexts, *desired.Contexts)) {
+		changes = append(changes, FieldChange{Kind: ChangeChanged, Path: "contexts",
+			Old: live.Contexts, New: desired.Contexts})
+	}
+	if desired.IntegrationTypes != nil && (live.IntegrationTypes == nil ||
+		!integrationTypesEqual(*live.IntegrationTypes, *desired.IntegrationTypes)) {
+		changes = append(changes, FieldChange{Kind: ChangeChanged, Path: "integration_types",
+			Old: live.IntegrationTypes, New: desired.IntegrationTypes})
+	}
+
+	return append(changes, diffOptions("", live.Options, desired.Options)...)
+}
+
+func diffOptions(path string, live []*discordgo.ApplicationCommandOption, desired []*discordgo.ApplicationCommandOption) []FieldChange {
+
+	var changes []FieldChange
+	liveByName := make(map[string]*discordgo.ApplicationCommandOption)
+	var liveOrder []string
+	for _, option := range live {
+		liveByName[option.Name] = option
+		liveOrder = append(liveOrder, option.Name)
+	}
+
+	seen := make(map[string]struct{})
+	var desiredOrder []string
+	for _, option := range desired {
+		seen[option.Name] = struct{}{}
+		optionPath := joinPath(path, option.Name)
+
+		liveOption, exists := liveByName[option.Name]
+		if !exists {
+			changes = append(changes, FieldChange{Kind: ChangeAdded, Path: optionPath, New: option})
+			continue
+		}
+		desiredOrder = append(desiredOrder, option.Name)
+		changes = append(changes, diffOption(optionPath, liveOption, option)...)
+	}
+
+	var keptOrder []string
+	for _, option := range live {
+		if _, exists := seen[option.Name]; !exists {
+			changes = append(changes, FieldChange{Kind: ChangeRemoved, Path: joinPath(path, option.Name), Old: option})
+			continue
+		}
+		keptOrder = append(keptOrder, option.Name)
+	}
+
+	// Options are shown to users in the order they are declared
+	if !reflect.DeepEqual(keptOrder, desiredOrder) {
+		changes = append(changes, FieldChange{Kind: ChangeChanged, Path: joinPath(path, "(order)"),
+			Old: liveOrder, New: optionNames(desired)})
+	}
+
+	return changes
+}
+
+func diffOption(path string, live *discordgo.ApplicationCommandOption, desired *discordgo.ApplicationCommandOption) []FieldChange {
+
+	var changes []FieldChange
+	field := func(name string, old interface{}, new interface{}) {
+		changes = append(changes, FieldChange{Kind: ChangeChanged, Path: joinPath(path, name), Old: old, New: new})
+	}
+
+	if live.Type != desired.Type {
+		field("type", live.Type, desired.Type)
+	}
+	if live.Description != desired.Description {
+		field("description", live.Description, desired.Description)
+	}
+	if live.Required != desired.Required {
+		field("required", live.Required, desired.Required)
+	}
+	if live.Autocomplete != desired.Autocomplete {
+		field("autocomplete", live.Autocomplete, desired.Autocomplete)
+	}
+	if !localizationsEqual(live.NameLocalizations, desired.NameLocalizations) {
+		field("name_localizations", live.NameLocalizations, desired.NameLocalizations)
+	}
+	if !localizationsEqual(live.DescriptionLocalizations, desired.DescriptionLocalizations) {
+		field("description_localizations", live.DescriptionLocalizations, desired.DescriptionLocalizations)
+	}
+	if !channelTypesEqual(live.ChannelTypes, desired.ChannelTypes) {
+		field("channel_types", live.ChannelTypes, desired.ChannelTypes)
+	}
+	if !floatPtrEqual(live.MinValue, desired.MinValue) {
+		field("min_value", live.MinValue, desired.MinValue)
+	}
+	if live.MaxValue != desired.MaxValue {
+		field("max_value", live.MaxValue, desired.MaxValue)
+	}
+	if !intPtrEqual(live.MinLength, desired.MinLength) {
+		field("min_length", live.MinLength, desired.MinLength)
+	}
+	if live.MaxLength != desired.MaxLength {
+		field("max_length", live.MaxLength, desired.MaxLength)
+	}
+	if !choicesEqual(live.Choices, desired.Choices) {
+		field("choices", live.Choices, desired.Choices)
+	}
+
+	return append(changes, diffOptions(path, live.Options, desired.Options)...)
+}
+
+func joinPath(path string, name string) string {
+	if len(path) == 0 {
+		return name
+	}
+	return path + " > " + name
+}
+
+func optionNames(options []*discordgo.ApplicationCommandOption) []string {
+	var names []string
+	for _, option := range options {
+		names = append(names, option.Name)
+	}
+	return names
+}
+
+func boolOrTrue(b *bool) bool {
+	return b == nil || *b
+}
+
+func boolOrFalse(b *bool) bool {
+	return b != nil && *b
+}
+
+// permissionsValue shows a permission bitfield by name in a plan. Unset means everyone can use the command.
+func permissionsValue(p *int64) interface{} {
+	if p == nil {
+		return nil
+	}
+	return append([]string{}, PermissionNamesOf(*p)...)
+}
+
+func derefLocalizations(l *map[discordgo.Locale]string) map[discordgo.Locale]string {
+	if l == nil {
+		return nil
+	}
+	return *l
+}
+
+func localizationsEqual(a map[discordgo.Locale]string, b map[discordgo.Locale]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for locale, value := range a {
+		if other, exists := b[locale]; !exists || other != value {
+			return false
+		}
+	}
+	return true
+}
+
+func channelTypesEqual(a []discordgo.ChannelType, b []discordgo.ChannelType) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	// Discord does not care about the order channel types are listed in
+	sortedA := append([]discordgo.ChannelType{}, a...)
+	sortedB := append([]discordgo.ChannelType{}, b...)
+	sort.Slice(sortedA, func(i, j int) bool { return sortedA[i] < sortedA[j] })
+	sort.Slice(sortedB, func(i, j int) bool { return sortedB[i] < sortedB[j] })
+	return reflect.DeepEqual(sortedA, sortedB)
+}
+
+func floatPtrEqual(a *float64, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func int64PtrEqual(a *int64, b *int64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func contextsEqual(a []discordgo.InteractionContextType, b []discordgo.InteractionContextType) bool {
+	sortedA := append([]discordgo.InteractionContextType{}, a...)
+	sortedB := append([]discordgo.InteractionContextType{}, b...)
+	sort.Slice(sortedA, func(i, j int) bool { return sortedA[i] < sortedA[j] })
+	sort.Slice(sortedB, func(i, j int) bool { return sortedB[i] < sortedB[j] })
+	return reflect.DeepEqual(sortedA, sortedB)
+}
+
+func integrationTypesEqual(a []discordgo.ApplicationIntegrationType, b []discordgo.ApplicationIntegrationType) bool {
+	sortedA := append([]discordgo.ApplicationIntegrationType{}, a...)
+	sortedB := append([]discordgo.ApplicationIntegrationType{}, b...)
+	sort.Slice(sortedA, func(i, j int) bool { return sortedA[i] < sortedA[j] })
+	sort.Slice(sortedB, func(i, j int) bool { return sortedB[i] < sortedB[j] })
+	return reflect.DeepEqual(sortedA, sortedB)
+}
+
+func intPtrEqual(a *int, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func choicesEqual(a []*discordgo.ApplicationCommandOptionChoice, b []*discordgo.ApplicationCommandOptionChoice) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name || !localizationsEqual(a[i].NameLocalizations, b[i].NameLocalizations) {
+			return false
+		}
+		if !choiceValuesEqual(a[i].Value, b[i].Value) {
+			return false
+		}
+	}
+	return true
+}
+
+// choiceValuesEqual compares choice values loaded from YAML (int, float64 or string)
+// with values decoded from the Discord API (float64 or string)
+func choiceValuesEqual(a interface{}, b interface{}) bool {
+	fa, aNumeric := toFloat(a)
+	fb, bNumeric := toFloat(b)
+	if aNumeric || bNumeric {
+		return aNumeric && bNumeric && fa == fb
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
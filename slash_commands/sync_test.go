@@ -0,0 +1,361 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"testing"
+)
+
+// mockDiscordApi is an in-memory stand-in for the application command endpoints.
+// Its methods match the AppCmd*Fn types and record every call made.
+type mockDiscordApi struct {
+	commands map[string][]*discordgo.ApplicationCommand
+	calls    []string
+	nextId   int
+	// Like Discord, every write gives the command a new version
+	version int
+}
+
+func (m *mockDiscordApi) nextVersion() string {
+	m.version += 1
+	return fmt.Sprintf("%d", m.version)
+}
+
+func newMockDiscordApi() *mockDiscordApi {
+	return &mockDiscordApi{commands: make(map[string][]*discordgo.ApplicationCommand)}
+}
+
+func (m *mockDiscordApi) seed(guildId string, cmds ...*discordgo.ApplicationCommand) {
+	for _, cmd := range cmds {
+		m.nextId += 1
+		cmd.ID = fmt.Sprintf("%d", m.nextId)
+		cmd.Version = m.nextVersion()
+		m.commands[guildId] = append(m.commands[guildId], cmd)
+	}
+}
+
+func (m *mockDiscordApi) writes() int {
+	n := 0
+	for _, call := range m.calls {
+		if call != "get" {
+			n += 1
+		}
+	}
+	return n
+}
+
+func (m *mockDiscordApi) Get(appId string, guildId string) ([]*discordgo.ApplicationCommand, error) {
+	m.calls = append(m.calls, "get")
+	return append([]*discordgo.ApplicationCommand{}, m.commands[guildId]...), nil
+}
+
+func (m *mockDiscordApi) Create(appId string, guildId string, cmd *discordgo.ApplicationCommand) (*discordgo.ApplicationCommand, error) {
+	m.calls = append(m.calls, "create "+cmd.Name)
+	// Like Discord, a scope holds at most 100 chat input commands
+	chatCommands := 0
+	for _, existing := range m.commands[guildId] {
+		if keyOf(existing).Type == discordgo.ChatApplicationCommand {
+			chatCommands += 1
+		}
+	}
+	if keyOf(cmd).Type == discordgo.ChatApplicationCommand && chatCommands >= 100 {
+		return nil, errors.New("HTTP 400 Bad Request: maximum number of application commands reached (100)")
+	}
+	created := *cmd
+	m.nextId += 1
+	created.ID = fmt.Sprintf("%d", m.nextId)
+	created.Version = m.nextVersion()
+	m.commands[guildId] = append(m.commands[guildId], &created)
+	return &created, nil
+}
+
+func (m *mockDiscordApi) Edit(appId string, guildId string, cmdId string, cmd *discordgo.ApplicationCommand) (*discordgo.ApplicationCommand, error) {
+	m.calls = append(m.calls, "edit "+cmd.Name)
+	for i, existing := range m.commands[guildId] {
+		if existing.ID == cmdId {
+			edited := *cmd
+			edited.ID = cmdId
+			edited.Version = m.nextVersion()
+			m.commands[guildId][i] = &edited
+			return &edited, nil
+		}
+	}
+	return nil, errors.New("unknown command " + cmdId)
+}
+
+func (m *mockDiscordApi) Delete(appId string, guildId string, cmdId string) error {
+	m.calls = append(m.calls, "delete "+cmdId)
+	for i, existing := range m.commands[guildId] {
+		if existing.ID == cmdId {
+			m.commands[guildId] = append(m.commands[guildId][:i], m.commands[guildId][i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("unknown command " + cmdId)
+}
+
+func (m *mockDiscordApi) BulkOverwrite(appId string, guildId string, cmds []*discordgo.ApplicationCommand) ([]*discordgo.ApplicationCommand, error) {
+	m.calls = append(m.calls, "bulk")
+	byName := make(map[string]string)
+	for _, existing := range m.commands[guildId] {
+		byName[existing.Name] = existing.ID
+	}
+
+	var result []*discordgo.ApplicationCommand
+	for _, cmd := range cmds {
+		written := *cmd
+		if id, exists := byName[cmd.Name]; exists {
+			written.ID = id
+		} else {
+			m.nextId += 1
+			written.ID = fmt.Sprintf("%d", m.nextId)
+		}
+		written.Version = m.nextVersion()
+		result = append(result, &written)
+	}
+	m.commands[guildId] = result
+	return result, nil
+}
+
+func (m *mockDiscordApi) find(guildId string, name string) *discordgo.ApplicationCommand {
+	for _, cmd := range m.commands[guildId] {
+		if cmd.Name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+func liveBlep() *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Type:        discordgo.ChatApplicationCommand,
+		Name:        "blep",
+		Description: "Send a random adorable animal photo",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "animal",
+				Description: "The type of animal",
+				Required:    true,
+				Choices: []*discordgo.ApplicationCommandOptionChoice{
+					{Name: "Dog", Value: "animal_dog"},
+					{Name: "Cat", Value: "animal_cat"},
+				},
+			},
+		},
+	}
+}
+
+func TestPlanSyncNoChanges(t *testing.T) {
+	desired := []*discordgo.ApplicationCommand{liveBlep()}
+	plan := PlanSync([]*discordgo.ApplicationCommand{liveBlep()}, desired, "")
+
+	if !plan.IsEmpty() {
+		t.Fatalf("Expected an empty plan, got %d operations", len(plan.Operations))
+	}
+	if len(plan.Unchanged) != 1 || plan.Unchanged[0] != "blep" {
+		t.Errorf("Expected blep to be unchanged, got %v", plan.Unchanged)
+	}
+}
+
+func TestPlanSyncCreateEditDelete(t *testing.T) {
+	changed := liveBlep()
+	changed.Description = "Send a cute animal photo"
+	live := []*discordgo.ApplicationCommand{
+		liveBlep(),
+		{ID: "99", Type: discordgo.ChatApplicationCommand, Name: "stale", Description: "No longer in the YAML"},
+	}
+	live[0].ID = "42"
+	desired := []*discordgo.ApplicationCommand{
+		changed,
+		{Type: discordgo.ChatApplicationCommand, Name: "helloworld", Description: "Tests our command architecture"},
+	}
+
+	plan := PlanSync(live, desired, "")
+	if plan.Count(SyncCreate) != 1 || plan.Count(SyncEdit) != 1 || plan.Count(SyncDelete) != 1 {
+		t.Fatalf("Expected one of each operation, got %d creates, %d edits, %d deletes",
+			plan.Count(SyncCreate), plan.Count(SyncEdit), plan.Count(SyncDelete))
+	}
+
+	for _, op := range plan.Operations {
+		switch op.Action {
+		case SyncEdit:
+			if op.ID != "42" || op.Name != "blep" {
+				t.Errorf("Expected edit of blep (ID 42), got %s (ID %s)", op.Name, op.ID)
+			}
+			if len(op.Changes) != 1 || op.Changes[0].Path != "description" {
+				t.Errorf("Expected only the description to change, got %+v", op.Changes)
+			}
+		case SyncDelete:
+			if op.ID != "99" {
+				t.Errorf("Expected stale command to be deleted, got ID %s", op.ID)
+			}
+		case SyncCreate:
+			if op.Name != "helloworld" {
+				t.Errorf("Expected helloworld to be created, got %s", op.Name)
+			}
+		}
+	}
+}
+
+func TestPlanSyncSameNameDifferentType(t *testing.T) {
+	live := []*discordgo.ApplicationCommand{{ID: "1", Type: discordgo.UserApplicationCommand, Name: "blep"}}
+	plan := PlanSync(live, []*discordgo.ApplicationCommand{liveBlep()}, "")
+
+	if plan.Count(SyncCreate) != 1 || plan.Count(SyncDelete) != 1 {
+		t.Errorf("Expected a user command and chat input command with the same name to be treated separately")
+	}
+}
+
+func TestDiffCommandOptions(t *testing.T) {
+	desired := liveBlep()
+	desired.Options[0].Choices = append(desired.Options[0].Choices,
+		&discordgo.ApplicationCommandOptionChoice{Name: "Penguin", Value: "animal_penguin"})
+	desired.Options = append(desired.Options, &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionBoolean,
+		Name:        "only_smol",
+		Description: "Whether to show only baby animals",
+	})
+
+	changes := DiffCommand(liveBlep(), desired, "")
+	paths := make(map[string]struct{})
+	for _, change := range changes {
+		paths[change.Path] = struct{}{}
+	}
+
+	for _, expected := range []string{"animal > choices", "only_smol"} {
+		if _, exists := paths[expected]; !exists {
+			t.Errorf("Expected a change at %s, got %+v", expected, changes)
+		}
+	}
+	if len(changes) != 2 {
+		t.Errorf("Expected exactly 2 changes, got %d: %+v", len(changes), changes)
+	}
+}
+
+func TestDiffCommandChoiceValueTypes(t *testing.T) {
+
+	// Integers loaded from YAML come back from the Discord API as float64
+	live := &discordgo.ApplicationCommand{Name: "roll", Options: []*discordgo.ApplicationCommandOption{{
+		Type: discordgo.ApplicationCommandOptionInteger, Name: "sides", Description: "Sides",
+		Choices: []*discordgo.ApplicationCommandOptionChoice{{Name: "d6", Value: float64(6)}},
+	}}}
+	desired := &discordgo.ApplicationCommand{Name: "roll", Options: []*discordgo.ApplicationCommandOption{{
+		Type: discordgo.ApplicationCommandOptionInteger, Name: "sides", Description: "Sides",
+		Choices: []*discordgo.ApplicationCommandOptionChoice{{Name: "d6", Value: 6}},
+	}}}
+
+	if changes := DiffCommand(live, desired, ""); len(changes) != 0 {
+		t.Errorf("Expected no changes, got %+v", changes)
+	}
+}
+
+func TestDiffCommandIgnoresDMSettingsInGuilds(t *testing.T) {
+	live := liveBlep()
+	desired := liveBlep()
+	dmPermission := false
+	desired.DMPermission = &dmPermission
+	desired.Contexts = &[]discordgo.InteractionContextType{discordgo.InteractionContextGuild}
+	desired.IntegrationTypes = &[]discordgo.ApplicationIntegrationType{discordgo.ApplicationIntegrationGuildInstall}
+
+	// Guild commands are never in DMs or installed to users, so Discord doesn't keep these for them
+	if changes := DiffCommand(live, desired, "123456789012345678"); len(changes) != 0 {
+		t.Errorf("Expected no changes in a guild, got %+v", changes)
+	}
+	if changes := DiffCommand(live, desired, ""); len(changes) != 2 {
+		t.Errorf("Expected contexts and integration types to change globally, got %+v", changes)
+	}
+}
+
+func TestApplySyncPlanKeepsIds(t *testing.T) {
+	api := newMockDiscordApi()
+	api.seed("", liveBlep(), &discordgo.ApplicationCommand{
+		Type: discordgo.ChatApplicationCommand, Name: "stale", Description: "No longer in the YAML"})
+	blepId := api.find("", "blep").ID
+
+	changed := liveBlep()
+	changed.Description = "Send a cute animal photo"
+	yml := AppCmdYml{Commands: []*discordgo.ApplicationCommand{changed}}
+
+	appId, guildId := "1234", ""
+	err := SyncCommands(api.Get, api.Create, api.Edit, api.Delete, nil, &appId, &guildId, &yml)
+	if err != nil {
+		t.Fatalf("Sync failed: %s", err.Error())
+	}
+
+	if len(api.commands[""]) != 1 {
+		t.Fatalf("Expected 1 command after sync, got %d", len(api.commands[""]))
+	}
+	blep := api.find("", "blep")
+	if blep == nil || blep.ID != blepId || blep.Description != changed.Description {
+		t.Errorf("Expected blep to be edited in place with ID %s, got %+v", blepId, blep)
+	}
+	if api.writes() != 2 {
+		t.Errorf("Expected 2 write calls, got %v", api.calls)
+	}
+}
+
+func TestApplySyncPlanRenamesAtTheCommandLimit(t *testing.T) {
+	api := newMockDiscordApi()
+	yml := AppCmdYml{}
+	for i := 0; i < 100; i++ {
+		api.seed("", &discordgo.ApplicationCommand{Type: discordgo.ChatApplicationCommand,
+			Name: fmt.Sprintf("command%d", i), Description: "One of many"})
+		yml.Commands = append(yml.Commands, &discordgo.ApplicationCommand{Type: discordgo.ChatApplicationCommand,
+			Name: fmt.Sprintf("command%d", i), Description: "One of many"})
+	}
+
+	// Renaming is a create and a delete, and the create only fits once the delete has made room
+	yml.Commands[0].Name = "renamed"
+	yml.Commands[1].Description = "Still one of many"
+	appId, guildId := "1234", ""
+	if err := SyncCommands(api.Get, api.Create, api.Edit, api.Delete, nil, &appId, &guildId, &yml); err != nil {
+		t.Fatalf("Sync failed: %s", err.Error())
+	}
+	if len(api.commands[""]) != 100 || api.find("", "renamed") == nil || api.find("", "command0") != nil {
+		t.Errorf("Expected command0 to be renamed, got %d commands", len(api.commands[""]))
+	}
+	if fmt.Sprint(api.calls[1:]) != "[delete 1 edit command1 create renamed]" {
+		t.Errorf("Expected deletes, then edits, then creates, got %v", api.calls[1:])
+	}
+}
+
+func TestSyncCommandsBulk(t *testing.T) {
+	api := newMockDiscordApi()
+	api.seed("", liveBlep())
+	blepId := api.find("", "blep").ID
+
+	yml := AppCmdYml{Commands: []*discordgo.ApplicationCommand{
+		liveBlep(),
+		{Type: discordgo.ChatApplicationCommand, Name: "helloworld", Description: "Tests our command architecture"},
+	}}
+
+	appId, guildId := "1234", ""
+	err := SyncCommands(api.Get, api.Create, api.Edit, api.Delete, api.BulkOverwrite, &appId, &guildId, &yml)
+	if err != nil {
+		t.Fatalf("Sync failed: %s", err.Error())
+	}
+
+	if api.writes() != 1 || api.calls[1] != "bulk" {
+		t.Errorf("Expected a single bulk overwrite, got %v", api.calls)
+	}
+	if blep := api.find("", "blep"); blep == nil || blep.ID != blepId {
+		t.Errorf("Expected blep to keep ID %s", blepId)
+	}
+}
+
+func TestSyncCommandsNothingToDo(t *testing.T) {
+	api := newMockDiscordApi()
+	api.seed("", liveBlep())
+	yml := AppCmdYml{Commands: []*discordgo.ApplicationCommand{liveBlep()}}
+
+	appId, guildId := "1234", ""
+	err := SyncCommands(api.Get, api.Create, api.Edit, api.Delete, api.BulkOverwrite, &appId, &guildId, &yml)
+	if err != nil {
+		t.Fatalf("Sync failed: %s", err.Error())
+	}
+	if api.writes() != 0 {
+		t.Errorf("Expected no write calls, got %v", api.calls)
+	}
+}
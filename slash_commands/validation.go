@@ -0,0 +1,579 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"github.com/sirupsen/logrus"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const MaxNameLength = 32
+const MaxDescriptionLength = 100
+const MaxOptions = 25
+const MaxChoices = 25
+const MaxChoiceNameLength = 100
+const MaxChoiceValueLength = 100
+const MaxCommandLength = 4000
+
+// ChatInputNamePattern is the pattern Discord enforces for chat input command and option names
+var ChatInputNamePattern = regexp.MustCompile(`^[-_\p{L}\p{N}\p{Devanagari}\p{Thai}]{1,32}$`)
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Rule IDs for every problem the validator can report
+const (
+	RuleNoCommands           = "no-commands"
+	RuleGuildIdsMissing      = "guild-ids-missing"
+	RuleGuildIdInvalid       = "guild-id-invalid"
+	RuleCommandNameMissing   = "command-name-missing"
+	RuleCommandTypeInvalid   = "command-type-invalid"
+	RuleCommandNameDuplicate = "command-name-duplicate"
+	RuleCommandDescMissing   = "command-description-missing"
+	RuleContextMenuDesc      = "context-menu-description"
+	RuleContextMenuOptions   = "context-menu-options"
+	RuleTooManyCommands      = "too-many-commands"
+	RuleCommandTooLong       = "command-too-long"
+	RuleNameInvalid          = "name-invalid"
+	RuleNameNotLowercase     = "name-not-lowercase"
+	RuleNameTooLong          = "name-too-long"
+	RuleDescriptionLength    = "description-length"
+	RuleTooManyOptions       = "too-many-options"
+	RuleOptionNameMissing    = "option-name-missing"
+	RuleOptionNameDuplicate  = "option-name-duplicate"
+	RuleOptionDescMissing    = "option-description-missing"
+	RuleOptionTypeMissing    = "option-type-missing"
+	RuleRequiredOrder        = "required-after-optional"
+	RuleRequiredOnSubcommand = "required-on-subcommand"
+	RuleMixedSubcommands     = "mixed-subcommands-and-options"
+	RuleSubCmdGroupContent   = "subcommand-group-content"
+	RuleNestedSubcommand     = "nested-subcommand"
+	RuleTooManyChoices       = "too-many-choices"
+	RuleChoiceNameLength     = "choice-name-length"
+	RuleChoiceValueLength    = "choice-value-length"
+)
+
+// ValidationProblem is a single thing wrong with commands.yml. Path names the command
+// and options it was found under, for example "permissions > guild > set > channel".
+type ValidationProblem struct {
+	Path     string          `json:"path"`
+	Rule     string          `json:"rule"`
+	Severity Severity        `json:"severity"`
+	Message  string          `json:"message"`
+	Position *SourcePosition `json:"position,omitempty"`
+}
+
+func (p *ValidationProblem) String() string {
+	location := ""
+	if p.Position != nil {
+		location = p.Position.String() + ": "
+	}
+	path := ""
+	if len(p.Path) > 0 {
+		path = p.Path + ": "
+	}
+	return fmt.Sprintf("%s%s [%s] %s%s", location, p.Severity, p.Rule, path, p.Message)
+}
+
+// ValidationResult collects every problem found in commands.yml, rather than stopping at the first
+type ValidationResult struct {
+	Problems []*ValidationProblem
+	source   *yamlSource
+}
+
+// ValidationError is returned when a validation result has errors in it
+type ValidationError struct {
+	Problems []*ValidationProblem
+}
+
+func (e *ValidationError) Error() string {
+	var lines []string
+	for _, problem := range e.Problems {
+		lines = append(lines, problem.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (r *ValidationResult) add(severity Severity, rule string, path string, obj interface{}, field string,
+	format string, args ...interface{}) {
+
+	r.Problems = append(r.Problems, &ValidationProblem{
+		Path:     path,
+		Rule:     rule,
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+		Position: r.source.Position(obj, field),
+	})
+}
+
+func (r *ValidationResult) addError(rule string, path string, obj interface{}, field string, format string, args ...interface{}) {
+	r.add(SeverityError, rule, path, obj, field, format, args...)
+}
+
+func (r *ValidationResult) addWarning(rule string, path string, obj interface{}, field string, format string, args ...interface{}) {
+	r.add(SeverityWarning, rule, path, obj, field, format, args...)
+}
+
+func (r *ValidationResult) Count(severity Severity) int {
+	n := 0
+	for _, problem := range r.Problems {
+		if problem.Severity == severity {
+			n += 1
+		}
+	}
+	return n
+}
+
+func (r *ValidationResult) HasErrors() bool {
+	return r.Count(SeverityError) > 0
+}
+
+// Err returns every error found as a single error, or nil if there were only warnings
+func (r *ValidationResult) Err() error {
+	var errs []*ValidationProblem
+	for _, problem := range r.Problems {
+		if problem.Severity == SeverityError {
+			errs = append(errs, problem)
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: errs}
+}
+
+func (r *ValidationResult) Summary() string {
+	return fmt.Sprintf("%d error(s), %d warning(s)", r.Count(SeverityError), r.Count(SeverityWarning))
+}
+
+// Log writes each problem at its own severity, followed by the summary
+func (r *ValidationResult) Log() {
+	for _, problem := range r.Problems {
+		if problem.Severity == SeverityError {
+			logrus.Error(problem.String())
+		} else {
+			logrus.Warn(problem.String())
+		}
+	}
+	logrus.Infof("Validation finished: %s", r.Summary())
+}
+
+func ValidCommands(yml *AppCmdYml) error {
+	return ValidateCommands(yml).Err()
+}
+
+// ValidateCommands checks the whole of yml and reports every problem it finds
+func ValidateCommands(yml *AppCmdYml) *ValidationResult {
+
+	r := &ValidationResult{source: yml.source}
+
+	// Ensure we actually have commands to validate
+	numCommands := len(yml.Commands)
+	for _, group := range yml.Guilds {
+		numCommands += len(group.Commands)
+	}
+	if numCommands < 1 {
+		r.addError(RuleNoCommands, "", nil, "", "no commands found")
+		return r
+	}
+
+	// Each guild group must say which guilds it is deployed to
+	for i, group := range yml.Guilds {
+		path := fmt.Sprintf("Guilds[%d]", i)
+		if len(group.GuildIds) == 0 {
+			r.addError(RuleGuildIdsMissing, path, group, "", "guild group has no guild IDs")
+		}
+		for _, guildId := range group.GuildIds {
+			if !IsSnowflake(guildId) {
+				r.addError(RuleGuildIdInvalid, path, group, "GuildIds", "invalid guild ID: %q", guildId)
+			}
+		}
+	}
+
+	// Check the structure of each command once, wherever it is deployed
+	for i, command := range yml.Commands {
+		validateCommand(r, i, command)
+	}
+	for _, group := range yml.Guilds {
+		for i, command := range group.Commands {
+			validateCommand(r, i, command)
+			validateGuildAvailability(r, commandPath(i, command), command)
+		}
+	}
+
+	// Global commands and each guild's commands are registered separately,
+	// so limits and name collisions apply to each scope on its own
+	for _, scope := range CommandScopes(yml) {
+		validateScope(r, scope)
+	}
+	return r
+}
+
+func commandPath(i int, command *discordgo.ApplicationCommand) string {
+	if len(command.Name) == 0 {
+		return fmt.Sprintf("#%d", i)
+	}
+	return command.Name
+}
+
+func validateScope(r *ValidationResult, scope *CommandScope) {
+
+	where := ""
+	if scope.GuildID != "" {
+		where = fmt.Sprintf(" in guild %s", scope.GuildID)
+	}
+
+	var counts = make(map[discordgo.ApplicationCommandType]int)
+	var names = make(map[commandKey]*discordgo.ApplicationCommand)
+	for i, command := range scope.Commands {
+		key := keyOf(command)
+		counts[key.Type] += 1
+
+		if len(command.Name) == 0 {
+			continue
+		}
+		if first, exists := names[key]; exists {
+			// Commands can be spread over several files, so say where the other one is
+			declared := ""
+			if position := r.source.Position(first, "name"); position != nil {
+				declared = fmt.Sprintf(", first declared at %s", position)
+			}
+			r.addError(RuleCommandNameDuplicate, commandPath(i, command), command, "name",
+				"%s with name %s already exists%s%s", commandTypeName(key.Type), command.Name, where, declared)
+			continue
+		}
+		names[key] = command
+	}
+
+	// Check for absolute limit of app commands
+	limits := map[discordgo.ApplicationCommandType]int{
+		discordgo.ChatApplicationCommand:    MaxChatInputCmds,
+		discordgo.UserApplicationCommand:    MaxUserCmds,
+		discordgo.MessageApplicationCommand: MaxMessageCmds,
+	}
+	for _, cmdType := range []discordgo.ApplicationCommandType{discordgo.ChatApplicationCommand,
+		discordgo.UserApplicationCommand, discordgo.MessageApplicationCommand} {
+		if counts[cmdType] > limits[cmdType] {
+			r.addError(RuleTooManyCommands, "", nil, "", "too many %ss found%s: %d, more than the limit of %d",
+				commandTypeName(cmdType), where, counts[cmdType], limits[cmdType])
+		}
+	}
+}
+
+func validateCommand(r *ValidationResult, i int, command *discordgo.ApplicationCommand) {
+
+	path := commandPath(i, command)
+
+	// Each application command must have a name
+	if len(command.Name) == 0 {
+		r.addError(RuleCommandNameMissing, path, command, "", "command name not found")
+	}
+
+	// Each application command must have a valid type
+	switch command.Type {
+	case discordgo.ChatApplicationCommand:
+
+		// Chat input commands must have a description
+		if len(command.Description) == 0 {
+			r.addError(RuleCommandDescMissing, path, command, "", "command description not found")
+		} else if err := ValidateDescription(command.Description); err != nil {
+			r.addError(RuleDescriptionLength, path, command, "description", err.Error())
+		}
+
+		// Chat input names must follow Discord's rules
+		if len(command.Name) > 0 {
+			validateChatInputName(r, path, command, command.Name)
+		}
+
+		// Translations follow the same rules as the strings they translate
+		validateLocalizations(r, path, command, "name_localizations",
+			derefLocalizations(command.NameLocalizations), chatInputNameRule)
+		validateLocalizations(r, path, command, "description_localizations",
+			derefLocalizations(command.DescriptionLocalizations), descriptionRule)
+
+		// The combined length of names, descriptions and values has a limit
+		if length := CommandLength(command); length > MaxCommandLength {
+			r.addError(RuleCommandTooLong, path, command, "", "command is %d characters long, more than the limit of %d",
+				length, MaxCommandLength)
+		}
+
+	case discordgo.UserApplicationCommand, discordgo.MessageApplicationCommand:
+
+		// Context menu command names can have spaces and capitals, but are still limited in length
+		if utf8.RuneCountInString(command.Name) > MaxNameLength {
+			r.addError(RuleNameTooLong, path, command, "name", "%s name is longer than %d characters",
+				commandTypeName(command.Type), MaxNameLength)
+		}
+		validateLocalizations(r, path, command, "name_localizations",
+			derefLocalizations(command.NameLocalizations), contextMenuNameRule)
+
+		// Context menu commands cannot have a description or options
+		if len(command.Description) != 0 || command.DescriptionLocalizations != nil {
+			r.addError(RuleContextMenuDesc, path, command, "description", "%s has a description",
+				commandTypeName(command.Type))
+		}
+		if len(command.Options) != 0 {
+			r.addError(RuleContextMenuOptions, path, command, "options", "%s has options",
+				commandTypeName(command.Type))
+		}
+
+	default:
+		r.addError(RuleCommandTypeInvalid, path, command, "type", "command had invalid type: %v", command.Type)
+	}
+
+	// Who can use the command and where
+	validateAvailability(r, path, command)
+
+	// Each command can only have so many options
+	if len(command.Options) > MaxOptions {
+		r.addError(RuleTooManyOptions, path, command, "options", "command has %d options, more than the limit of %d",
+			len(command.Options), MaxOptions)
+	}
+
+	// Iterate through options
+	validateOptionNames(r, path, command.Options)
+	nonRequiredOptionsFound := false
+	numSubCommands, numOptions := 0, 0
+	for j, option := range command.Options {
+
+		optionPath := validateOption(r, path, j, option)
+
+		// Required options must come first
+		if option.Required && nonRequiredOptionsFound {
+			r.addError(RuleRequiredOrder, optionPath, option, "required",
+				"encountered required option after non-required options")
+		}
+
+		// Each option must have a valid type
+		// Validate against bad nesting, while we're at it
+		switch option.Type {
+		case discordgo.ApplicationCommandOptionSubCommandGroup:
+			numSubCommands += 1
+			ValidateSubCommandGroup(r, optionPath, option)
+		case discordgo.ApplicationCommandOptionSubCommand:
+			numSubCommands += 1
+			ValidateSubCommand(r, optionPath, option)
+		case 0:
+			r.addError(RuleOptionTypeMissing, optionPath, option, "", "option has invalid type")
+		default:
+			numOptions += 1
+			if !option.Required {
+				nonRequiredOptionsFound = true
+			}
+			ValidateChoices(r, optionPath, option)
+		}
+	}
+
+	// Subcommands replace the command's own options, so the two can't be mixed
+	if numSubCommands > 0 && numOptions > 0 {
+		r.addError(RuleMixedSubcommands, path, command, "options",
+			"command has both subcommands and options")
+	}
+}
+
+// validateOption runs the checks every option shares, whatever it is nested under, and returns its path
+func validateOption(r *ValidationResult, parentPath string, i int, option *discordgo.ApplicationCommandOption) string {
+
+	path := joinPath(parentPath, option.Name)
+	if len(option.Name) == 0 {
+		path = joinPath(parentPath, fmt.Sprintf("#%d", i))
+		r.addError(RuleOptionNameMissing, path, option, "", "option name not found")
+	} else {
+		validateChatInputName(r, path, option, option.Name)
+	}
+
+	// Each option must have a description
+	if len(option.Description) == 0 {
+		r.addError(RuleOptionDescMissing, path, option, "", "option description not found")
+	} else if err := ValidateDescription(option.Description); err != nil {
+		r.addError(RuleDescriptionLength, path, option, "description", err.Error())
+	}
+
+	// Translations follow the same rules as the strings they translate
+	validateLocalizations(r, path, option, "name_localizations", option.NameLocalizations, chatInputNameRule)
+	validateLocalizations(r, path, option, "description_localizations", option.DescriptionLocalizations, descriptionRule)
+
+	// Discord ignores required on anything that isn't a plain option
+	if option.Required && (option.Type == discordgo.ApplicationCommandOptionSubCommand ||
+		option.Type == discordgo.ApplicationCommandOptionSubCommandGroup) {
+		r.addWarning(RuleRequiredOnSubcommand, path, option, "required",
+			"required has no effect on a %s", option.Type)
+	}
+
+	// Each option type only allows some fields
+	ValidateOptionType(r, path, option)
+
+	return path
+}
+
+// validateOptionNames checks that options declared side by side don't share a name
+func validateOptionNames(r *ValidationResult, path string, options []*discordgo.ApplicationCommandOption) {
+	names := make(map[string]struct{})
+	for _, option := range options {
+		if len(option.Name) == 0 {
+			continue
+		}
+		if _, exists := names[option.Name]; exists {
+			r.addError(RuleOptionNameDuplicate, joinPath(path, option.Name), option, "name",
+				"option with name %s already exists", option.Name)
+		}
+		names[option.Name] = struct{}{}
+	}
+}
+
+func ValidateSubCommandGroup(r *ValidationResult, path string, subCmdGroup *discordgo.ApplicationCommandOption) {
+
+	// Each subcommand group can only have so many subcommands
+	if len(subCmdGroup.Options) > MaxOptions {
+		r.addError(RuleTooManyOptions, path, subCmdGroup, "options",
+			"subcommand group has %d subcommands, more than the limit of %d", len(subCmdGroup.Options), MaxOptions)
+	}
+
+	validateOptionNames(r, path, subCmdGroup.Options)
+	for i, option := range subCmdGroup.Options {
+
+		optionPath := validateOption(r, path, i, option)
+
+		// Every option should be a subcommand
+		if option.Type != discordgo.ApplicationCommandOptionSubCommand {
+			r.addError(RuleSubCmdGroupContent, optionPath, option, "type",
+				"non-subcommand listed in subcommand group")
+			continue
+		}
+
+		// Validate the substructure of the subcommand
+		ValidateSubCommand(r, optionPath, option)
+	}
+}
+
+func ValidateSubCommand(r *ValidationResult, path string, subCmd *discordgo.ApplicationCommandOption) {
+
+	// Each subcommand can only have so many options
+	if len(subCmd.Options) > MaxOptions {
+		r.addError(RuleTooManyOptions, path, subCmd, "options",
+			"subcommand has %d options, more than the limit of %d", len(subCmd.Options), MaxOptions)
+	}
+
+	validateOptionNames(r, path, subCmd.Options)
+	nonRequiredOptionsFound := false
+	for i, option := range subCmd.Options {
+
+		optionPath := validateOption(r, path, i, option)
+
+		// Every option should not be a subcommand group or subcommand
+		if option.Type == discordgo.ApplicationCommandOptionSubCommandGroup || option.Type == discordgo.ApplicationCommandOptionSubCommand {
+			r.addError(RuleNestedSubcommand, optionPath, option, "type",
+				"cannot nest subcommand group or subcommand under subcommand")
+			continue
+		}
+		if option.Type == 0 {
+			r.addError(RuleOptionTypeMissing, optionPath, option, "", "option has invalid type")
+		}
+
+		// Required options must come first
+		if option.Required && nonRequiredOptionsFound {
+			r.addError(RuleRequiredOrder, optionPath, option, "required",
+				"encountered required option after non-required options")
+		}
+		if !option.Required {
+			nonRequiredOptionsFound = true
+		}
+
+		ValidateChoices(r, optionPath, option)
+	}
+}
+
+func validateChatInputName(r *ValidationResult, path string, obj interface{}, name string) {
+	if rule, err := chatInputNameRule(name); err != nil {
+		r.addError(rule, path, obj, "name", err.Error())
+	}
+}
+
+// chatInputNameRule checks a chat input name, and says which rule it broke if it isn't valid
+func chatInputNameRule(name string) (string, error) {
+	err := ValidateChatInputName(name)
+	if err != nil && ChatInputNamePattern.MatchString(name) {
+		return RuleNameNotLowercase, err
+	}
+	return RuleNameInvalid, err
+}
+
+// ValidateChatInputName checks a chat input command, subcommand or option name is
+// 1-32 characters long, lowercase and has no spaces
+func ValidateChatInputName(name string) error {
+	if !ChatInputNamePattern.MatchString(name) {
+		return errors.New(fmt.Sprintf("name %q must be 1-%d letters, numbers, dashes or underscores",
+			name, MaxNameLength))
+	}
+	if name != strings.ToLower(name) {
+		return errors.New(fmt.Sprintf("name %q must be lowercase", name))
+	}
+	return nil
+}
+
+func ValidateDescription(description string) error {
+	if length := utf8.RuneCountInString(description); length < 1 || length > MaxDescriptionLength {
+		return errors.New(fmt.Sprintf("description must be 1-%d characters, found %d",
+			MaxDescriptionLength, length))
+	}
+	return nil
+}
+
+func ValidateChoices(r *ValidationResult, path string, option *discordgo.ApplicationCommandOption) {
+
+	// Each option can only have so many choices
+	if len(option.Choices) > MaxChoices {
+		r.addError(RuleTooManyChoices, path, option, "choices", "%d choices found, more than the limit of %d",
+			len(option.Choices), MaxChoices)
+	}
+
+	for _, choice := range option.Choices {
+
+		// Each choice must have a name of the right length
+		if length := utf8.RuneCountInString(choice.Name); length < 1 || length > MaxChoiceNameLength {
+			r.addError(RuleChoiceNameLength, path, choice, "name", "choice name %q must be 1-%d characters",
+				choice.Name, MaxChoiceNameLength)
+		}
+		validateLocalizations(r, path, choice, "name_localizations", choice.NameLocalizations, choiceNameRule)
+
+		// String values have the same length limit as names
+		if value, isString := choice.Value.(string); isString {
+			if length := utf8.RuneCountInString(value); length < 1 || length > MaxChoiceValueLength {
+				r.addError(RuleChoiceValueLength, path, choice, "value", "choice %s value must be 1-%d characters",
+					choice.Name, MaxChoiceValueLength)
+			}
+		}
+	}
+}
+
+// CommandLength is the combined length of a command's name, description, and the
+// names, descriptions and choice values of every option beneath it. Only the longest
+// translation of each name and description counts towards it.
+func CommandLength(command *discordgo.ApplicationCommand) int {
+	length := longestLocalization(command.Name, derefLocalizations(command.NameLocalizations)) +
+		longestLocalization(command.Description, derefLocalizations(command.DescriptionLocalizations))
+	for _, option := range command.Options {
+		length += optionLength(option)
+	}
+	return length
+}
+
+func optionLength(option *discordgo.ApplicationCommandOption) int {
+	length := longestLocalization(option.Name, option.NameLocalizations) +
+		longestLocalization(option.Description, option.DescriptionLocalizations)
+	for _, choice := range option.Choices {
+		length += longestLocalization(choice.Name, choice.NameLocalizations) +
+			utf8.RuneCountInString(fmt.Sprintf("%v", choice.Value))
+	}
+	for _, sub := range option.Options {
+		length += optionLength(sub)
+	}
+	return length
+}
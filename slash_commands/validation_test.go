@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func loadTestYAML(t *testing.T, name string) AppCmdYml {
+	yamlPath, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Unable to build path for input file: %s", err.Error())
+	}
+
+	yamlPath += "/test/" + name
+	return GetYAML(&yamlPath)
+}
+
+func TestValidateCommandsCollectsEveryProblem(t *testing.T) {
+	yml := loadTestYAML(t, "invalid/multiple_problems.yml")
+	result := ValidateCommands(&yml)
+
+	expected := []struct {
+		path     string
+		rule     string
+		severity Severity
+		line     int
+	}{
+		{"permissions > guild > set", RuleRequiredOnSubcommand, SeverityWarning, 13},
+		{"permissions > guild > set > channel", RuleOptionDescMissing, SeverityError, 19},
+		{"Blep", RuleCommandDescMissing, SeverityError, 22},
+		{"Blep", RuleNameNotLowercase, SeverityError, 22},
+		{"helloworld", RuleContextMenuDesc, SeverityError, 26},
+	}
+
+	if len(result.Problems) != len(expected) {
+		for _, problem := range result.Problems {
+			t.Log(problem.String())
+		}
+		t.Fatalf("Expected %d problems, got %d", len(expected), len(result.Problems))
+	}
+
+	for i, problem := range result.Problems {
+		if problem.Path != expected[i].path || problem.Rule != expected[i].rule || problem.Severity != expected[i].severity {
+			t.Errorf("Expected %s %s at %s, got %s", expected[i].severity, expected[i].rule, expected[i].path, problem)
+		}
+		if problem.Position == nil || problem.Position.Line != expected[i].line {
+			t.Errorf("Expected %s to point at line %d, got %v", problem.Rule, expected[i].line, problem.Position)
+		}
+	}
+
+	if result.Count(SeverityError) != 4 || result.Count(SeverityWarning) != 1 {
+		t.Errorf("Unexpected summary: %s", result.Summary())
+	}
+}
+
+func TestValidationErrorListsEveryError(t *testing.T) {
+	yml := loadTestYAML(t, "invalid/multiple_problems.yml")
+	err := ValidCommands(&yml)
+	if err == nil {
+		t.Fatalf("Expected validation to fail")
+	}
+
+	lines := strings.Split(err.Error(), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("Expected one line per error, got:\n%s", err.Error())
+	}
+	if !strings.HasSuffix(lines[0], "multiple_problems.yml:19:17: error [option-description-missing] "+
+		"permissions > guild > set > channel: option description not found") {
+		t.Errorf("Unexpected error line: %s", lines[0])
+	}
+}
+
+func TestWarningsDoNotFailValidation(t *testing.T) {
+	yml := loadTestYAML(t, "valid/subcommand_marked_required.yml")
+	result := ValidateCommands(&yml)
+
+	if result.HasErrors() || result.Err() != nil {
+		t.Fatalf("Expected no errors, got: %s", result.Err())
+	}
+	if result.Count(SeverityWarning) != 1 || result.Problems[0].Rule != RuleRequiredOnSubcommand {
+		t.Errorf("Expected a single %s warning, got %s", RuleRequiredOnSubcommand, result.Summary())
+	}
+}